@@ -16,6 +16,8 @@ type AccountInterface interface {
 	GetType() AccountType
 	HasHolder(kid string) bool
 	IsSuspended() bool
+	IsFrozen() bool
+	IsDeltaReceiving() bool
 }
 
 // AccountType _
@@ -38,6 +40,9 @@ type Account struct {
 	CreatedTime   *txtime.Time `json:"created_time,omitempty"`
 	UpdatedTime   *txtime.Time `json:"updated_time,omitempty"`
 	SuspendedTime *txtime.Time `json:"suspended_time,omitempty"`
+	FrozenTime    *txtime.Time `json:"frozen_time,omitempty"`   // frozen by the token authority
+	FreezeReason  string       `json:"freeze_reason,omitempty"` // reason code
+	DeltaReceive  bool         `json:"delta_receive,omitempty"` // incoming transfers are written as balance deltas
 }
 
 // GetID implements Identifiable
@@ -61,8 +66,19 @@ func (a *Account) HasHolder(kid string) bool {
 }
 
 // IsSuspended implements AccountInterface
+// A frozen account is also suspended.
 func (a *Account) IsSuspended() bool {
-	return a.SuspendedTime != nil
+	return a.SuspendedTime != nil || a.FrozenTime != nil
+}
+
+// IsFrozen implements AccountInterface
+func (a *Account) IsFrozen() bool {
+	return a.FrozenTime != nil
+}
+
+// IsDeltaReceiving implements AccountInterface
+func (a *Account) IsDeltaReceiving() bool {
+	return a.DeltaReceive
 }
 
 // Holder returns holder's KID
@@ -71,10 +87,23 @@ func (a *Account) Holder() string {
 	return strings.ToLower(a.DOCTYPEID[i : i+40])
 }
 
+// ThresholdTransientKey is the transient key of the threshold of a new joint account. (M of M-of-N)
+const ThresholdTransientKey = "threshold"
+
 // JointAccount _
 type JointAccount struct {
 	Account
-	Holders *stringset.Set `json:"holders"`
+	Holders   *stringset.Set `json:"holders"`
+	Threshold int            `json:"threshold,omitempty"` // M of M-of-N, 0 = all holders
+}
+
+// Quorum returns the number of holders required to approve a contract.
+func (a *JointAccount) Quorum() int {
+	n := a.Holders.Size()
+	if a.Threshold > 0 && a.Threshold < n {
+		return a.Threshold
+	}
+	return n
 }
 
 // HasHolder implements AccountInterface
@@ -105,3 +134,22 @@ func NewHolder(kid string, account AccountInterface) *Holder {
 		Type:      account.GetType(),
 	}
 }
+
+// AccountFreezeLogType _
+type AccountFreezeLogType int8
+
+const (
+	// AccountFreezeLogTypeFreeze _
+	AccountFreezeLogTypeFreeze AccountFreezeLogType = iota
+	// AccountFreezeLogTypeUnfreeze _
+	AccountFreezeLogTypeUnfreeze
+)
+
+// AccountFreezeLog is the history of freeze/unfreeze by the token authority
+type AccountFreezeLog struct {
+	DOCTYPEID   string               `json:"@account_freeze_log"` // address
+	Type        AccountFreezeLogType `json:"type"`
+	Reason      string               `json:"reason"`
+	RID         string               `json:"rid"` // relative ID - invoker's KID or contract
+	CreatedTime *txtime.Time         `json:"created_time,omitempty"`
+}
@@ -81,7 +81,8 @@ func (ab *AccountStub) CreateAccount(kid string) (*Account, *Balance, error) {
 }
 
 // CreateJointAccount _
-func (ab *AccountStub) CreateJointAccount(holders *stringset.Set) (*JointAccount, *Balance, error) {
+// threshold is the number of holders required to approve a contract. (0 = all holders)
+func (ab *AccountStub) CreateJointAccount(holders *stringset.Set, threshold int) (*JointAccount, *Balance, error) {
 	ts, err := txtime.GetTime(ab.stub)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "failed to get the timestamp")
@@ -102,7 +103,8 @@ func (ab *AccountStub) CreateJointAccount(holders *stringset.Set) (*JointAccount
 				CreatedTime: ts,
 				UpdatedTime: ts,
 			},
-			Holders: holders,
+			Holders:   holders,
+			Threshold: threshold,
 		}
 		if err = ab.PutAccount(account); err != nil {
 			return nil, nil, errors.Wrap(err, "failed to create an account")
@@ -268,6 +270,109 @@ func (ab *AccountStub) UnsuspendAccount(kid string) (*Account, error) {
 	return pac, nil
 }
 
+// FreezeAccount freezes the account by the token authority.
+// rid is the invoker's KID or the contract ID.
+func (ab *AccountStub) FreezeAccount(account AccountInterface, reason, rid string) (AccountInterface, error) {
+	if account.IsFrozen() {
+		return nil, errors.New("already frozen")
+	}
+
+	ts, err := txtime.GetTime(ab.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	a := baseAccount(account)
+	a.FrozenTime = ts
+	a.FreezeReason = reason
+	a.UpdatedTime = ts
+	if err = ab.PutAccount(account); err != nil {
+		return nil, errors.Wrap(err, "failed to update the account")
+	}
+
+	log := &AccountFreezeLog{
+		DOCTYPEID:   account.GetID(),
+		Type:        AccountFreezeLogTypeFreeze,
+		Reason:      reason,
+		RID:         rid,
+		CreatedTime: ts,
+	}
+	if err = ab.PutFreezeLog(log); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// UnfreezeAccount unfreezes the account by the token authority.
+// rid is the invoker's KID or the contract ID.
+func (ab *AccountStub) UnfreezeAccount(account AccountInterface, reason, rid string) (AccountInterface, error) {
+	if !account.IsFrozen() {
+		return nil, errors.New("not frozen")
+	}
+
+	ts, err := txtime.GetTime(ab.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	a := baseAccount(account)
+	a.FrozenTime = nil
+	a.FreezeReason = ""
+	a.UpdatedTime = ts
+	if err = ab.PutAccount(account); err != nil {
+		return nil, errors.Wrap(err, "failed to update the account")
+	}
+
+	log := &AccountFreezeLog{
+		DOCTYPEID:   account.GetID(),
+		Type:        AccountFreezeLogTypeUnfreeze,
+		Reason:      reason,
+		RID:         rid,
+		CreatedTime: ts,
+	}
+	if err = ab.PutFreezeLog(log); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// CreateFreezeLogKey _
+func (ab *AccountStub) CreateFreezeLogKey(id string, seq int64) string {
+	return fmt.Sprintf("AFLOG_%s_%d", id, seq)
+}
+
+// PutFreezeLog _
+func (ab *AccountStub) PutFreezeLog(log *AccountFreezeLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the freeze log")
+	}
+	if err = ab.stub.PutState(ab.CreateFreezeLogKey(log.DOCTYPEID, log.CreatedTime.UnixNano()), data); err != nil {
+		return errors.Wrap(err, "failed to put the freeze log state")
+	}
+	return nil
+}
+
+// GetQueryFreezeLogs _
+func (ab *AccountStub) GetQueryFreezeLogs(addr, bookmark string, fetchSize int) (*QueryResult, error) {
+	if fetchSize < 1 {
+		fetchSize = AccountsFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+	query := CreateQueryAccountFreezeLogs(addr)
+	iter, meta, err := ab.stub.GetQueryResultWithPagination(query, int32(fetchSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	return NewQueryResult(meta, iter)
+}
+
 // CreateHolderKey _
 func (ab *AccountStub) CreateHolderKey(id, addr string) string {
 	return fmt.Sprintf("HLD_%s_%s", id, addr)
@@ -324,6 +429,9 @@ func (ab *AccountStub) RemoveHolder(account *JointAccount, kid string) (*JointAc
 	}
 
 	account.Holders.Remove(kid)
+	if account.Threshold > account.Holders.Size() {
+		account.Threshold = account.Holders.Size()
+	}
 	account.UpdatedTime = ts
 	if err = ab.PutAccount(account); err != nil {
 		return nil, errors.Wrap(err, "failed to update the account")
@@ -336,3 +444,95 @@ func (ab *AccountStub) RemoveHolder(account *JointAccount, kid string) (*JointAc
 
 	return account, nil
 }
+
+// ReplaceHolders replaces the whole holder set of the account, and the account-holder relationships.
+// The joint account needs 2+ holders.
+func (ab *AccountStub) ReplaceHolders(account *JointAccount, holders *stringset.Set) (*JointAccount, error) {
+	if holders.Size() < 2 {
+		return nil, errors.New("the joint account needs 2+ holders")
+	}
+
+	ts, err := txtime.GetTime(ab.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	// remove account-holder relationships
+	for kid := range account.Holders.Map() {
+		if !holders.Contains(kid) {
+			if err = ab.stub.DelState(ab.CreateHolderKey(kid, account.GetID())); err != nil {
+				return nil, errors.Wrap(err, "failed to delete the relationship")
+			}
+		}
+	}
+	// create account-holder relationships
+	for kid := range holders.Map() {
+		if !account.Holders.Contains(kid) {
+			holder := NewHolder(kid, account)
+			holder.CreatedTime = ts
+			if err = ab.PutHolder(holder); err != nil {
+				return nil, errors.Wrap(err, "failed to create the relationship")
+			}
+		}
+	}
+
+	account.Holders = holders
+	if account.Threshold > account.Holders.Size() {
+		account.Threshold = account.Holders.Size()
+	}
+	account.UpdatedTime = ts
+	if err = ab.PutAccount(account); err != nil {
+		return nil, errors.Wrap(err, "failed to update the account")
+	}
+
+	return account, nil
+}
+
+// SetThreshold _
+func (ab *AccountStub) SetThreshold(account *JointAccount, threshold int) (*JointAccount, error) {
+	if threshold < 0 || threshold > account.Holders.Size() {
+		return nil, errors.New("invalid threshold")
+	}
+
+	ts, err := txtime.GetTime(ab.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	account.Threshold = threshold
+	account.UpdatedTime = ts
+	if err = ab.PutAccount(account); err != nil {
+		return nil, errors.Wrap(err, "failed to update the account")
+	}
+
+	return account, nil
+}
+
+// SetDeltaReceive sets(unsets) the delta receiving flag of the account.
+func (ab *AccountStub) SetDeltaReceive(account AccountInterface, deltaReceive bool) (AccountInterface, error) {
+	if account.IsDeltaReceiving() == deltaReceive {
+		return nil, errors.New("same delta receiving flag")
+	}
+
+	ts, err := txtime.GetTime(ab.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	a := baseAccount(account)
+	a.DeltaReceive = deltaReceive
+	a.UpdatedTime = ts
+	if err = ab.PutAccount(account); err != nil {
+		return nil, errors.Wrap(err, "failed to update the account")
+	}
+
+	return account, nil
+}
+
+// baseAccount returns the embedded Account of the account.
+func baseAccount(account AccountInterface) *Account {
+	if jac, ok := account.(*JointAccount); ok {
+		return &jac.Account
+	}
+	return account.(*Account)
+}
@@ -0,0 +1,247 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// getTestJointAccount returns the committed joint account.
+func getTestJointAccount(t *testing.T, h *testHarness, addr string) *JointAccount {
+	t.Helper()
+	jac := &JointAccount{}
+	if err := json.Unmarshal(h.getState(NewAccountStub(nil, "").CreateKey(addr)), jac); err != nil {
+		t.Fatal(err)
+	}
+	return jac
+}
+
+// 2-of-3 joint account
+func TestJointAccountThreshold(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	carolAddr := testAccountAddr("PCI", carol)
+
+	threshold := func(m string) map[string][]byte {
+		return map[string][]byte{ThresholdTransientKey: []byte(m)}
+	}
+	if res := h.invokeWithTransient(alice, threshold("4"), "account/create", "PCI", bobAddr, carolAddr); res.Status == shim.OK {
+		t.Fatal("threshold must not exceed the number of holders")
+	}
+	if res := h.invokeWithTransient(alice, threshold("2"), "account/create", "PCI"); res.Status == shim.OK {
+		t.Fatal("threshold is only for joint account")
+	}
+
+	// account creation needs all holders
+	res := h.invokeWithTransient(alice, threshold("2"), "account/create", "PCI", bobAddr, carolAddr)
+	if res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	con := map[string]interface{}{}
+	if err := json.Unmarshal(res.Payload, &con); err != nil {
+		t.Fatal(err)
+	}
+	cid := con["@contract"].(string)
+	for _, kid := range []string{alice, bob, carol} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	list := struct {
+		Records []*Holder `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "account/list", "PCI"), &list); err != nil {
+		t.Fatal(err)
+	}
+	jointAddr := ""
+	for _, holder := range list.Records {
+		if holder.Type == AccountTypeJoint {
+			jointAddr = holder.Address
+		}
+	}
+	if jointAddr == "" {
+		t.Fatal("joint account is not created")
+	}
+	if jac := getTestJointAccount(t, h, jointAddr); jac.Threshold != 2 || jac.Quorum() != 2 {
+		t.Fatalf("unexpected threshold: %d", jac.Threshold)
+	}
+
+	h.mustInvokeAs(issuer, "transfer", genesis, jointAddr, "500")
+
+	// 2 approvals execute the transfer
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", jointAddr, aliceAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	if res := h.approveContract(log.RID, alice); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "0")
+	if res := h.approveContract(log.RID, carol); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "100")
+	assertBalance(t, h, jointAddr, "399")
+	if res := h.cancelContract(log.RID, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, jointAddr, "399") // the executed contract is not cancelled
+
+	// a single rejection is not a veto
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", jointAddr, aliceAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	if res := h.cancelContract(log.RID, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, jointAddr, "298")
+	if res := h.approveContract(log.RID, bob); res.Status == shim.OK {
+		t.Fatal("the signer already rejected")
+	}
+	for _, kid := range []string{alice, carol} {
+		if res := h.approveContract(log.RID, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	assertBalance(t, h, aliceAddr, "200")
+
+	// 2 rejections cancel the contract (kiesnet-contract calls back only once)
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", jointAddr, aliceAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	if res := h.cancelContract(log.RID, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, jointAddr, "197")
+	if res := h.invokeAs(carol, "contract/reject", log.RID); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, jointAddr, "298") // the fee is returned with the pending balance
+	if res := h.approveContract(log.RID, alice); res.Status == shim.OK {
+		t.Fatal("the contract is cancelled")
+	}
+
+	// the holder to be added must approve
+	dave := h.newKID("dave")
+	h.mustInvokeAs(dave, "account/create", "PCI")
+	cid = getTestContractID(t, h.mustInvokeAs(alice, "account/holder/add", jointAddr, testAccountAddr("PCI", dave)))
+	for _, kid := range []string{alice, bob, carol} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	if getTestJointAccount(t, h, jointAddr).HasHolder(dave) {
+		t.Fatal("the holder is added without approval")
+	}
+	if res := h.approveContract(cid, dave); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	if !getTestJointAccount(t, h, jointAddr).HasHolder(dave) {
+		t.Fatal("the holder is not added")
+	}
+
+	// raise the threshold to 3 (approved by the current quorum)
+	data = h.mustInvokeAs(bob, "account/threshold/set", jointAddr, "3")
+	if err := json.Unmarshal(data, &con); err != nil {
+		t.Fatal(err)
+	}
+	cid = con["@contract"].(string)
+	if res := h.approveContract(cid, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	if res := h.approveContract(cid, alice); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	if jac := getTestJointAccount(t, h, jointAddr); jac.Quorum() != 3 {
+		t.Fatalf("unexpected quorum: %d", jac.Quorum())
+	}
+
+	// 2 approvals are not enough anymore
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "transfer", jointAddr, bobAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	h.approveContract(log.RID, alice)
+	h.approveContract(log.RID, bob)
+	assertBalance(t, h, bobAddr, "0")
+	if res := h.approveContract(log.RID, carol); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, bobAddr, "100")
+}
+
+func TestAccountFreeze(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	if res := h.invokeAs(bob, "account/freeze", aliceAddr, "AML-01"); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can freeze accounts")
+	}
+	if res := h.invokeAs(issuer, "account/freeze", genesis, "AML-01"); res.Status == shim.OK {
+		t.Fatal("the genesis account must not be frozen")
+	}
+	h.mustInvokeAs(issuer, "account/freeze", aliceAddr, "AML-01")
+
+	// frozen account can't send or receive
+	if res := h.invokeAs(alice, "transfer", "", bobAddr, "10"); res.Status == shim.OK {
+		t.Fatal("frozen account must not send")
+	}
+	if res := h.invokeAs(issuer, "transfer", genesis, aliceAddr, "10"); res.Status == shim.OK {
+		t.Fatal("frozen account must not receive")
+	}
+
+	// the owner can't lift it
+	if res := h.invokeAs(alice, "account/unsuspend", "PCI"); res.Status == shim.OK {
+		t.Fatal("unsuspend must not lift the freeze")
+	}
+	if res := h.invokeAs(alice, "account/unfreeze", aliceAddr); res.Status == shim.OK {
+		t.Fatal("the owner must not unfreeze")
+	}
+
+	h.mustInvokeAs(issuer, "account/unfreeze", aliceAddr, "cleared")
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "10")
+	assertBalance(t, h, bobAddr, "10")
+
+	// history
+	result := struct {
+		Records []*AccountFreezeLog `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "account/freeze/logs", aliceAddr), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("unexpected freeze logs: %d", len(result.Records))
+	}
+	unfreeze, freeze := result.Records[0], result.Records[1]
+	if unfreeze.Type != AccountFreezeLogTypeUnfreeze || unfreeze.Reason != "cleared" ||
+		freeze.Type != AccountFreezeLogTypeFreeze || freeze.Reason != "AML-01" || freeze.RID != issuer {
+		t.Fatal("unexpected freeze logs")
+	}
+}
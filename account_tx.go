@@ -16,6 +16,7 @@ import (
 
 // params[0] : token code
 // params[1:] : co-holders' personal account addresses (exclude invoker, max 127)
+// transient "threshold" : optional. M of M-of-N (joint account only, see ThresholdTransientKey)
 func accountCreate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 1 {
 		return shim.Error("incorrect number of parameters. expecting 1+")
@@ -47,7 +48,23 @@ func accountCreate(stub shim.ChaincodeStubInterface, params []string) peer.Respo
 
 	ab := NewAccountStub(stub, code)
 
-	if len(params) < 2 { // personal account
+	// threshold
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("failed to get the transient map")
+	}
+	threshold := 0
+	coholders := params[1:]
+	if t := string(transient[ThresholdTransientKey]); len(t) > 0 {
+		if len(coholders) < 1 {
+			return shim.Error("threshold is only for joint account")
+		}
+		if threshold, err = strconv.Atoi(t); err != nil {
+			return shim.Error("invalid threshold")
+		}
+	}
+
+	if len(coholders) < 1 { // personal account
 		account, balance, err := ab.CreateAccount(kid)
 		if err != nil {
 			return responseError(err, "failed to create a personal account")
@@ -58,13 +75,14 @@ func accountCreate(stub shim.ChaincodeStubInterface, params []string) peer.Respo
 	// joint account
 
 	// check invoker's main(personal) account
-	if _, err = ab.GetAccount(NewAddress(code, AccountTypePersonal, kid)); err != nil {
+	pAddr := NewAddress(code, AccountTypePersonal, kid)
+	if _, err = ab.GetAccount(pAddr); err != nil {
 		return responseError(err, "failed to get invoker's personal account")
 	}
 
 	holders := stringset.New(kid) // KIDs
 
-	addrs := stringset.New(params[1:]...) // remove duplication
+	addrs := stringset.New(coholders...) // remove duplication
 	if addrs.Size() > 128 {
 		return shim.Error("too many holders")
 	}
@@ -80,17 +98,44 @@ func accountCreate(stub shim.ChaincodeStubInterface, params []string) peer.Respo
 	if holders.Size() < 2 { // addrs had invoker's addr
 		return shim.Error("joint account needs co-holders")
 	}
+	if threshold < 0 || threshold > holders.Size() {
+		return shim.Error("invalid threshold")
+	}
+
+	// fee (charged to invoker's main account when the contract is executed)
+	if _, err = tb.GetTokenState(code); err == nil { // issued
+		fee, err := NewFeeStub(stub).CalcFee(pAddr, "account/create", *ZeroAmount())
+		if err != nil {
+			return responseError(err, "failed to get the fee amount")
+		}
+		bal, err := NewBalanceStub(stub).GetBalance(pAddr.String())
+		if err != nil {
+			return responseError(err, "failed to get invoker's balance")
+		}
+		if bal.Amount.Cmp(fee) < 0 {
+			return shim.Error("not enough balance for the fee")
+		}
+	}
 
 	// contract
-	doc := []interface{}{"account/create", code, holders.Strings()}
-	return invokeContract(stub, doc, holders)
+	doc := []interface{}{"account/create", code, holders.Strings(), threshold, pAddr.String()}
+	return invokeContract(stub, doc, holders, 0)
 }
 
 // information of the account
 // params[0] : token code | account address
+// params[1] : optional. formatted flag (true = add formatted amounts with the token decimal)
 func accountGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	if len(params) != 1 {
-		return shim.Error("incorrect number of parameters. expecting 1")
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+	formatted := false
+	if len(params) > 1 && len(params[1]) > 0 {
+		b, err := strconv.ParseBool(params[1])
+		if err != nil {
+			return shim.Error("invalid formatted flag")
+		}
+		formatted = b
 	}
 
 	// authentication
@@ -122,6 +167,23 @@ func accountGet(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return responseError(err, "failed to get the account balance")
 	}
 
+	// unmerged balance deltas
+	ds, err := bb.GetDeltaSum(account.GetID(), 0, false)
+	if err != nil {
+		return responseError(err, "failed to get balance deltas")
+	}
+	if ds.Count > 0 || account.IsDeltaReceiving() {
+		if balance, err = appendBalanceDeltaSum(balance, ds); err != nil {
+			return responseError(err, "failed to append balance deltas")
+		}
+	}
+
+	if formatted {
+		if balance, err = formatAmountsOfState(stub, addr.Code, balance); err != nil {
+			return responseError(err, "failed to format the account balance")
+		}
+	}
+
 	return responseAccountWithBalanceState(account, balance)
 }
 
@@ -161,9 +223,9 @@ func accountHolderAdd(stub shim.ChaincodeStubInterface, params []string) peer.Re
 	signers := stringset.New(holder)
 	signers.AppendSet(jac.Holders)
 
-	// contract
+	// contract (the new holder + quorum of the holders)
 	doc := []interface{}{"account/holder/add", jac.GetID(), holder}
-	return invokeContract(stub, doc, signers)
+	return invokeQuorumContract(stub, doc, signers, jac.Quorum()+1, stringset.New(holder))
 }
 
 // params[0] : account address (joint account only)
@@ -213,7 +275,7 @@ func accountHolderRemove(stub shim.ChaincodeStubInterface, params []string) peer
 
 	// contract
 	doc := []interface{}{"account/holder/remove", jac.GetID(), holder}
-	return invokeContract(stub, doc, signers)
+	return invokeContract(stub, doc, signers, jac.Quorum())
 }
 
 // list of account's addresses
@@ -265,6 +327,121 @@ func accountList(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	return shim.Success(data)
 }
 
+// params[0] : account address (joint account only)
+// params[1] : threshold (M of M-of-N, 0 = all holders)
+func accountThresholdSet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	addr, err := ParseAddress(params[0])
+	if err != nil {
+		return responseError(err, "failed to parse the account address")
+	}
+	if addr.Type != AccountTypeJoint {
+		return shim.Error("the account must be joint account")
+	}
+	threshold, err := strconv.Atoi(params[1])
+	if err != nil {
+		return shim.Error("invalid threshold")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the account")
+	}
+	jac := account.(*JointAccount)
+	if !jac.HasHolder(kid) {
+		return shim.Error("no authority")
+	}
+	if threshold < 0 || threshold > jac.Holders.Size() {
+		return shim.Error("invalid threshold")
+	}
+	if threshold == jac.Threshold {
+		return shim.Error("same threshold")
+	}
+
+	if jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"account/threshold/set", jac.GetID(), threshold}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	if jac, err = ab.SetThreshold(jac, threshold); err != nil {
+		return responseError(err, "failed to set the threshold")
+	}
+	data, err := json.Marshal(jac)
+	if err != nil {
+		return responseError(err, "failed to marshal the account")
+	}
+	return shim.Success(data)
+}
+
+// incoming transfers are written as balance deltas (conflict-free receiving for hot accounts)
+// params[0] : token code | account address
+// params[1] : delta receiving flag (true | false)
+func accountDeltaSet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	deltaReceive, err := strconv.ParseBool(params[1])
+	if err != nil {
+		return shim.Error("invalid delta receiving flag")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("no authority")
+	}
+	if account.IsDeltaReceiving() == deltaReceive {
+		return shim.Error("same delta receiving flag")
+	}
+
+	if jac, ok := account.(*JointAccount); ok && jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"account/delta/set", jac.GetID(), deltaReceive}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	if account, err = ab.SetDeltaReceive(account, deltaReceive); err != nil {
+		return responseError(err, "failed to set the delta receiving flag")
+	}
+	data, err := json.Marshal(account)
+	if err != nil {
+		return responseError(err, "failed to marshal the account")
+	}
+	return shim.Success(data)
+}
+
 // ISSUE: more complex suspend/unsuspend ? (ex, joint account, admin ...)
 // suspend personal(main) account of the token
 // params[0] : token code
@@ -328,8 +505,157 @@ func accountUnsuspend(stub shim.ChaincodeStubInterface, params []string) peer.Re
 	return shim.Success(data)
 }
 
+// freeze the account by the token authority (genesis account holders)
+// params[0] : account address
+// params[1] : reason code (see MemoMaxLength)
+func accountFreeze(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+	if len(params[1]) == 0 {
+		return shim.Error("reason code is required")
+	}
+
+	return setAccountFrozen(stub, params[0], true, params[1])
+}
+
+// history of freeze/unfreeze
+// params[0] : account address
+// params[1] : bookmark
+// params[2] : fetch size (if < 1 => default size, max 200)
+func accountFreezeLogs(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	// authentication
+	_, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	addr, err := ParseAddress(params[0])
+	if err != nil {
+		return responseError(err, "failed to parse the account address")
+	}
+
+	bookmark := ""
+	fetchSize := 0
+	if len(params) > 1 {
+		bookmark = params[1]
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	res, err := NewAccountStub(stub, addr.Code).GetQueryFreezeLogs(addr.String(), bookmark, fetchSize)
+	if err != nil {
+		return responseError(err, "failed to get freeze logs")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal freeze logs")
+	}
+	return shim.Success(data)
+}
+
+// unfreeze the account by the token authority (genesis account holders)
+// params[0] : account address
+// params[1] : optional. reason (see MemoMaxLength)
+func accountUnfreeze(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	reason := ""
+	if len(params) > 1 {
+		reason = params[1]
+	}
+	return setAccountFrozen(stub, params[0], false, reason)
+}
+
 // helpers
 
+// setAccountFrozen freezes(unfreezes) the account or creates a contract. (genesis account holders only)
+func setAccountFrozen(stub shim.ChaincodeStubInterface, address string, frozen bool, reason string) peer.Response {
+	if len(reason) > MemoMaxLength { // length limit
+		reason = reason[:MemoMaxLength]
+	}
+
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return responseError(err, "failed to parse the account address")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// token
+	token, err := NewTokenStub(stub).GetToken(addr.Code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+	if token.GenesisAccount == addr.String() {
+		return shim.Error("can't freeze the genesis account")
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+
+	// account
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the account")
+	}
+	if account.IsFrozen() == frozen {
+		if frozen {
+			return shim.Error("already frozen")
+		}
+		return shim.Error("not frozen")
+	}
+
+	// genesis account
+	gAddr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := ab.GetAccount(gAddr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !genesis.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+
+	jac := genesis.(*JointAccount)
+	if jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"account/unfreeze", account.GetID(), reason}
+		if frozen {
+			doc[0] = "account/freeze"
+		}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	if frozen {
+		account, err = ab.FreezeAccount(account, reason, kid)
+	} else {
+		account, err = ab.UnfreezeAccount(account, reason, kid)
+	}
+	if err != nil {
+		return responseError(err, "failed to update the account")
+	}
+
+	data, err := json.Marshal(account)
+	if err != nil {
+		return responseError(err, "failed to marshal the account")
+	}
+	return shim.Success(data)
+}
+
 func getValidatedAccountHolderParameters(stub shim.ChaincodeStubInterface, params []string) (*JointAccount, *Address, error) {
 	if len(params) != 2 {
 		return nil, nil, errors.New("incorrect number of parameters. expecting 2")
@@ -403,9 +729,24 @@ func responseAccountWithBalanceState(account AccountInterface, balance []byte) p
 	return responseError(err, "failed to marshal the payload")
 }
 
+// appendBalanceDeltaSum adds the unmerged balance deltas and the effective amount (amount + deltas) to the balance state.
+func appendBalanceDeltaSum(balance []byte, ds *BalanceDeltaSum) ([]byte, error) {
+	bal := &Balance{}
+	if err := json.Unmarshal(balance, bal); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the balance")
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(balance, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the balance")
+	}
+	doc["delta"] = ds
+	doc["effective_amount"] = bal.Amount.Add(ds.Sum)
+	return json.Marshal(doc)
+}
+
 // contract callbacks
 
-// doc: ["account/create", code, [co-holders...]]
+// doc: ["account/create", code, [co-holders...], threshold, creator-address]
 func executeAccountCreate(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
 	if len(doc) < 3 {
 		return shim.Error("invalid contract document")
@@ -417,12 +758,39 @@ func executeAccountCreate(stub shim.ChaincodeStubInterface, cid string, doc []in
 	for _, kid := range kids {
 		holders.Add(kid.(string))
 	}
+	threshold := 0
+	if len(doc) > 3 { // JSON number
+		threshold = int(doc[3].(float64))
+	}
 
 	ab := NewAccountStub(stub, code)
-	if _, _, err := ab.CreateJointAccount(holders); err != nil {
+	account, _, err := ab.CreateJointAccount(holders, threshold)
+	if err != nil {
 		return responseError(err, "failed to create a joint account")
 	}
 
+	// fee of the creator
+	if len(doc) > 4 {
+		if _, err = NewTokenStub(stub).GetTokenState(code); err == nil { // issued
+			pAddr, err := ParseAddress(doc[4].(string))
+			if err != nil {
+				return responseError(err, "failed to parse the creator's account address")
+			}
+			fee, err := NewFeeStub(stub).CalcFee(pAddr, "account/create", *ZeroAmount())
+			if err != nil {
+				return responseError(err, "failed to get the fee amount")
+			}
+			bb := NewBalanceStub(stub)
+			bal, err := bb.GetBalance(pAddr.String())
+			if err != nil {
+				return responseError(err, "failed to get the creator's balance")
+			}
+			if _, err = bb.ChargeFee(bal, *fee, account.GetID(), "account/create"); err != nil {
+				return responseError(err, "failed to charge the fee")
+			}
+		}
+	}
+
 	return shim.Success(nil)
 }
 
@@ -493,3 +861,101 @@ func executeAccountHolderRemove(stub shim.ChaincodeStubInterface, cid string, do
 
 	return shim.Success(nil)
 }
+
+// doc: ["account/threshold/set", address, threshold]
+func executeAccountThresholdSet(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 3 {
+		return shim.Error("invalid contract document")
+	}
+
+	addr, err := ParseAddress(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to set the threshold")
+	}
+	threshold := int(doc[2].(float64)) // JSON number
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to set the threshold")
+	}
+	jac := account.(*JointAccount)
+
+	if _, err = ab.SetThreshold(jac, threshold); err != nil {
+		return responseError(err, "failed to set the threshold")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["account/freeze", address, reason]
+func executeAccountFreeze(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 3 {
+		return shim.Error("invalid contract document")
+	}
+
+	addr, err := ParseAddress(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to freeze the account")
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to freeze the account")
+	}
+
+	if _, err = ab.FreezeAccount(account, doc[2].(string), cid); err != nil {
+		return responseError(err, "failed to freeze the account")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["account/unfreeze", address, reason]
+func executeAccountUnfreeze(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 3 {
+		return shim.Error("invalid contract document")
+	}
+
+	addr, err := ParseAddress(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to unfreeze the account")
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to unfreeze the account")
+	}
+
+	if _, err = ab.UnfreezeAccount(account, doc[2].(string), cid); err != nil {
+		return responseError(err, "failed to unfreeze the account")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["account/delta/set", address, delta-receiving-flag]
+func executeAccountDeltaSet(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 3 {
+		return shim.Error("invalid contract document")
+	}
+
+	addr, err := ParseAddress(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to set the delta receiving flag")
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+	account, err := ab.GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to set the delta receiving flag")
+	}
+
+	if _, err = ab.SetDeltaReceive(account, doc[2].(bool)); err != nil {
+		return responseError(err, "failed to set the delta receiving flag")
+	}
+
+	return shim.Success(nil)
+}
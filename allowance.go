@@ -0,0 +1,33 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// Allowance is the amount that the spender can transfer from the owner's balance.
+type Allowance struct {
+	DOCTYPEID   string       `json:"@allowance"` // owner address
+	Spender     string       `json:"spender"`    // spender address
+	Amount      Amount       `json:"amount"`     // remaining amount (fee included)
+	ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// GetID implements Identifiable
+func (a *Allowance) GetID() string {
+	return a.DOCTYPEID
+}
+
+// IsExpired _
+func (a *Allowance) IsExpired(ts *txtime.Time) bool {
+	return a.ExpiryTime != nil && a.ExpiryTime.Cmp(ts) <= 0
+}
+
+// AllowanceResult is response payload of transfer/from.
+type AllowanceResult struct {
+	Allowance  *Allowance  `json:"allowance"`
+	BalanceLog *BalanceLog `json:"balance_log"`
+}
@@ -0,0 +1,120 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// AllowanceStub _
+type AllowanceStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewAllowanceStub _
+func NewAllowanceStub(stub shim.ChaincodeStubInterface) *AllowanceStub {
+	return &AllowanceStub{stub}
+}
+
+// CreateKey _
+func (alb *AllowanceStub) CreateKey(owner, spender string) string {
+	return fmt.Sprintf("ALW_%s_%s", owner, spender)
+}
+
+// GetAllowance _
+func (alb *AllowanceStub) GetAllowance(owner, spender string) (*Allowance, error) {
+	data, err := alb.GetAllowanceState(owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	// data is not nil
+	allowance := &Allowance{}
+	if err = json.Unmarshal(data, allowance); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the allowance")
+	}
+	return allowance, nil
+}
+
+// GetAllowanceState _
+func (alb *AllowanceStub) GetAllowanceState(owner, spender string) ([]byte, error) {
+	data, err := alb.stub.GetState(alb.CreateKey(owner, spender))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the allowance state")
+	}
+	if data != nil {
+		return data, nil
+	}
+	return nil, NotExistedAllowanceError{owner: owner, spender: spender}
+}
+
+// PutAllowance _
+func (alb *AllowanceStub) PutAllowance(allowance *Allowance) error {
+	data, err := json.Marshal(allowance)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the allowance")
+	}
+	if err = alb.stub.PutState(alb.CreateKey(allowance.DOCTYPEID, allowance.Spender), data); err != nil {
+		return errors.Wrap(err, "failed to put the allowance state")
+	}
+	return nil
+}
+
+// Approve sets(overwrites) the allowance of the spender.
+func (alb *AllowanceStub) Approve(owner, spender string, amount Amount, expiryTime *txtime.Time) (*Allowance, error) {
+	ts, err := txtime.GetTime(alb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	allowance, err := alb.GetAllowance(owner, spender)
+	if err != nil {
+		if _, ok := err.(NotExistedAllowanceError); !ok {
+			return nil, err
+		}
+		allowance = &Allowance{
+			DOCTYPEID:   owner,
+			Spender:     spender,
+			CreatedTime: ts,
+		}
+	}
+	allowance.Amount = amount
+	allowance.ExpiryTime = expiryTime
+	allowance.UpdatedTime = ts
+	if err = alb.PutAllowance(allowance); err != nil {
+		return nil, err
+	}
+	return allowance, nil
+}
+
+// Revoke removes the allowance of the spender.
+func (alb *AllowanceStub) Revoke(owner, spender string) error {
+	if _, err := alb.GetAllowanceState(owner, spender); err != nil {
+		return err
+	}
+	if err := alb.stub.DelState(alb.CreateKey(owner, spender)); err != nil {
+		return errors.Wrap(err, "failed to delete the allowance")
+	}
+	return nil
+}
+
+// TransferFrom transfers the amount from the owner's balance and consumes the allowance. (amount + fee)
+func (alb *AllowanceStub) TransferFrom(allowance *Allowance, owner, receiver *Balance, amount, fee Amount, memo string) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(alb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	applied := amount.Copy().Add(&fee)
+	allowance.Amount.Add(applied.Neg())
+	allowance.UpdatedTime = ts
+	if err = alb.PutAllowance(allowance); err != nil {
+		return nil, err
+	}
+
+	return NewBalanceStub(alb.stub).Transfer(owner, receiver, amount, fee, memo, nil, false)
+}
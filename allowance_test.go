@@ -0,0 +1,58 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestAllowanceTransferFrom(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	customer := h.newKID("customer")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(customer, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	customerAddr := testAccountAddr("PCI", customer)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, customerAddr, "1000")
+
+	if res := h.invokeAs(merchant, "transfer/from", customerAddr, merchantAddr, "100"); res.Status == shim.OK {
+		t.Fatal("transfer/from must fail without allowance")
+	}
+
+	h.mustInvokeAs(customer, "allowance/approve", "", merchantAddr, "202", "3600")
+
+	// 100 + 1 (fee)
+	data := h.mustInvokeAs(merchant, "transfer/from", customerAddr, merchantAddr, "100", "subscription")
+	result := &AllowanceResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowance.Amount.String() != "101" || result.BalanceLog.Fee.String() != "1" {
+		t.Fatalf("unexpected result: %s", data)
+	}
+	assertBalance(t, h, customerAddr, "899")
+	assertBalance(t, h, merchantAddr, "100")
+
+	if res := h.invokeAs(merchant, "transfer/from", customerAddr, merchantAddr, "101"); res.Status == shim.OK {
+		t.Fatal("transfer/from must not exceed the allowance")
+	}
+	if res := h.invokeAs(customer, "transfer/from", customerAddr, merchantAddr, "1", "", merchantAddr); res.Status == shim.OK {
+		t.Fatal("transfer/from must be invoked by a holder of the spender")
+	}
+
+	h.mustInvokeAs(customer, "allowance/revoke", "", merchantAddr)
+	if res := h.invokeAs(merchant, "transfer/from", customerAddr, merchantAddr, "1"); res.Status == shim.OK {
+		t.Fatal("transfer/from must fail after revoke")
+	}
+	assertBalance(t, h, customerAddr, "899")
+}
@@ -0,0 +1,363 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// params[0] : owner address (empty string = personal account)
+// params[1] : spender address
+// params[2] : amount (big int string, fee included)
+// params[3] : optional. expiry (duration represented by int64 seconds, 0 = no expiry)
+func allowanceApprove(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 3 {
+		return shim.Error("incorrect number of parameters. expecting 3+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// amount
+	amount, err := NewAmount(params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	// addresses
+	spAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the spender's account address")
+	}
+	var oAddr *Address
+	if len(params[0]) > 0 {
+		oAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the owner's account address")
+		}
+		if spAddr.Code != oAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		oAddr = NewAddress(spAddr.Code, AccountTypePersonal, kid)
+	}
+	if oAddr.Equal(spAddr) {
+		return shim.Error("can't approve to self")
+	}
+
+	ab := NewAccountStub(stub, spAddr.Code)
+
+	// owner
+	owner, err := ab.GetAccount(oAddr)
+	if err != nil {
+		return responseError(err, "failed to get the owner account")
+	}
+	if !owner.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if owner.IsSuspended() {
+		return shim.Error("the owner account is suspended")
+	}
+
+	// spender
+	if _, err = ab.GetAccount(spAddr); err != nil {
+		return responseError(err, "failed to get the spender account")
+	}
+
+	// expiry
+	var expiryTime *txtime.Time
+	if len(params) > 3 && len(params[3]) > 0 {
+		expiry, err := strconv.ParseInt(params[3], 10, 64)
+		if err != nil || expiry < 0 {
+			return shim.Error("invalid expiry: need seconds")
+		}
+		if expiry > 0 {
+			ts, err := txtime.GetTime(stub)
+			if err != nil {
+				return responseError(err, "failed to get the timestamp")
+			}
+			expiryTime = txtime.Unix(ts.Unix()+expiry, 0)
+		}
+	}
+
+	if jac, ok := owner.(*JointAccount); ok && jac.Quorum() > 1 {
+		etStr := "0"
+		if expiryTime != nil {
+			etStr = strconv.FormatInt(expiryTime.Unix(), 10)
+		}
+		// contract
+		doc := []interface{}{"allowance/approve", owner.GetID(), spAddr.String(), amount.String(), etStr}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	allowance, err := NewAllowanceStub(stub).Approve(owner.GetID(), spAddr.String(), *amount, expiryTime)
+	if err != nil {
+		return responseError(err, "failed to approve")
+	}
+
+	data, err := json.Marshal(allowance)
+	if err != nil {
+		return responseError(err, "failed to marshal the allowance")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : owner address
+// params[1] : spender address
+func allowanceGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	// authentication
+	if _, err := kid.GetID(stub, false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	oAddr, err := ParseAddress(params[0])
+	if err != nil {
+		return responseError(err, "failed to parse the owner's account address")
+	}
+	spAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the spender's account address")
+	}
+
+	data, err := NewAllowanceStub(stub).GetAllowanceState(oAddr.String(), spAddr.String())
+	if err != nil {
+		return responseError(err, "failed to get the allowance")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : owner address (empty string = personal account)
+// params[1] : spender address
+func allowanceRevoke(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	spAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the spender's account address")
+	}
+	var oAddr *Address
+	if len(params[0]) > 0 {
+		oAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the owner's account address")
+		}
+	} else {
+		oAddr = NewAddress(spAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// owner
+	owner, err := NewAccountStub(stub, oAddr.Code).GetAccount(oAddr)
+	if err != nil {
+		return responseError(err, "failed to get the owner account")
+	}
+	if !owner.HasHolder(kid) { // any holder can revoke
+		return shim.Error("invoker is not holder")
+	}
+
+	if err = NewAllowanceStub(stub).Revoke(owner.GetID(), spAddr.String()); err != nil {
+		return responseError(err, "failed to revoke the allowance")
+	}
+
+	return shim.Success(nil)
+}
+
+// params[0] : owner address
+// params[1] : receiver address
+// params[2] : amount (big int string or decimal string)
+// params[3] : optional. memo (see MemoMaxLength)
+// params[4] : optional. spender address (empty string = personal account)
+func transferFrom(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 3 {
+		return shim.Error("incorrect number of parameters. expecting 3+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// addresses
+	oAddr, err := ParseAddress(params[0])
+	if err != nil {
+		return responseError(err, "failed to parse the owner's account address")
+	}
+	rAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the receiver's account address")
+	}
+	if rAddr.Code != oAddr.Code { // not same token
+		return shim.Error("different token accounts")
+	}
+	if oAddr.Equal(rAddr) {
+		return shim.Error("can't transfer to self")
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(oAddr.Code); err != nil {
+		return responseError(err, "failed to transfer")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(oAddr.Code, params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+	var spAddr *Address
+	if len(params) > 4 && len(params[4]) > 0 {
+		spAddr, err = ParseAddress(params[4])
+		if err != nil {
+			return responseError(err, "failed to parse the spender's account address")
+		}
+	} else {
+		spAddr = NewAddress(oAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// memo
+	memo := ""
+	if len(params) > 3 {
+		if len(params[3]) > MemoMaxLength { // length limit
+			memo = params[3][:MemoMaxLength]
+		} else {
+			memo = params[3]
+		}
+	}
+
+	ab := NewAccountStub(stub, oAddr.Code)
+
+	// spender
+	spender, err := ab.GetAccount(spAddr)
+	if err != nil {
+		return responseError(err, "failed to get the spender account")
+	}
+	if !spender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if spender.IsSuspended() {
+		return shim.Error("the spender account is suspended")
+	}
+
+	// owner
+	owner, err := ab.GetAccount(oAddr)
+	if err != nil {
+		return responseError(err, "failed to get the owner account")
+	}
+	if owner.IsSuspended() {
+		return shim.Error("the owner account is suspended")
+	}
+
+	// receiver
+	receiver, err := ab.GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the receiver account")
+	}
+	if receiver.IsSuspended() {
+		return shim.Error("the receiver account is suspended")
+	}
+
+	// allowance
+	alb := NewAllowanceStub(stub)
+	allowance, err := alb.GetAllowance(owner.GetID(), spender.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the allowance")
+	}
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+	if allowance.IsExpired(ts) {
+		return shim.Error("the allowance is expired")
+	}
+
+	// fee (charged to the owner)
+	fee, err := NewFeeStub(stub).CalcFee(oAddr, "transfer", *amount)
+	if err != nil {
+		return responseError(err, "failed to get the fee amount")
+	}
+	// fee is not nil
+	applied := amount.Copy().Add(fee)
+	if allowance.Amount.Cmp(applied) < 0 {
+		return shim.Error("not enough allowance")
+	}
+
+	// balances
+	bb := NewBalanceStub(stub)
+	oBal, err := bb.GetBalance(owner.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the owner's balance")
+	}
+	if oBal.Amount.Cmp(applied) < 0 {
+		return shim.Error("not enough balance")
+	}
+	rBal, err := bb.GetReceiverBalance(receiver)
+	if err != nil {
+		return responseError(err, "failed to get the receiver's balance")
+	}
+
+	log, err := alb.TransferFrom(allowance, oBal, rBal, *amount, *fee, memo)
+	if err != nil {
+		return responseError(err, "failed to transfer")
+	}
+
+	data, err := json.Marshal(&AllowanceResult{Allowance: allowance, BalanceLog: log})
+	if err != nil {
+		return responseError(err, "failed to marshal the payload")
+	}
+	return shim.Success(data)
+}
+
+// contract callbacks
+
+// doc: ["allowance/approve", owner-ID, spender-ID, amount, expiry-time]
+func executeAllowanceApprove(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 5 {
+		return shim.Error("invalid contract document")
+	}
+
+	amount, err := NewAmount(doc[3].(string))
+	if err != nil {
+		return shim.Error("invalid amount")
+	}
+	var expiryTime *txtime.Time
+	if etStr := doc[4].(string); etStr != "" && etStr != "0" {
+		seconds, err := strconv.ParseInt(etStr, 10, 64)
+		if err != nil {
+			return shim.Error("invalid expiry time")
+		}
+		expiryTime = txtime.Unix(seconds, 0)
+	}
+
+	if _, err = NewAllowanceStub(stub).Approve(doc[1].(string), doc[2].(string), *amount, expiryTime); err != nil {
+		return responseError(err, "failed to approve")
+	}
+
+	return shim.Success(nil)
+}
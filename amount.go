@@ -5,6 +5,7 @@ package main
 import (
 	"bytes"
 	"math/big"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -25,6 +26,31 @@ func NewAmount(val string) (*Amount, error) {
 	return a, nil
 }
 
+// NewAmountWithDecimal parses the decimal string (e.g. "12.345" or "12") scaled by the decimal.
+func NewAmountWithDecimal(val string, decimal int) (*Amount, error) {
+	ip, fp := val, ""
+	if i := strings.IndexByte(val, '.'); i >= 0 {
+		ip, fp = val[:i], val[i+1:]
+		if len(fp) == 0 {
+			return nil, errors.New("invalid amount value: must be decimal")
+		}
+	}
+	if strings.Trim(fp, "0123456789") != "" {
+		return nil, errors.New("invalid amount value: must be decimal")
+	}
+	if len(fp) > decimal {
+		return nil, errors.Errorf("invalid amount value: max %d decimal places", decimal)
+	}
+	if ip == "" || ip == "-" || ip == "+" {
+		ip += "0"
+	}
+	a := &Amount{}
+	if _, ok := a.SetString(ip+fp+strings.Repeat("0", decimal-len(fp)), 10); !ok {
+		return nil, errors.New("invalid amount value: must be decimal")
+	}
+	return a, nil
+}
+
 // NewAmountWithBigInt _
 func NewAmountWithBigInt(bigInt *big.Int) *Amount {
 	return &Amount{Int: *bigInt}
@@ -65,6 +91,22 @@ func (a *Amount) MulRat(r *big.Rat) *Amount {
 	return a
 }
 
+// Format returns the decimal string scaled by the decimal. (e.g. "12.345000")
+func (a *Amount) Format(decimal int) string {
+	if decimal <= 0 {
+		return a.String()
+	}
+	s := new(big.Int).Abs(&a.Int).String()
+	if len(s) <= decimal { // leading zeros
+		s = strings.Repeat("0", decimal-len(s)+1) + s
+	}
+	i := len(s) - decimal
+	if a.Sign() < 0 {
+		return "-" + s[:i] + "." + s[i:]
+	}
+	return s[:i] + "." + s[i:]
+}
+
 // MarshalJSON override
 func (a *Amount) MarshalJSON() ([]byte, error) {
 	buf := bytes.NewBuffer([]byte{'"'})
@@ -81,3 +123,21 @@ func (a *Amount) MarshalJSON() ([]byte, error) {
 func (a *Amount) UnmarshalJSON(text []byte) error {
 	return a.Int.UnmarshalJSON(text[1 : len(text)-1])
 }
+
+// FormattedAmountFields are the amount fields of JSON documents (balance, balance log, pay, ...)
+var FormattedAmountFields = []string{"amount", "diff", "fee", "total_refund", "effective_amount"}
+
+// AppendFormattedAmounts adds the 'formatted' object, which has decimal strings of the amount fields, to the JSON document.
+func AppendFormattedAmounts(doc map[string]interface{}, decimal int) {
+	formatted := map[string]string{}
+	for _, field := range FormattedAmountFields {
+		if s, ok := doc[field].(string); ok {
+			if a, err := NewAmount(s); nil == err {
+				formatted[field] = a.Format(decimal)
+			}
+		}
+	}
+	if len(formatted) > 0 {
+		doc["formatted"] = formatted
+	}
+}
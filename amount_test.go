@@ -0,0 +1,126 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestNewAmountWithDecimal(t *testing.T) {
+	valid := map[string]string{
+		"12":     "12000",
+		"12.345": "12345",
+		"12.3":   "12300",
+		"0.001":  "1",
+		".5":     "500",
+		"-1.5":   "-1500",
+	}
+	for val, expected := range valid {
+		a, err := NewAmountWithDecimal(val, 3)
+		if err != nil {
+			t.Fatalf("%s: %s", val, err)
+		}
+		if a.String() != expected {
+			t.Fatalf("%s: expected %s, got %s", val, expected, a.String())
+		}
+	}
+	for _, val := range []string{"1.2345", "1.", "1.2.3", "1.-2", "a.1", "."} {
+		if _, err := NewAmountWithDecimal(val, 3); err == nil {
+			t.Fatalf("%s must be invalid", val)
+		}
+	}
+	if _, err := NewAmountWithDecimal("1.5", 0); err == nil {
+		t.Fatal("decimal places must be rejected if the token decimal is 0")
+	}
+}
+
+func TestAmountFormat(t *testing.T) {
+	cases := map[string]string{
+		"12345": "12.345",
+		"1":     "0.001",
+		"0":     "0.000",
+		"-1500": "-1.500",
+	}
+	for val, expected := range cases {
+		a, _ := NewAmount(val)
+		if f := a.Format(3); f != expected {
+			t.Fatalf("%s: expected %s, got %s", val, expected, f)
+		}
+	}
+	a, _ := NewAmount("12345")
+	if f := a.Format(0); f != "12345" {
+		t.Fatalf("unexpected format: %s", f)
+	}
+}
+
+func TestDecimalAmounts(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", map[string]string{
+		"decimal":        "3",
+		"max_supply":     "1000000000",
+		"initial_supply": "10000000",
+		"fee":            "transfer=0.01",
+	})
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+
+	decimal := map[string][]byte{DecimalTransientKey: []byte("true")}
+	if res := h.invokeWithTransient(issuer, decimal, "transfer", genesis, aliceAddr, "100.5"); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "100500")
+	if res := h.invokeWithTransient(alice, decimal, "transfer", "", bobAddr, "1.2345"); res.Status == shim.OK {
+		t.Fatal("excess precision must be rejected")
+	}
+	if res := h.invokeAs(alice, "transfer", "", bobAddr, "1.0"); res.Status == shim.OK {
+		t.Fatal("decimal string must be rejected without the decimal flag")
+	}
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "10")
+	assertBalance(t, h, bobAddr, "10") // raw
+
+	// formatted
+	account := struct {
+		Balance struct {
+			Amount    string            `json:"amount"`
+			Formatted map[string]string `json:"formatted"`
+		} `json:"balance"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "account/get", "PCI", "true"), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance.Amount != "100490" || account.Balance.Formatted["amount"] != "100.490" {
+		t.Fatalf("unexpected balance: %+v", account.Balance)
+	}
+
+	logs := struct {
+		Records []map[string]interface{} `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "balance/logs", "PCI", "", "", "0", "", "", "true"), &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.Records) != 2 {
+		t.Fatalf("unexpected logs: %v", logs.Records)
+	}
+	formatted := logs.Records[0]["formatted"].(map[string]interface{})
+	if formatted["diff"] != "-0.010" || formatted["amount"] != "100.490" {
+		t.Fatalf("unexpected formatted amounts: %v", formatted)
+	}
+
+	// an integer string is scaled too with the decimal flag
+	if res := h.invokeWithTransient(alice, decimal, "transfer", "", bobAddr, "10"); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, bobAddr, "10010") // decimal
+}
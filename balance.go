@@ -14,6 +14,9 @@ type Balance struct {
 	CreatedTime     *txtime.Time `json:"created_time,omitempty"`
 	UpdatedTime     *txtime.Time `json:"updated_time,omitempty"`
 	LastPrunedPayID string       `json:"last_pruned_pay_id,omitempty"`
+	Token           string       `json:"token,omitempty"`  // token code (see token/holders)
+	Digits          int          `json:"digits,omitempty"` // number of digits of the positive amount, sorts amount strings numerically. 0 = not funded
+	delta           bool         // proxy of the delta receiving account (see BalanceStub.GetReceiverBalance)
 }
 
 // GetID implements Identifiable
@@ -45,6 +48,28 @@ const (
 	BalanceLogTypePrunePay
 	// BalanceLogTypePruneFee is created when fee utxos are pruned to genesis account.
 	BalanceLogTypePruneFee
+	// BalanceLogTypeSendBatch send to multiple receivers (transfer/batch)
+	BalanceLogTypeSendBatch
+	// BalanceLogTypeMergeDelta the amount of merged balance deltas
+	BalanceLogTypeMergeDelta
+	// BalanceLogTypeVestingLock lock amount of balance to vesting
+	BalanceLogTypeVestingLock
+	// BalanceLogTypeVestingClaim claim vested amount
+	BalanceLogTypeVestingClaim
+	// BalanceLogTypeVestingRevoke return unvested amount to the sender
+	BalanceLogTypeVestingRevoke
+	// BalanceLogTypeHTLCLock lock amount of balance to HTLC
+	BalanceLogTypeHTLCLock
+	// BalanceLogTypeHTLCClaim claim HTLC with the preimage
+	BalanceLogTypeHTLCClaim
+	// BalanceLogTypeHTLCRefund refund HTLC after the time lock
+	BalanceLogTypeHTLCRefund
+	// BalanceLogTypeFee fee of the operation which doesn't move the balance (e.g. joint account creation)
+	BalanceLogTypeFee
+	// BalanceLogTypeCancelPending the sender pulls back the cancellable time-locked transfer
+	BalanceLogTypeCancelPending
+	// BalanceLogTypeReceiveDelta receive to the balance delta (delta receiving account). The balance is not changed until the merge.
+	BalanceLogTypeReceiveDelta
 )
 
 // BalanceLog _
@@ -60,6 +85,7 @@ type BalanceLog struct {
 	PruneStartID string         `json:"prune_start_id,omitempty"` // used for pruned balance log
 	PruneEndID   string         `json:"prune_end_id,omitempty"`   // used for pruned balance log
 	PayID        string         `json:"pay_id,omitempty"`         // used for pay balance log
+	FeeExempt    bool           `json:"fee_exempt,omitempty"`     // response only. true if the fee exemption is applied
 }
 
 // MemoMaxLength is used to limit memo field length (BalanceLog, PendingBalance, Pay)
@@ -106,6 +132,19 @@ func NewBalanceTransferLog(sender, receiver *Balance, diff Amount, fee *Amount,
 	}
 }
 
+// NewBalanceSendBatchLog _
+// rid is the batch ID (txid or pending balance ID)
+func NewBalanceSendBatchLog(sender *Balance, rid string, diff Amount, fee *Amount) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID: sender.DOCTYPEID,
+		Type:      BalanceLogTypeSendBatch,
+		RID:       rid,
+		Diff:      diff,
+		Fee:       fee,
+		Amount:    sender.Amount,
+	}
+}
+
 // NewBalanceDepositLog _
 func NewBalanceDepositLog(bal *Balance, pb *PendingBalance) *BalanceLog {
 	diff := pb.Amount.Copy().Neg()
@@ -188,6 +227,88 @@ func NewBalancePruneFeeLog(bal *Balance, amount Amount, Start, End string) *Bala
 	}
 }
 
+// NewBalanceMergeDeltaLog No need RID
+func NewBalanceMergeDeltaLog(bal *Balance, amount Amount, Start, End string) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID:    bal.DOCTYPEID,
+		Type:         BalanceLogTypeMergeDelta,
+		Diff:         amount,
+		Amount:       bal.Amount,
+		PruneStartID: Start,
+		PruneEndID:   End,
+	}
+}
+
+// NewBalanceReceiveDeltaLog creates the receiver log of the balance delta.
+// The amount is not the balance (the balance is not read), and the merge log has the changed balance.
+// PruneStartID and PruneEndID are the delta ID, so the log is in the range of the merge log.
+func NewBalanceReceiveDeltaLog(delta *BalanceDelta) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID:    delta.DOCTYPEID,
+		Type:         BalanceLogTypeReceiveDelta,
+		RID:          delta.RID,
+		Diff:         delta.Amount,
+		Memo:         delta.Memo,
+		PruneStartID: delta.DeltaID,
+		PruneEndID:   delta.DeltaID,
+	}
+}
+
+// NewBalanceVestingLog creates the balance log of the vesting. (lock, claim or revoke)
+// RID is the vesting ID.
+func NewBalanceVestingLog(bal *Balance, logType BalanceLogType, v *Vesting, diff Amount, fee *Amount) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID: bal.DOCTYPEID,
+		Type:      logType,
+		RID:       v.DOCTYPEID,
+		Diff:      diff,
+		Fee:       fee,
+		Amount:    bal.Amount,
+		Memo:      v.Memo,
+	}
+}
+
+// NewBalanceHTLCLog creates the balance log of the HTLC. (lock, claim or refund)
+// RID is the HTLC ID.
+func NewBalanceHTLCLog(bal *Balance, logType BalanceLogType, htlc *HTLC, diff Amount, fee *Amount) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID: bal.DOCTYPEID,
+		Type:      logType,
+		RID:       htlc.DOCTYPEID,
+		Diff:      diff,
+		Fee:       fee,
+		Amount:    bal.Amount,
+		Memo:      htlc.Memo,
+	}
+}
+
+// NewBalanceCancelPendingLog creates the balance log of the cancelled time-locked transfer.
+// RID is the receiver of the pending balance.
+func NewBalanceCancelPendingLog(bal *Balance, pb *PendingBalance) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID: bal.DOCTYPEID,
+		Type:      BalanceLogTypeCancelPending,
+		RID:       pb.Account,
+		Diff:      pb.Amount,
+		Amount:    bal.Amount,
+		Memo:      pb.Memo,
+	}
+}
+
+// NewBalanceFeeLog creates the balance log of the fee charged by the fn.
+// RID is the relative ID of the operation. (e.g. the created account)
+func NewBalanceFeeLog(bal *Balance, fee Amount, rid, fn string) *BalanceLog {
+	return &BalanceLog{
+		DOCTYPEID: bal.DOCTYPEID,
+		Type:      BalanceLogTypeFee,
+		RID:       rid,
+		Diff:      *fee.Copy().Neg(),
+		Fee:       &fee,
+		Amount:    bal.Amount,
+		Memo:      fn,
+	}
+}
+
 // PendingBalanceType _
 type PendingBalanceType int8
 
@@ -198,6 +319,9 @@ const (
 	PendingBalanceTypeContract
 )
 
+// CancellableTransientKey is the transient key of the flag that the time-locked transfer is cancellable. ("true")
+const CancellableTransientKey = "cancellable"
+
 // PendingBalance _
 type PendingBalance struct {
 	DOCTYPEID   string             `json:"@pending_balance"` // id
@@ -209,6 +333,28 @@ type PendingBalance struct {
 	Memo        string             `json:"memo"`
 	CreatedTime *txtime.Time       `json:"created_time,omitempty"`
 	PendingTime *txtime.Time       `json:"pending_time,omitempty"`
+	Cancellable bool               `json:"cancellable,omitempty"` // the sender can cancel it before the pending time
+}
+
+// RemovedPendingBalance is the pending balance which is withdrawn, cancelled, paid or transferred.
+// It is kept to answer the pending amount at the past time. (see balance/at)
+type RemovedPendingBalance struct {
+	DOCTYPEID   string       `json:"@removed_pending_balance"` // pending balance id
+	Account     string       `json:"account"`
+	Amount      Amount       `json:"amount"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	RemovedTime *txtime.Time `json:"removed_time,omitempty"`
+}
+
+// NewRemovedPendingBalance _
+func NewRemovedPendingBalance(pb *PendingBalance, ts *txtime.Time) *RemovedPendingBalance {
+	return &RemovedPendingBalance{
+		DOCTYPEID:   pb.DOCTYPEID,
+		Account:     pb.Account,
+		Amount:      pb.Amount,
+		CreatedTime: pb.CreatedTime,
+		RemovedTime: ts,
+	}
 }
 
 // NewPendingBalance _
@@ -228,3 +374,55 @@ func NewPendingBalance(id string, owner Identifiable, rel Identifiable, amount A
 		PendingTime: pTime,
 	}
 }
+
+// TransferBatchMaxSize is the max number of entries of transfer/batch
+const TransferBatchMaxSize = 100
+
+// TransferBatchEntry is an entry of transfer/batch
+type TransferBatchEntry struct {
+	Receiver string  `json:"receiver"` // address
+	Amount   Amount  `json:"amount"`
+	Fee      *Amount `json:"fee,omitempty"`
+	Memo     string  `json:"memo,omitempty"`
+}
+
+// BalanceAt is the balance of the account at the specific time (balance/at)
+// Pending balances and unpruned pays are not included in the amount.
+type BalanceAt struct {
+	Address      string       `json:"address"`
+	Time         *txtime.Time `json:"time"`
+	Amount       Amount       `json:"amount"`        // amount of the last balance log at or before the time
+	Log          *BalanceLog  `json:"log,omitempty"` // the last balance log at or before the time
+	Pending      Amount       `json:"pending"`       // sum of pending balances created at or before the time and not removed at the time
+	PendingCount int          `json:"pending_count"` // count of the pending balances
+	UnprunedPay  *PaySum      `json:"unpruned_pay"`  // pays received at or before the time and not pruned at the time
+}
+
+// BalanceDelta is a receive UTXO of the delta receiving account.
+// Incoming transfers don't touch the receiver's balance, so they don't conflict with each other.
+// Deltas are merged into the balance by balance/merge.
+type BalanceDelta struct {
+	DOCTYPEID   string       `json:"@balance_delta"` // address
+	DeltaID     string       `json:"delta_id"`       // timestamp + txid
+	RID         string       `json:"rid"`            // sender address
+	Amount      Amount       `json:"amount"`
+	Memo        string       `json:"memo"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+}
+
+// BalanceReindexResult is response payload of balance/reindex.
+type BalanceReindexResult struct {
+	Token    string `json:"token"`
+	Scanned  int    `json:"scanned"`            // number of walked balances
+	Updated  int    `json:"updated"`            // number of balances which get the token and the digits
+	Bookmark string `json:"bookmark,omitempty"` // pass it to the next balance/reindex (empty if done)
+}
+
+// BalanceDeltaSum _
+type BalanceDeltaSum struct {
+	Sum     *Amount `json:"sum"`
+	Count   int     `json:"count"`
+	Start   string  `json:"start_id"`
+	End     string  `json:"end_id"`
+	HasMore bool    `json:"has_more"`
+}
@@ -18,6 +18,18 @@ const BalanceLogsFetchSize = 20
 // PendingBalancesFetchSize _
 const PendingBalancesFetchSize = 20
 
+// PendingBalanceSumMaxCount is max number of pending balances that the balance at the time can sum.
+const PendingBalanceSumMaxCount = 1000
+
+// HoldersFetchSize _
+const HoldersFetchSize = 20
+
+// BalanceReindexSize is number of balances that one reindex request can handle.
+const BalanceReindexSize = 200
+
+// BalanceDeltaMergeSize is number of balance deltas that one merge request can handle.
+const BalanceDeltaMergeSize = 900
+
 // BalanceStub _
 type BalanceStub struct {
 	stub shim.ChaincodeStubInterface
@@ -65,6 +77,16 @@ func (bb *BalanceStub) GetBalance(id string) (*Balance, error) {
 	return balance, nil
 }
 
+// GetReceiverBalance returns the balance to receive.
+// If the account is delta receiving, it returns a proxy without reading the balance state,
+// and the received amounts are written as balance deltas. (conflict-free)
+func (bb *BalanceStub) GetReceiverBalance(account AccountInterface) (*Balance, error) {
+	if account.IsDeltaReceiving() {
+		return &Balance{DOCTYPEID: account.GetID(), delta: true}, nil
+	}
+	return bb.GetBalance(account.GetID())
+}
+
 // GetBalanceState _
 func (bb *BalanceStub) GetBalanceState(id string) ([]byte, error) {
 	data, err := bb.stub.GetState(bb.CreateKey(id))
@@ -102,8 +124,100 @@ func (bb *BalanceStub) GetQueryBalanceLogs(id, typeStr, bookmark string, fetchSi
 	return NewQueryResult(meta, iter)
 }
 
-// PutBalance _
+// GetBalanceLogAt returns the last balance log created at or before the time.
+// Without the type, receive delta logs are skipped because their amount is not the balance.
+// If there is no log, it returns nil.
+func (bb *BalanceStub) GetBalanceLogAt(id, typeStr string, t *txtime.Time) (*BalanceLog, error) {
+	query := CreateQueryBalanceLogsByIDAtTime(id, typeStr, t)
+	iter, _, err := bb.stub.GetQueryResultWithPagination(query, 1, "")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	if !iter.HasNext() {
+		return nil, nil
+	}
+	kv, err := iter.Next()
+	if err != nil {
+		return nil, err
+	}
+	log := &BalanceLog{}
+	if err = json.Unmarshal(kv.Value, log); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the balance log")
+	}
+	return log, nil
+}
+
+// GetPendingBalanceSumAt returns the sum and the count of the pending balances at the time.
+// It counts the pending balances created at or before the time which still exist,
+// and the removed ones (withdrawn, cancelled, paid or transferred) removed after the time.
+// It fails if the count exceeds PendingBalanceSumMaxCount.
+func (bb *BalanceStub) GetPendingBalanceSumAt(addr string, t *txtime.Time) (*Amount, int, error) {
+	sum, _ := NewAmount("0")
+	cnt := 0
+
+	queries := []string{
+		CreateQueryPendingBalancesByAddressAtTime(addr, t),
+		CreateQueryRemovedPendingBalancesByAddressAtTime(addr, t),
+	}
+	for _, query := range queries {
+		// one more than the rest, to know it exceeds
+		iter, _, err := bb.stub.GetQueryResultWithPagination(query, int32(PendingBalanceSumMaxCount-cnt+1), "")
+		if err != nil {
+			return nil, 0, err
+		}
+		defer iter.Close()
+		for iter.HasNext() {
+			kv, err := iter.Next()
+			if err != nil {
+				return nil, 0, err
+			}
+			// PendingBalance and RemovedPendingBalance have the same amount field
+			pb := &PendingBalance{}
+			if err = json.Unmarshal(kv.Value, pb); err != nil {
+				return nil, 0, errors.Wrap(err, "failed to unmarshal the pending balance")
+			}
+			sum.Add(&pb.Amount)
+			cnt++
+		}
+		if cnt > PendingBalanceSumMaxCount {
+			return nil, 0, errors.Errorf("too many pending balances at the time (max %d)", PendingBalanceSumMaxCount)
+		}
+	}
+	return sum, cnt, nil
+}
+
+// GetQueryHolders returns the funded balances of the token (largest first).
+func (bb *BalanceStub) GetQueryHolders(tokenCode, bookmark string, fetchSize int) (*QueryResult, error) {
+	if fetchSize < 1 {
+		fetchSize = HoldersFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+	query := CreateQueryHolders(tokenCode)
+	iter, meta, err := bb.stub.GetQueryResultWithPagination(query, int32(fetchSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	return NewQueryResult(meta, iter)
+}
+
+// amountDigits returns the number of digits of the positive amount. (0 = not funded)
+func amountDigits(amount *Amount) int {
+	if amount.Sign() > 0 {
+		return len(amount.String())
+	}
+	return 0
+}
+
+// PutBalance puts the balance state with the token and the digits of the amount. (see token/holders)
 func (bb *BalanceStub) PutBalance(balance *Balance) error {
+	balance.Token, _ = ParseCode(balance.DOCTYPEID)
+	balance.Digits = amountDigits(&balance.Amount)
 	data, err := json.Marshal(balance)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal the balance")
@@ -114,12 +228,57 @@ func (bb *BalanceStub) PutBalance(balance *Balance) error {
 	return nil
 }
 
+// Reindex puts the token and the digits to the balances of the token which don't have them. (see token/holders)
+// It walks max BalanceReindexSize balances in order of the address, from the bookmark (address) if it is not empty.
+func (bb *BalanceStub) Reindex(code, bookmark string) (*BalanceReindexResult, error) {
+	// addresses of the token: token code + account type + hash
+	start := bb.CreateKey(fmt.Sprintf("%s%02X", code, byte(AccountTypePersonal)))
+	end := bb.CreateKey(fmt.Sprintf("%s%02X", code, byte(AccountTypeJoint)+1))
+	if len(bookmark) > 0 {
+		start = bb.CreateKey(bookmark)
+	}
+	iter, err := bb.stub.GetStateByRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	res := &BalanceReindexResult{Token: code}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		bal := &Balance{}
+		if err = json.Unmarshal(kv.Value, bal); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the balance")
+		}
+		if res.Scanned == BalanceReindexSize {
+			res.Bookmark = bal.DOCTYPEID
+			break
+		}
+		res.Scanned++
+		if c, _ := ParseCode(bal.DOCTYPEID); c != code { // the token code which has this code as prefix
+			continue
+		}
+		if bal.Token == code && bal.Digits == amountDigits(&bal.Amount) {
+			continue
+		}
+		if err = bb.PutBalance(bal); err != nil {
+			return nil, err
+		}
+		res.Updated++
+	}
+	return res, nil
+}
+
 // CreateLogKey _
 func (bb *BalanceStub) CreateLogKey(id string, seq int64) string {
 	return fmt.Sprintf("BLOG_%s_%d", id, seq)
 }
 
 // PutBalanceLog _
+// Every balance change is logged here, so it also emits the balance event.
 func (bb *BalanceStub) PutBalanceLog(log *BalanceLog) error {
 	data, err := json.Marshal(log)
 	if err != nil {
@@ -128,7 +287,7 @@ func (bb *BalanceStub) PutBalanceLog(log *BalanceLog) error {
 	if err = bb.stub.PutState(bb.CreateLogKey(log.DOCTYPEID, log.CreatedTime.UnixNano()), data); err != nil {
 		return errors.Wrap(err, "failed to put the balance log state")
 	}
-	return nil
+	return NewEventStub(bb.stub).EmitBalanceLog(log)
 }
 
 // CreatePendingKey _
@@ -182,6 +341,31 @@ func (bb *BalanceStub) PutPendingBalance(balance *PendingBalance) error {
 	return nil
 }
 
+// CreateRemovedPendingKey _
+func (bb *BalanceStub) CreateRemovedPendingKey(id string) string {
+	return "PBLR_" + id
+}
+
+// DeletePendingBalance deletes the pending balance state,
+// and keeps the removed pending balance to answer the pending amount at the past time. (see balance/at)
+func (bb *BalanceStub) DeletePendingBalance(balance *PendingBalance) error {
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	data, err := json.Marshal(NewRemovedPendingBalance(balance, ts))
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the removed pending balance")
+	}
+	if err = bb.stub.PutState(bb.CreateRemovedPendingKey(balance.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the removed pending balance state")
+	}
+	if err = bb.stub.DelState(bb.CreatePendingKey(balance.DOCTYPEID)); err != nil {
+		return errors.Wrap(err, "failed to delete the pending balance")
+	}
+	return nil
+}
+
 // Supply - Mint & Burn
 func (bb *BalanceStub) Supply(bal *Balance, amount Amount) (*BalanceLog, error) {
 	ts, err := txtime.GetTime(bb.stub)
@@ -204,7 +388,8 @@ func (bb *BalanceStub) Supply(bal *Balance, amount Amount) (*BalanceLog, error)
 }
 
 // Transfer _
-func (bb *BalanceStub) Transfer(sender, receiver *Balance, amount, fee Amount, memo string, pendingTime *txtime.Time) (*BalanceLog, error) {
+// If cancellable is true, the sender can cancel the time-locked transfer before the pending time.
+func (bb *BalanceStub) Transfer(sender, receiver *Balance, amount, fee Amount, memo string, pendingTime *txtime.Time, cancellable bool) (*BalanceLog, error) {
 	ts, err := txtime.GetTime(bb.stub)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get the timestamp")
@@ -213,20 +398,12 @@ func (bb *BalanceStub) Transfer(sender, receiver *Balance, amount, fee Amount, m
 	if pendingTime != nil && pendingTime.Cmp(ts) > 0 { // time lock
 		pb := NewPendingBalance(bb.stub.GetTxID(), receiver, sender, amount, nil, memo, pendingTime)
 		pb.CreatedTime = ts
+		pb.Cancellable = cancellable
 		if err = bb.PutPendingBalance(pb); err != nil {
 			return nil, err
 		}
-	} else {
-		receiver.Amount.Add(&amount) // deposit
-		receiver.UpdatedTime = ts
-		if err = bb.PutBalance(receiver); err != nil {
-			return nil, err
-		}
-		rbl := NewBalanceTransferLog(sender, receiver, amount, nil, memo)
-		rbl.CreatedTime = ts
-		if err = bb.PutBalanceLog(rbl); err != nil {
-			return nil, err
-		}
+	} else if err = bb.deposit(sender, receiver, amount, memo, ts); err != nil {
+		return nil, err
 	}
 
 	amount.Neg()                        // -
@@ -250,8 +427,49 @@ func (bb *BalanceStub) Transfer(sender, receiver *Balance, amount, fee Amount, m
 	return sbl, nil
 }
 
-// TransferPendingBalance transfers the sender's pending balance. (multi-sig contract)
-func (bb *BalanceStub) TransferPendingBalance(pb *PendingBalance, receiver *Balance, pendingTime *txtime.Time) error {
+// TransferBatch transfers amounts to multiple receivers. The sender's balance is written once.
+// receivers must be matched with entries, and must not be duplicated.
+func (bb *BalanceStub) TransferBatch(sender *Balance, receivers []*Balance, entries []*TransferBatchEntry) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	sum := ZeroAmount()
+	fee := ZeroAmount()
+	for i, entry := range entries {
+		if err = bb.deposit(sender, receivers[i], entry.Amount, entry.Memo, ts); err != nil {
+			return nil, err
+		}
+		sum.Add(&entry.Amount)
+		if entry.Fee != nil {
+			fee.Add(entry.Fee)
+		}
+	}
+
+	sum.Neg()                           // -
+	sender.Amount.Add(sum)              // withdraw
+	sender.Amount.Add(fee.Copy().Neg()) // fee
+	sender.UpdatedTime = ts
+	if err = bb.PutBalance(sender); err != nil {
+		return nil, err
+	}
+	sbl := NewBalanceSendBatchLog(sender, bb.stub.GetTxID(), *sum, fee)
+	sbl.CreatedTime = ts
+	if err = bb.PutBalanceLog(sbl); err != nil {
+		return nil, err
+	}
+
+	// fee
+	if _, err := NewFeeStub(bb.stub).CreateFee(sender.GetID(), *fee); err != nil {
+		return nil, err
+	}
+
+	return sbl, nil
+}
+
+// TransferPendingBalanceBatch transfers the sender's pending balance to multiple receivers. (multi-sig contract)
+func (bb *BalanceStub) TransferPendingBalanceBatch(pb *PendingBalance, receivers []*Balance, entries []*TransferBatchEntry) error {
 	ts, err := txtime.GetTime(bb.stub)
 	if err != nil {
 		return errors.Wrap(err, "failed to get the timestamp")
@@ -259,23 +477,76 @@ func (bb *BalanceStub) TransferPendingBalance(pb *PendingBalance, receiver *Bala
 
 	sender := &Balance{DOCTYPEID: pb.Account} // proxy
 
-	if pendingTime != nil && pendingTime.Cmp(ts) > 0 { // time lock
-		pb := NewPendingBalance(bb.stub.GetTxID(), receiver, sender, pb.Amount, nil, pb.Memo, pendingTime)
-		pb.CreatedTime = ts
-		if err = bb.PutPendingBalance(pb); err != nil {
+	for i, entry := range entries {
+		if err = bb.deposit(sender, receivers[i], entry.Amount, entry.Memo, ts); err != nil {
 			return err
 		}
-	} else {
-		receiver.Amount.Add(&pb.Amount) // deposit
-		receiver.UpdatedTime = ts
-		if err = bb.PutBalance(receiver); err != nil {
+	}
+
+	// fee
+	if pb.Fee != nil {
+		if _, err := NewFeeStub(bb.stub).CreateFee(pb.Account, *pb.Fee); err != nil {
+			return err
+		}
+	}
+
+	// remove pending balance
+	if err = bb.DeletePendingBalance(pb); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deposit adds the amount to the receiver's balance and puts the receive log.
+// If the receiver is a delta receiving proxy, it puts a balance delta instead.
+func (bb *BalanceStub) deposit(sender, receiver *Balance, amount Amount, memo string, ts *txtime.Time) error {
+	if receiver.delta {
+		delta := &BalanceDelta{
+			DOCTYPEID:   receiver.DOCTYPEID,
+			DeltaID:     fmt.Sprintf("%d%s", ts.UnixNano(), bb.stub.GetTxID()),
+			RID:         sender.DOCTYPEID,
+			Amount:      amount,
+			Memo:        memo,
+			CreatedTime: ts,
+		}
+		if err := bb.PutDelta(delta); err != nil {
 			return err
 		}
-		rbl := NewBalanceTransferLog(sender, receiver, pb.Amount, nil, pb.Memo)
+		// the log key is BLOG_{address}_{UnixNano}, and it is put without reading, so concurrent receiving doesn't conflict
+		rbl := NewBalanceReceiveDeltaLog(delta)
 		rbl.CreatedTime = ts
-		if err = bb.PutBalanceLog(rbl); err != nil {
+		return bb.PutBalanceLog(rbl)
+	}
+
+	receiver.Amount.Add(&amount)
+	receiver.UpdatedTime = ts
+	if err := bb.PutBalance(receiver); err != nil {
+		return err
+	}
+	rbl := NewBalanceTransferLog(sender, receiver, amount, nil, memo)
+	rbl.CreatedTime = ts
+	return bb.PutBalanceLog(rbl)
+}
+
+// TransferPendingBalance transfers the sender's pending balance. (multi-sig contract)
+func (bb *BalanceStub) TransferPendingBalance(pb *PendingBalance, receiver *Balance, pendingTime *txtime.Time, cancellable bool) error {
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	sender := &Balance{DOCTYPEID: pb.Account} // proxy
+
+	if pendingTime != nil && pendingTime.Cmp(ts) > 0 { // time lock
+		pb := NewPendingBalance(bb.stub.GetTxID(), receiver, sender, pb.Amount, nil, pb.Memo, pendingTime)
+		pb.CreatedTime = ts
+		pb.Cancellable = cancellable
+		if err = bb.PutPendingBalance(pb); err != nil {
 			return err
 		}
+	} else if err = bb.deposit(sender, receiver, pb.Amount, pb.Memo, ts); err != nil {
+		return err
 	}
 
 	// fee
@@ -286,8 +557,8 @@ func (bb *BalanceStub) TransferPendingBalance(pb *PendingBalance, receiver *Bala
 	}
 
 	// remove pending balance
-	if err = bb.stub.DelState(bb.CreatePendingKey(pb.DOCTYPEID)); err != nil {
-		return errors.Wrap(err, "failed to delete the pending balance")
+	if err = bb.DeletePendingBalance(pb); err != nil {
+		return err
 	}
 
 	return nil
@@ -317,7 +588,7 @@ func (bb *BalanceStub) Deposit(id string, sender *Balance, con *contract.Contrac
 	if fee != nil {
 		applied.Add(fee)
 	}
-	sender.Amount.Add(applied.Neg())	// -applied
+	sender.Amount.Add(applied.Neg()) // -applied
 	sender.UpdatedTime = ts
 	if err = bb.PutBalance(sender); err != nil {
 		return nil, err
@@ -333,7 +604,8 @@ func (bb *BalanceStub) Deposit(id string, sender *Balance, con *contract.Contrac
 
 // Withdraw _
 // It does not validate pending time!
-func (bb *BalanceStub) Withdraw(pb *PendingBalance) (*BalanceLog, error) {
+// The fee is deducted from the withdrawn amount. (time-locked pending balance)
+func (bb *BalanceStub) Withdraw(pb *PendingBalance, fee Amount) (*BalanceLog, error) {
 	ts, err := txtime.GetTime(bb.stub)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get the timestamp")
@@ -347,21 +619,184 @@ func (bb *BalanceStub) Withdraw(pb *PendingBalance) (*BalanceLog, error) {
 	if pb.Fee != nil {
 		applied = applied.Add(pb.Fee)
 	}
+	applied.Add(fee.Copy().Neg())
 	bal.Amount.Add(applied)
 	bal.UpdatedTime = ts
 	if err = bb.PutBalance(bal); err != nil {
 		return nil, err
 	}
 	log := NewBalanceWithdrawLog(bal, pb)
+	if fee.Sign() > 0 {
+		log.Diff = *applied
+		log.Fee = &fee
+	}
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	// fee
+	if _, err = NewFeeStub(bb.stub).CreateFee(bal.GetID(), fee); err != nil {
+		return nil, err
+	}
+
+	// remove pending balance
+	if err = bb.DeletePendingBalance(pb); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// ChargeFee charges the fee of the fn to the balance. (for operations which don't move the balance)
+func (bb *BalanceStub) ChargeFee(bal *Balance, fee Amount, rid, fn string) (*BalanceLog, error) {
+	if fee.Sign() == 0 {
+		return nil, nil
+	}
+	if bal.Amount.Cmp(&fee) < 0 {
+		return nil, errors.New("not enough balance for the fee")
+	}
+
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	bal.Amount.Add(fee.Copy().Neg())
+	bal.UpdatedTime = ts
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceFeeLog(bal, fee, rid, fn)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	if _, err = NewFeeStub(bb.stub).CreateFee(bal.GetID(), fee); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// CancelPendingBalance returns the cancellable time-locked pending balance to the sender.
+// It does not validate pending time!
+func (bb *BalanceStub) CancelPendingBalance(pb *PendingBalance) (*BalanceLog, error) {
+	if pb.Type != PendingBalanceTypeAccount || !pb.Cancellable {
+		return nil, errors.New("not cancellable pending balance")
+	}
+
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	bal, err := bb.GetBalance(pb.RID)
+	if err != nil {
+		return nil, err
+	}
+	bal.Amount.Add(&pb.Amount)
+	bal.UpdatedTime = ts
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceCancelPendingLog(bal, pb)
 	log.CreatedTime = ts
 	if err = bb.PutBalanceLog(log); err != nil {
 		return nil, err
 	}
 
 	// remove pending balance
-	if err = bb.stub.DelState(bb.CreatePendingKey(pb.DOCTYPEID)); err != nil {
-		return nil, errors.Wrap(err, "failed to delete the pending balance")
+	if err = bb.DeletePendingBalance(pb); err != nil {
+		return nil, err
 	}
 
 	return log, nil
 }
+
+// CreateDeltaKey _
+func (bb *BalanceStub) CreateDeltaKey(id, deltaID string) string {
+	return fmt.Sprintf("BLCD_%s_%s", id, deltaID)
+}
+
+// PutDelta _
+func (bb *BalanceStub) PutDelta(delta *BalanceDelta) error {
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the balance delta")
+	}
+	if err = bb.stub.PutState(bb.CreateDeltaKey(delta.DOCTYPEID, delta.DeltaID), data); err != nil {
+		return errors.Wrap(err, "failed to put the balance delta state")
+	}
+	return nil
+}
+
+// GetDeltaSum returns the sum of the unmerged balance deltas in order of the delta ID.
+// If limit is less than 1, it sums all deltas.
+// If del is true, the summed deltas are deleted.
+func (bb *BalanceStub) GetDeltaSum(id string, limit int, del bool) (*BalanceDeltaSum, error) {
+	// range of the keys which have the prefix 'BLCD_{id}_' ('`' follows '_')
+	iter, err := bb.stub.GetStateByRange(bb.CreateDeltaKey(id, ""), "BLCD_"+id+"`")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	ds := &BalanceDeltaSum{Sum: ZeroAmount()}
+	for iter.HasNext() {
+		if limit > 0 && ds.Count >= limit {
+			ds.HasMore = true
+			break
+		}
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		delta := &BalanceDelta{}
+		if err = json.Unmarshal(kv.Value, delta); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the balance delta")
+		}
+		if del {
+			if err = bb.stub.DelState(kv.Key); err != nil {
+				return nil, errors.Wrap(err, "failed to delete the balance delta")
+			}
+		}
+		if ds.Count == 0 {
+			ds.Start = delta.DeltaID
+		}
+		ds.Sum.Add(&delta.Amount)
+		ds.End = delta.DeltaID
+		ds.Count++
+	}
+	return ds, nil
+}
+
+// MergeDeltas merges the balance deltas into the balance. (max BalanceDeltaMergeSize)
+// If there is no delta, it returns nil log.
+func (bb *BalanceStub) MergeDeltas(bal *Balance) (*BalanceDeltaSum, *BalanceLog, error) {
+	ts, err := txtime.GetTime(bb.stub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	ds, err := bb.GetDeltaSum(bal.DOCTYPEID, BalanceDeltaMergeSize, true)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get balance deltas")
+	}
+	if ds.Count == 0 {
+		return ds, nil, nil
+	}
+
+	bal.Amount.Add(ds.Sum)
+	bal.UpdatedTime = ts
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, nil, err
+	}
+	log := NewBalanceMergeDeltaLog(bal, *ds.Sum, ds.Start, ds.End)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, nil, err
+	}
+	return ds, log, nil
+}
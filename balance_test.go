@@ -0,0 +1,244 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// getTestBalanceAt returns the balance/at result of the address at the time.
+func getTestBalanceAt(t *testing.T, h *testHarness, kid, addr string, at time.Time) *BalanceAt {
+	t.Helper()
+	result := &BalanceAt{}
+	if err := json.Unmarshal(h.mustInvokeAs(kid, "balance/at", addr, strconv.FormatInt(at.Unix(), 10)), result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestBalanceAt(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	created := h.clock
+	h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100")
+	transferred := h.clock
+	h.mustInvokeAs(alice, "pay", "", merchantAddr, "200", "order-1")
+	pendingTime := strconv.FormatInt(h.clock.Add(time.Hour).Unix(), 10)
+	h.mustInvokeAs(alice, "transfer", "", merchantAddr, "10", "", pendingTime)
+	locked := h.clock
+	h.mustInvokeWithTransient(alice, map[string][]byte{CancellableTransientKey: []byte("true")}, "transfer", "", merchantAddr, "20", "", pendingTime)
+	cancellable := h.clock
+	h.mustInvokeAs(alice, "balance/pending/cancel", fmt.Sprintf("tx%08d", h.seq))
+	h.advance(time.Minute)
+	h.mustInvokeAs(merchant, "pay/prune", "PCI", "false")
+	pruned := h.clock
+
+	if res := getTestBalanceAt(t, h, alice, merchantAddr, created); res.Log != nil || res.Amount.String() != "0" {
+		t.Fatalf("unexpected balance before the first log: %+v", res)
+	}
+	if res := getTestBalanceAt(t, h, alice, merchantAddr, transferred); res.Amount.String() != "100" || res.Log.Type != BalanceLogTypeReceive {
+		t.Fatalf("unexpected balance after the transfer: %+v", res)
+	}
+
+	// pending balances and unpruned pays are reported separately
+	res := getTestBalanceAt(t, h, merchant, "PCI", locked)
+	if res.Address != merchantAddr || res.Amount.String() != "100" {
+		t.Fatalf("unexpected balance: %+v", res)
+	}
+	if res.Pending.String() != "10" || res.PendingCount != 1 {
+		t.Fatalf("unexpected pending balances: %s (%d)", res.Pending.String(), res.PendingCount)
+	}
+	if res.UnprunedPay.Count != 1 || res.UnprunedPay.Sum.String() != "200" {
+		t.Fatalf("unexpected unpruned pays: %+v", res.UnprunedPay)
+	}
+
+	// the pending balance cancelled later is still pending at the time
+	res = getTestBalanceAt(t, h, merchant, "PCI", cancellable)
+	if res.Pending.String() != "30" || res.PendingCount != 2 {
+		t.Fatalf("unexpected pending balances: %s (%d)", res.Pending.String(), res.PendingCount)
+	}
+	res = getTestBalanceAt(t, h, merchant, "PCI", pruned)
+	if res.Pending.String() != "10" || res.PendingCount != 1 {
+		t.Fatalf("unexpected pending balances after the cancel: %s (%d)", res.Pending.String(), res.PendingCount)
+	}
+
+	// pruned pays are in the amount
+	res = getTestBalanceAt(t, h, merchant, "PCI", pruned)
+	if res.Log.Type != BalanceLogTypePrunePay || res.UnprunedPay.Count != 0 {
+		t.Fatalf("unexpected balance after the prune: %+v", res)
+	}
+	assertBalance(t, h, merchantAddr, res.Amount.String())
+}
+
+func TestBalanceDeltaMerge(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, merchant} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	h.mustInvokeAs(merchant, "account/delta/set", "PCI", "true")
+	if res := h.invokeAs(alice, "account/delta/set", merchantAddr, "false"); res.Status == shim.OK {
+		t.Fatal("only holders can set the flag")
+	}
+
+	// incoming transfers don't touch the balance
+	h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100")
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "100")
+	h.mustInvokeAs(bob, "transfer", "", merchantAddr, "50")
+	assertBalance(t, h, merchantAddr, "0")
+	assertBalance(t, h, aliceAddr, "798")
+
+	// each delta has the receive delta log, but the balance at the time is not changed
+	event := getTestBalanceEvent(t, h)
+	if len(event.Changes) != 2 || event.Changes[0].Type != BalanceLogTypeReceiveDelta || event.Changes[0].Diff.String() != "50" || event.Changes[0].RID != bobAddr {
+		t.Fatalf("unexpected receive delta event: %s", h.event.Payload)
+	}
+	if res := getTestBalanceAt(t, h, merchant, "PCI", h.clock); res.Log != nil || res.Amount.String() != "0" {
+		t.Fatalf("unexpected balance at the time: %+v", res)
+	}
+	logs := struct {
+		Records []*BalanceLog `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "balance/logs", "PCI"), &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.Records) != 2 || logs.Records[0].Type != BalanceLogTypeReceiveDelta || logs.Records[1].Type != BalanceLogTypeReceiveDelta {
+		t.Fatalf("unexpected balance logs: %+v", logs.Records)
+	}
+
+	// effective balance
+	account := struct {
+		Balance struct {
+			Amount          string           `json:"amount"`
+			Delta           *BalanceDeltaSum `json:"delta"`
+			EffectiveAmount string           `json:"effective_amount"`
+		} `json:"balance"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "account/get", "PCI"), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance.Delta == nil || account.Balance.Delta.Count != 2 || account.Balance.EffectiveAmount != "150" {
+		t.Fatalf("unexpected account balance: %+v", account.Balance)
+	}
+
+	// merge
+	ds := &BalanceDeltaSum{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "balance/merge", "PCI"), ds); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Count != 2 || ds.Sum.String() != "150" || ds.HasMore {
+		t.Fatalf("unexpected merge result: %+v", ds)
+	}
+	assertBalance(t, h, merchantAddr, "150")
+	if res := h.invokeAs(merchant, "balance/merge", "PCI"); res.Status == shim.OK {
+		t.Fatal("nothing to merge")
+	}
+	event = getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeMergeDelta || event.Changes[0].Amount.String() != "150" {
+		t.Fatalf("unexpected merge event: %s", h.event.Payload)
+	}
+
+	// back to the balance
+	h.mustInvokeAs(merchant, "account/delta/set", "PCI", "false")
+	h.mustInvokeAs(alice, "transfer", "", merchantAddr, "10")
+	assertBalance(t, h, merchantAddr, "160")
+}
+
+func TestBalancePendingCancel(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	pendingTime := strconv.FormatInt(h.clock.Add(time.Minute).Unix(), 10)
+	cancellable := map[string][]byte{CancellableTransientKey: []byte("true")}
+	if res := h.invokeWithTransient(alice, cancellable, "transfer", "", bobAddr, "100", "", "0"); res.Status == shim.OK {
+		t.Fatal("only the time-locked transfer can be cancellable")
+	}
+
+	// not cancellable
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "100", "", pendingTime)
+	pbID := fmt.Sprintf("tx%08d", h.seq) // pending balance ID is the txid
+	if res := h.invokeAs(alice, "balance/pending/cancel", pbID); res.Status == shim.OK {
+		t.Fatal("the pending balance is not cancellable")
+	}
+
+	// cancellable
+	h.mustInvokeWithTransient(alice, cancellable, "transfer", "", bobAddr, "200", "oops", pendingTime)
+	pbID = fmt.Sprintf("tx%08d", h.seq)
+	assertBalance(t, h, aliceAddr, "697")
+	pb := &PendingBalance{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "balance/pending/get", pbID), pb); err != nil {
+		t.Fatal(err)
+	}
+	if !pb.Cancellable || pb.Account != bobAddr || pb.RID != aliceAddr {
+		t.Fatalf("unexpected pending balance: %+v", pb)
+	}
+	if res := h.invokeAs(bob, "balance/pending/cancel", pbID); res.Status == shim.OK {
+		t.Fatal("only the sender can cancel")
+	}
+
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "balance/pending/cancel", pbID), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeCancelPending || log.Diff.String() != "200" || log.RID != bobAddr {
+		t.Fatalf("unexpected cancel log: %+v", log)
+	}
+	assertBalance(t, h, aliceAddr, "897") // the fee is not returned
+	if res := h.invokeAs(bob, "balance/pending/withdraw", pbID); res.Status == shim.OK {
+		t.Fatal("the pending balance is cancelled")
+	}
+
+	// expired
+	h.mustInvokeWithTransient(alice, cancellable, "transfer", "", bobAddr, "100", "", pendingTime)
+	pbID = fmt.Sprintf("tx%08d", h.seq)
+	h.advance(time.Minute)
+	if res := h.invokeAs(alice, "balance/pending/cancel", pbID); res.Status == shim.OK {
+		t.Fatal("the time lock is expired")
+	}
+	h.mustInvokeAs(bob, "balance/pending/withdraw", pbID)
+	assertBalance(t, h, bobAddr, "100")
+}
@@ -12,12 +12,89 @@ import (
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
 )
 
+// params[0] : token code | account address
+// params[1] : time (time represented by int64 seconds)
+func balanceAt(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+	}
+
+	seconds, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil {
+		return shim.Error("invalid time: need seconds since 1970")
+	}
+	t := txtime.Unix(seconds, 0)
+
+	bb := NewBalanceStub(stub)
+	if _, err = bb.GetBalance(addr.String()); err != nil {
+		return responseError(err, "failed to get the balance")
+	}
+
+	result := &BalanceAt{Address: addr.String(), Time: t}
+	log, err := bb.GetBalanceLogAt(addr.String(), "", t)
+	if err != nil {
+		return responseError(err, "failed to get the balance log")
+	}
+	if log != nil {
+		result.Amount = log.Amount
+		result.Log = log
+	}
+
+	pending, cnt, err := bb.GetPendingBalanceSumAt(addr.String(), t)
+	if err != nil {
+		return responseError(err, "failed to get pending balances")
+	}
+	result.Pending = *pending
+	result.PendingCount = cnt
+
+	// pays after the last prune at the time
+	stime := txtime.Unix(0, 0)
+	plog, err := bb.GetBalanceLogAt(addr.String(), strconv.Itoa(int(BalanceLogTypePrunePay)), t)
+	if err != nil {
+		return responseError(err, "failed to get the prune log")
+	}
+	if plog != nil && len(plog.PruneEndID) > 0 {
+		stime, err = GetPayIDTime(plog.PruneEndID)
+		if err != nil {
+			return responseError(err, "failed to get the last pruned time")
+		}
+	}
+	result.UnprunedPay, err = NewPayStub(stub).GetPaySumByTime(addr.String(), stime, t)
+	if err != nil {
+		return responseError(err, "failed to get unpruned pays")
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return responseError(err, "failed to marshal the balance")
+	}
+	return shim.Success(data)
+}
+
 // params[0] : token code | account address
 // params[1] : balance log type
 // params[2] : bookmark
 // params[3] : fetch size (if < 1 => default size, max 200)
 // params[4] : start time (time represented by int64 seconds)
 // params[5] : end time (time represented by int64 seconds)
+// params[6] : formatted flag (true = add formatted amounts with the token decimal)
 func balanceLogs(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 1 {
 		return shim.Error("incorrect number of parameters. expecting 1+")
@@ -32,6 +109,7 @@ func balanceLogs(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	typeStr := ""
 	bookmark := ""
 	fetchSize := 0
+	formatted := false
 	var stime, etime *txtime.Time
 	// balance log type
 	if len(params) > 1 {
@@ -66,6 +144,13 @@ func balanceLogs(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 								return shim.Error("invalid time parameters")
 							}
 						}
+						// formatted
+						if len(params) > 6 && len(params[6]) > 0 {
+							formatted, err = strconv.ParseBool(params[6])
+							if err != nil {
+								return shim.Error("invalid formatted flag")
+							}
+						}
 					}
 				}
 			}
@@ -94,6 +179,11 @@ func balanceLogs(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	if err != nil {
 		return responseError(err, "failed to get balance logs")
 	}
+	if formatted {
+		if err = formatAmountsOfQueryResult(stub, addr.Code, res); err != nil {
+			return responseError(err, "failed to format balance logs")
+		}
+	}
 
 	data, err := json.Marshal(res)
 	if err != nil {
@@ -102,6 +192,130 @@ func balanceLogs(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	return shim.Success(data)
 }
 
+// merge the balance deltas into the balance (see account/delta/set)
+// params[0] : token code | account address
+func balanceMerge(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+	}
+
+	// account validation
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if account.IsSuspended() {
+		return shim.Error("the account is suspended")
+	}
+
+	bb := NewBalanceStub(stub)
+	bal, err := bb.GetBalance(account.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the balance")
+	}
+
+	ds, log, err := bb.MergeDeltas(bal)
+	if err != nil {
+		return responseError(err, "failed to merge balance deltas")
+	}
+	if nil == log {
+		return shim.Error("found no record to merge.")
+	}
+
+	data, err := json.Marshal(ds)
+	if err != nil {
+		return responseError(err, "failed to marshal the merge result")
+	}
+	return shim.Success(data)
+}
+
+// cancel the cancellable time-locked transfer before the pending time (sender holders only)
+// params[0] : pending balance id
+func balancePendingCancel(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// pending balance
+	bb := NewBalanceStub(stub)
+	pb, err := bb.GetPendingBalance(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the pending balance")
+	}
+	if pb.Type != PendingBalanceTypeAccount || !pb.Cancellable {
+		return shim.Error("not cancellable pending balance")
+	}
+	if pb.PendingTime.Cmp(ts) <= 0 {
+		return shim.Error("the time lock is expired")
+	}
+
+	// sender account
+	addr, _ := ParseAddress(pb.RID) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to cancel")
+	}
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if account.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+
+	if jac, ok := account.(*JointAccount); ok && jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"balance/pending/cancel", pb.DOCTYPEID}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	// cancel
+	log, err := bb.CancelPendingBalance(pb)
+	if err != nil {
+		return responseError(err, "failed to cancel")
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+
+	return shim.Success(data)
+}
+
 // params[0] : pending balance id
 func balancePendingGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) != 1 {
@@ -216,6 +430,9 @@ func balancePendingWithdraw(stub shim.ChaincodeStubInterface, params []string) p
 
 	// account
 	addr, _ := ParseAddress(pb.Account) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to withdraw")
+	}
 	ab := NewAccountStub(stub, addr.Code)
 	account, err := ab.GetAccount(addr)
 	if err != nil {
@@ -228,8 +445,19 @@ func balancePendingWithdraw(stub shim.ChaincodeStubInterface, params []string) p
 		return shim.Error("the account is suspended")
 	}
 
+	// fee of time-locked pending balance
+	fee := ZeroAmount()
+	if pb.Type == PendingBalanceTypeAccount {
+		if fee, err = NewFeeStub(stub).CalcFee(addr, "balance/pending/withdraw", pb.Amount); err != nil {
+			return responseError(err, "failed to get the fee amount")
+		}
+		if fee.Cmp(&pb.Amount) > 0 { // fee can't exceed the amount
+			fee = pb.Amount.Copy()
+		}
+	}
+
 	// withdraw
-	log, err := bb.Withdraw(pb)
+	log, err := bb.Withdraw(pb, *fee)
 	if err != nil {
 		return responseError(err, "failed to withdraw")
 	}
@@ -241,3 +469,92 @@ func balancePendingWithdraw(stub shim.ChaincodeStubInterface, params []string) p
 
 	return shim.Success(data)
 }
+
+// put the token and the digits to the balances which don't have them (see token/holders)
+// params[0] : token code
+// params[1] : optional. bookmark
+func balanceReindex(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := ""
+	if len(params) > 1 && len(params[1]) > 0 {
+		if c, err := ParseCode(params[1]); err != nil || c != code {
+			return shim.Error("invalid bookmark")
+		}
+		bookmark = params[1]
+	}
+
+	// token
+	token, err := NewTokenStub(stub).GetToken(code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	// genesis account
+	gAddr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := NewAccountStub(stub, code).GetAccount(gAddr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !genesis.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+
+	res, err := NewBalanceStub(stub).Reindex(code, bookmark)
+	if err != nil {
+		return responseError(err, "failed to reindex balances")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal the reindex result")
+	}
+	return shim.Success(data)
+}
+
+// contract callbacks
+
+// doc: ["balance/pending/cancel", pending-balance-ID]
+func executeBalancePendingCancel(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 2 {
+		return shim.Error("invalid contract document")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	bb := NewBalanceStub(stub)
+	pb, err := bb.GetPendingBalance(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the pending balance")
+	}
+	if pb.PendingTime.Cmp(ts) <= 0 {
+		return shim.Error("the time lock is expired")
+	}
+
+	addr, _ := ParseAddress(pb.RID) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to cancel")
+	}
+
+	if _, err = bb.CancelPendingBalance(pb); err != nil {
+		return responseError(err, "failed to cancel")
+	}
+
+	return shim.Success(nil)
+}
@@ -0,0 +1,82 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/stringset"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// QuorumContractStatus _
+type QuorumContractStatus int8
+
+const (
+	// QuorumContractStatusPending _
+	QuorumContractStatusPending QuorumContractStatus = iota
+	// QuorumContractStatusExecuted _
+	QuorumContractStatusExecuted
+	// QuorumContractStatusCancelled _
+	QuorumContractStatusCancelled
+)
+
+// QuorumContract is the approval state of the M-of-N contract.
+// kiesnet-contract executes a contract only when all signers approve,
+// so the approvals of the M-of-N contract are collected and executed by contract/approve.
+type QuorumContract struct {
+	DOCTYPEID   string               `json:"@quorum_contract"` // contract ID
+	Document    json.RawMessage      `json:"document"`
+	Signers     *stringset.Set       `json:"signers"`
+	Required    *stringset.Set       `json:"required,omitempty"` // signers who must approve regardless of the quorum
+	Quorum      int                  `json:"quorum"`
+	Approvals   *stringset.Set       `json:"approvals"`
+	Rejections  *stringset.Set       `json:"rejections,omitempty"` // signers who cancelled the contract in kiesnet-contract
+	Status      QuorumContractStatus `json:"status"`
+	CreatedTime *txtime.Time         `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time         `json:"updated_time,omitempty"`
+	ExpiryTime  *txtime.Time         `json:"expiry_time,omitempty"`
+}
+
+// GetID implements Identifiable
+func (qc *QuorumContract) GetID() string {
+	return qc.DOCTYPEID
+}
+
+// IsExpired _
+func (qc *QuorumContract) IsExpired(t *txtime.Time) bool {
+	return qc.ExpiryTime != nil && qc.ExpiryTime.Cmp(t) < 0
+}
+
+// IsApproved returns true if the quorum and all the required signers have approved.
+func (qc *QuorumContract) IsApproved() bool {
+	if qc.Approvals.Size() < qc.Quorum {
+		return false
+	}
+	if qc.Required != nil {
+		for kid := range qc.Required.Map() {
+			if !qc.Approvals.Contains(kid) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsRejected returns true if the rest signers can't reach the quorum, or a required signer has rejected.
+func (qc *QuorumContract) IsRejected() bool {
+	if qc.Rejections == nil {
+		return false
+	}
+	if qc.Signers.Size()-qc.Rejections.Size() < qc.Quorum {
+		return true
+	}
+	if qc.Required != nil {
+		for kid := range qc.Required.Map() {
+			if qc.Rejections.Contains(kid) {
+				return true
+			}
+		}
+	}
+	return false
+}
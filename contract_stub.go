@@ -0,0 +1,118 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/contract"
+	"github.com/key-inside/kiesnet-ccpkg/stringset"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// ContractStub _
+type ContractStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewContractStub _
+func NewContractStub(stub shim.ChaincodeStubInterface) *ContractStub {
+	return &ContractStub{stub}
+}
+
+// CreateKey _
+func (cb *ContractStub) CreateKey(id string) string {
+	return "QCTR_" + id
+}
+
+// GetQuorumContract _
+func (cb *ContractStub) GetQuorumContract(id string) (*QuorumContract, error) {
+	data, err := cb.stub.GetState(cb.CreateKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the contract state")
+	}
+	if data == nil {
+		return nil, NotExistedQuorumContractError{id: id}
+	}
+	qc := &QuorumContract{}
+	if err = json.Unmarshal(data, qc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the contract")
+	}
+	return qc, nil
+}
+
+// PutQuorumContract _
+func (cb *ContractStub) PutQuorumContract(qc *QuorumContract) error {
+	data, err := json.Marshal(qc)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the contract")
+	}
+	if err = cb.stub.PutState(cb.CreateKey(qc.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the contract state")
+	}
+	return nil
+}
+
+// CreateQuorumContract keeps the approval state of the contract created in kiesnet-contract.
+func (cb *ContractStub) CreateQuorumContract(con *contract.Contract, docb []byte, signers *stringset.Set, quorum int, required *stringset.Set) (*QuorumContract, error) {
+	ts, err := txtime.GetTime(cb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+	expiryTime, err := con.GetExpiryTime()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the expiry time of the contract")
+	}
+
+	qc := &QuorumContract{
+		DOCTYPEID:   con.GetID(),
+		Document:    docb,
+		Signers:     signers,
+		Required:    required,
+		Quorum:      quorum,
+		Approvals:   stringset.New(),
+		Status:      QuorumContractStatusPending,
+		CreatedTime: ts,
+		UpdatedTime: ts,
+		ExpiryTime:  expiryTime,
+	}
+	if err = cb.PutQuorumContract(qc); err != nil {
+		return nil, err
+	}
+	return qc, nil
+}
+
+// SetStatus _
+func (cb *ContractStub) SetStatus(qc *QuorumContract, status QuorumContractStatus) error {
+	ts, err := txtime.GetTime(cb.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	qc.Status = status
+	qc.UpdatedTime = ts
+	return cb.PutQuorumContract(qc)
+}
+
+// Reject adds the rejection of the signer, and cancels the contract if the rest signers can't reach the quorum or it is expired.
+// It returns true if the contract is cancelled.
+func (cb *ContractStub) Reject(qc *QuorumContract, kid string) (bool, error) {
+	ts, err := txtime.GetTime(cb.stub)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the timestamp")
+	}
+	if qc.Rejections == nil {
+		qc.Rejections = stringset.New()
+	}
+	qc.Rejections.Add(kid)
+	qc.Approvals.Remove(kid)
+	if qc.IsRejected() || qc.IsExpired(ts) {
+		qc.Status = QuorumContractStatusCancelled
+	}
+	qc.UpdatedTime = ts
+	if err = cb.PutQuorumContract(qc); err != nil {
+		return false, err
+	}
+	return qc.Status == QuorumContractStatusCancelled, nil
+}
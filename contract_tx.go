@@ -11,6 +11,8 @@ import (
 	"github.com/key-inside/kiesnet-ccpkg/contract"
 	"github.com/key-inside/kiesnet-ccpkg/kid"
 	"github.com/key-inside/kiesnet-ccpkg/stringset"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
 )
 
 // CtrFunc _
@@ -18,14 +20,28 @@ type CtrFunc func(stub shim.ChaincodeStubInterface, cid string, doc []interface{
 
 // routes is the map of contract functions
 var ctrRoutes = map[string][]CtrFunc{
-	"account/create":        []CtrFunc{contractVoid, executeAccountCreate},
-	"account/holder/add":    []CtrFunc{contractVoid, executeAccountHolderAdd},
-	"account/holder/remove": []CtrFunc{contractVoid, executeAccountHolderRemove},
-	"pay":                   []CtrFunc{cancelTransfer, executePay},
-	"token/burn":            []CtrFunc{contractVoid, executeTokenBurn},
-	"token/create":          []CtrFunc{contractVoid, executeTokenCreate},
-	"token/mint":            []CtrFunc{contractVoid, executeTokenMint},
-	"transfer":              []CtrFunc{cancelTransfer, executeTransfer},
+	"account/create":         []CtrFunc{contractVoid, executeAccountCreate},
+	"account/delta/set":      []CtrFunc{contractVoid, executeAccountDeltaSet},
+	"account/freeze":         []CtrFunc{contractVoid, executeAccountFreeze},
+	"account/holder/add":     []CtrFunc{contractVoid, executeAccountHolderAdd},
+	"account/holder/remove":  []CtrFunc{contractVoid, executeAccountHolderRemove},
+	"account/threshold/set":  []CtrFunc{contractVoid, executeAccountThresholdSet},
+	"account/unfreeze":       []CtrFunc{contractVoid, executeAccountUnfreeze},
+	"allowance/approve":      []CtrFunc{contractVoid, executeAllowanceApprove},
+	"balance/pending/cancel": []CtrFunc{contractVoid, executeBalancePendingCancel},
+	"fee/exempt/add":         []CtrFunc{contractVoid, executeFeeExemptAdd},
+	"fee/exempt/remove":      []CtrFunc{contractVoid, executeFeeExemptRemove},
+	"pay":                    []CtrFunc{cancelTransfer, executePay},
+	"token/burn":             []CtrFunc{contractVoid, executeTokenBurn},
+	"token/create":           []CtrFunc{contractVoid, executeTokenCreate},
+	"token/genesis/rotate":   []CtrFunc{contractVoid, executeTokenGenesisRotate},
+	"token/mint":             []CtrFunc{contractVoid, executeTokenMint},
+	"token/pause":            []CtrFunc{contractVoid, executeTokenPause},
+	"token/unpause":          []CtrFunc{contractVoid, executeTokenUnpause},
+	"transfer":               []CtrFunc{cancelTransfer, executeTransfer},
+	"transfer/batch":         []CtrFunc{cancelTransfer, executeTransferBatch},
+	"vesting/create":         []CtrFunc{cancelTransfer, executeVestingCreate},
+	"vesting/revoke":         []CtrFunc{contractVoid, executeVestingRevoke},
 }
 
 // fnIdx : 0 = cancel, 1 = execute
@@ -45,17 +61,161 @@ func contractCallback(stub shim.ChaincodeStubInterface, fnIdx int, params []stri
 	}
 
 	// authentication
-	_, err = kid.GetID(stub, true)
+	kid, err := kid.GetID(stub, true)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	cid := params[0] // contract ID
-	doc := []interface{}{}
-	err = json.Unmarshal([]byte(params[1]), &doc)
+	doc, err := parseContractDocument([]byte(params[1]))
 	if err != nil {
 		return responseError(err, "failed to unmarshal the contract document")
 	}
+
+	// M-of-N contract
+	cb := NewContractStub(stub)
+	qc, err := cb.GetQuorumContract(cid)
+	if err != nil {
+		if _, ok := err.(NotExistedQuorumContractError); !ok {
+			return responseError(err, "failed to get the contract")
+		}
+	} else {
+		if qc.Status == QuorumContractStatusExecuted {
+			return shim.Success(nil) // already executed by contract/approve, nothing to execute or cancel
+		}
+		if qc.Status != QuorumContractStatusPending {
+			return shim.Error("the contract is not pending")
+		}
+		if fnIdx == 0 {
+			// a signer's cancel is a rejection. the contract is cancelled only if the quorum can't be reached.
+			cancelled, err := cb.Reject(qc, kid)
+			if err != nil {
+				return responseError(err, "failed to update the contract")
+			}
+			if !cancelled {
+				return shim.Success(nil)
+			}
+		} else if err = cb.SetStatus(qc, QuorumContractStatusExecuted); err != nil {
+			return responseError(err, "failed to update the contract")
+		}
+	}
+
+	return callContractFunc(stub, fnIdx, cid, doc)
+}
+
+// params[0] : contract ID
+// Approve the M-of-N contract. It is executed when the quorum and the required signers have approved.
+func contractApprove(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	cb := NewContractStub(stub)
+	qc, err := cb.GetQuorumContract(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the contract")
+	}
+	if qc.Status != QuorumContractStatusPending {
+		return shim.Error("the contract is not pending")
+	}
+	if qc.IsExpired(ts) {
+		return shim.Error("the contract is expired")
+	}
+	if !qc.Signers.Contains(kid) {
+		return shim.Error("not a signer")
+	}
+	if qc.Approvals.Contains(kid) {
+		return shim.Error("already approved")
+	}
+	if qc.Rejections != nil && qc.Rejections.Contains(kid) {
+		return shim.Error("already rejected")
+	}
+	qc.Approvals.Add(kid)
+
+	if qc.IsApproved() {
+		doc, err := parseContractDocument(qc.Document)
+		if err != nil {
+			return responseError(err, "failed to unmarshal the contract document")
+		}
+		if res := callContractFunc(stub, 1, qc.GetID(), doc); res.Status != shim.OK {
+			return res
+		}
+		qc.Status = QuorumContractStatusExecuted
+	}
+	qc.UpdatedTime = ts
+	if err = cb.PutQuorumContract(qc); err != nil {
+		return responseError(err, "failed to update the contract")
+	}
+
+	data, err := json.Marshal(qc)
+	if err != nil {
+		return responseError(err, "failed to marshal the contract")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : contract ID
+// Reject the M-of-N contract. It is cancelled when the rest signers can't reach the quorum.
+func contractReject(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	cb := NewContractStub(stub)
+	qc, err := cb.GetQuorumContract(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the contract")
+	}
+	if qc.Status != QuorumContractStatusPending {
+		return shim.Error("the contract is not pending")
+	}
+	if !qc.Signers.Contains(kid) {
+		return shim.Error("not a signer")
+	}
+	if qc.Rejections != nil && qc.Rejections.Contains(kid) {
+		return shim.Error("already rejected")
+	}
+
+	cancelled, err := cb.Reject(qc, kid)
+	if err != nil {
+		return responseError(err, "failed to update the contract")
+	}
+	if cancelled {
+		doc, err := parseContractDocument(qc.Document)
+		if err != nil {
+			return responseError(err, "failed to unmarshal the contract document")
+		}
+		if res := callContractFunc(stub, 0, qc.GetID(), doc); res.Status != shim.OK {
+			return res
+		}
+	}
+
+	data, err := json.Marshal(qc)
+	if err != nil {
+		return responseError(err, "failed to marshal the contract")
+	}
+	return shim.Success(data)
+}
+
+// fnIdx : 0 = cancel, 1 = execute
+func callContractFunc(stub shim.ChaincodeStubInterface, fnIdx int, cid string, doc []interface{}) peer.Response {
 	dtype := doc[0].(string)
 	if ctrFn := ctrRoutes[dtype][fnIdx]; ctrFn != nil {
 		return ctrFn(stub, cid, doc)
@@ -78,12 +238,55 @@ func contractVoid(stub shim.ChaincodeStubInterface, cid string, doc []interface{
 
 // helpers
 
-func invokeContract(stub shim.ChaincodeStubInterface, doc []interface{}, signers *stringset.Set) peer.Response {
+// createContract creates a contract which needs approvals of 'quorum' signers.
+// If quorum is less than 1 or not less than the number of signers, all signers must approve.
+func createContract(stub shim.ChaincodeStubInterface, docb []byte, expiry int64, signers *stringset.Set, quorum int) (*contract.Contract, error) {
+	return createQuorumContract(stub, docb, expiry, signers, quorum, nil)
+}
+
+// createQuorumContract creates a contract which needs approvals of 'quorum' signers including all the required signers.
+// The M-of-N contract is approved by contract/approve, or by all signers in kiesnet-contract.
+func createQuorumContract(stub shim.ChaincodeStubInterface, docb []byte, expiry int64, signers *stringset.Set, quorum int, required *stringset.Set) (*contract.Contract, error) {
+	con, err := contract.CreateContract(stub, docb, expiry, signers)
+	if err != nil {
+		return nil, err
+	}
+	if quorum > 0 && quorum < signers.Size() {
+		if _, err = NewContractStub(stub).CreateQuorumContract(con, docb, signers, quorum, required); err != nil {
+			return nil, err
+		}
+	}
+	return con, nil
+}
+
+// parseContractDocument parses the contract document.
+func parseContractDocument(data []byte) ([]interface{}, error) {
+	doc := []interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc) < 1 {
+		return nil, errors.New("empty contract document")
+	}
+	if _, ok := doc[0].(string); !ok {
+		return nil, errors.New("invalid contract type")
+	}
+	return doc, nil
+}
+
+// invokeContract creates a contract and returns it as the response.
+// quorum : the number of signers required to approve the contract. (0 = all signers)
+func invokeContract(stub shim.ChaincodeStubInterface, doc []interface{}, signers *stringset.Set, quorum int) peer.Response {
+	return invokeQuorumContract(stub, doc, signers, quorum, nil)
+}
+
+// invokeQuorumContract creates a contract which the required signers must approve, and returns it as the response.
+func invokeQuorumContract(stub shim.ChaincodeStubInterface, doc []interface{}, signers *stringset.Set, quorum int, required *stringset.Set) peer.Response {
 	docb, err := json.Marshal(doc)
 	if err != nil {
 		return responseError(err, "failed to marshal the contract document")
 	}
-	con, err := contract.CreateContract(stub, docb, 0, signers)
+	con, err := createQuorumContract(stub, docb, 0, signers, quorum, required)
 	if err != nil {
 		return responseError(err, "failed to create a contract")
 	}
@@ -30,6 +30,17 @@ func (e NotIssuedTokenError) Error() string {
 	return fmt.Sprintf("the token [%s] is not issued", e.code)
 }
 
+// PausedTokenError _
+type PausedTokenError struct {
+	ResponsibleErrorImpl
+	code string
+}
+
+// Error implements error interface
+func (e PausedTokenError) Error() string {
+	return fmt.Sprintf("the token [%s] is paused", e.code)
+}
+
 // NotInitLastPrunedFeeIDError is an error there is no LastPrunedFeeID state in the world state.
 type NotInitLastPrunedFeeIDError struct {
 	ResponsibleErrorImpl
@@ -127,3 +138,92 @@ func (e NotExistedFeeError) Error() string {
 	}
 	return "the fee does not exist"
 }
+
+// NotExistedAllowanceError _
+type NotExistedAllowanceError struct {
+	ResponsibleErrorImpl
+	owner   string
+	spender string
+}
+
+// Error implements error interface
+func (e NotExistedAllowanceError) Error() string {
+	return fmt.Sprintf("the allowance of [%s] for [%s] does not exist", e.owner, e.spender)
+}
+
+// NotExistedRequestError _
+type NotExistedRequestError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedRequestError) Error() string {
+	return fmt.Sprintf("the request id [%s] does not exist", e.id)
+}
+
+// NotExistedVestingError _
+type NotExistedVestingError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedVestingError) Error() string {
+	return fmt.Sprintf("the vesting id [%s] does not exist", e.id)
+}
+
+// NotExistedHTLCError _
+type NotExistedHTLCError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedHTLCError) Error() string {
+	return fmt.Sprintf("the htlc id [%s] does not exist", e.id)
+}
+
+// NotExistedInvoiceError _
+type NotExistedInvoiceError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedInvoiceError) Error() string {
+	return fmt.Sprintf("the invoice id [%s] does not exist", e.id)
+}
+
+// NotExistedScheduleError _
+type NotExistedScheduleError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedScheduleError) Error() string {
+	return fmt.Sprintf("the schedule id [%s] does not exist", e.id)
+}
+
+// NotExistedQuorumContractError _
+type NotExistedQuorumContractError struct {
+	ResponsibleErrorImpl
+	id string
+}
+
+// Error implements error interface
+func (e NotExistedQuorumContractError) Error() string {
+	return fmt.Sprintf("the M-of-N contract id [%s] does not exist", e.id)
+}
+
+// ExistedOrderIDError _
+type ExistedOrderIDError struct {
+	ResponsibleErrorImpl
+	orderID string
+}
+
+// Error implements error interface
+func (e ExistedOrderIDError) Error() string {
+	return fmt.Sprintf("the order id [%s] already exists", e.orderID)
+}
@@ -0,0 +1,46 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+// BalanceEventName is the name of the chaincode event for balance changes.
+const BalanceEventName = "balance"
+
+// BalanceEventVersion is the schema version of BalanceEvent.
+const BalanceEventVersion = 1
+
+// BalanceEvent is the payload of the 'balance' chaincode event.
+// Fabric keeps only one event per transaction, so it contains all balance changes of the transaction.
+type BalanceEvent struct {
+	Version int              `json:"version"`
+	TxID    string           `json:"txid"`
+	Changes []*BalanceChange `json:"changes"`
+}
+
+// BalanceChange _
+type BalanceChange struct {
+	Token   string         `json:"token"`
+	Account string         `json:"account"` // address
+	Type    BalanceLogType `json:"type"`
+	RID     string         `json:"rid,omitempty"` // relative ID
+	Diff    Amount         `json:"diff"`
+	Fee     *Amount        `json:"fee,omitempty"`
+	Amount  Amount         `json:"amount"` // balance after the change
+	PayID   string         `json:"pay_id,omitempty"`
+}
+
+// NewBalanceChange _
+func NewBalanceChange(token string, log *BalanceLog) *BalanceChange {
+	change := &BalanceChange{
+		Token:   token,
+		Account: log.DOCTYPEID,
+		Type:    log.Type,
+		RID:     log.RID,
+		Diff:    *log.Diff.Copy(),
+		Amount:  *log.Amount.Copy(),
+		PayID:   log.PayID,
+	}
+	if log.Fee != nil {
+		change.Fee = log.Fee.Copy()
+	}
+	return change
+}
@@ -0,0 +1,62 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+// TxStub is the chaincode stub of an invocation. It holds the balance event of the transaction.
+type TxStub struct {
+	shim.ChaincodeStubInterface
+	balanceEvent *BalanceEvent
+}
+
+// NewTxStub _
+func NewTxStub(stub shim.ChaincodeStubInterface) *TxStub {
+	return &TxStub{ChaincodeStubInterface: stub}
+}
+
+// EventStub _
+type EventStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewEventStub _
+func NewEventStub(stub shim.ChaincodeStubInterface) *EventStub {
+	return &EventStub{stub}
+}
+
+// EmitBalanceLog adds the balance change to the event of the transaction and sets the event.
+// If the stub is not a TxStub, the event has only the balance change.
+func (eb *EventStub) EmitBalanceLog(log *BalanceLog) error {
+	addr, err := ParseAddress(log.DOCTYPEID)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse the account address of the balance log")
+	}
+
+	event := &BalanceEvent{
+		Version: BalanceEventVersion,
+		TxID:    eb.stub.GetTxID(),
+		Changes: []*BalanceChange{},
+	}
+	if ts, ok := eb.stub.(*TxStub); ok {
+		if ts.balanceEvent == nil {
+			ts.balanceEvent = event
+		}
+		event = ts.balanceEvent
+	}
+	event.Changes = append(event.Changes, NewBalanceChange(addr.Code, log))
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the balance event")
+	}
+	if err = eb.stub.SetEvent(BalanceEventName, data); err != nil {
+		return errors.Wrap(err, "failed to set the balance event")
+	}
+	return nil
+}
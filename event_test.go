@@ -0,0 +1,92 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// getTestBalanceEvent returns the balance event of the last committed transaction.
+func getTestBalanceEvent(t *testing.T, h *testHarness) *BalanceEvent {
+	t.Helper()
+	if h.event == nil || h.event.EventName != BalanceEventName {
+		t.Fatal("no balance event")
+	}
+	event := &BalanceEvent{}
+	if err := json.Unmarshal(h.event.Payload, event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Version != BalanceEventVersion || event.TxID != h.event.TxId {
+		t.Fatalf("unexpected event header: %s", h.event.Payload)
+	}
+	return event
+}
+
+func TestBalanceEvents(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	event := getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeMint || event.Changes[0].Diff.String() != "10000" {
+		t.Fatalf("unexpected mint event: %s", h.event.Payload)
+	}
+
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	// transfer: receiver and sender changes in a single event
+	h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100")
+	event = getTestBalanceEvent(t, h)
+	if len(event.Changes) != 2 {
+		t.Fatalf("unexpected transfer event: %s", h.event.Payload)
+	}
+	recv, send := event.Changes[0], event.Changes[1]
+	if recv.Token != "PCI" || recv.Account != merchantAddr || recv.RID != aliceAddr || recv.Diff.String() != "100" || recv.Fee != nil {
+		t.Fatalf("unexpected receive change: %s", h.event.Payload)
+	}
+	if send.Account != aliceAddr || send.Diff.String() != "-100" || send.Fee == nil || send.Fee.String() != "1" || send.Amount.String() != "899" {
+		t.Fatalf("unexpected send change: %s", h.event.Payload)
+	}
+
+	// pay
+	data := h.mustInvokeAs(alice, "pay", "", merchantAddr, "200", "order-1")
+	result := &PayResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+	event = getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypePay || event.Changes[0].PayID != result.Pay.PayID {
+		t.Fatalf("unexpected pay event: %s", h.event.Payload)
+	}
+
+	// refund
+	h.mustInvokeAs(merchant, "pay/refund", result.Pay.PayID, "50")
+	event = getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeRefund || event.Changes[0].Account != aliceAddr {
+		t.Fatalf("unexpected refund event: %s", h.event.Payload)
+	}
+
+	// prune
+	h.mustInvokeAs(merchant, "pay/prune", "PCI", "false")
+	event = getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypePrunePay || event.Changes[0].Diff.String() != "147" {
+		t.Fatalf("unexpected prune event: %s", h.event.Payload)
+	}
+
+	// failed transactions emit nothing
+	last := h.event
+	h.invokeAs(alice, "transfer", "", merchantAddr, "100000")
+	if h.event != last {
+		t.Fatal("failed transaction must not emit the event")
+	}
+}
@@ -20,24 +20,148 @@ type Fee struct {
 	CreatedTime *txtime.Time `json:"created_time"`
 }
 
+// FeeExempt is a fee-exempt account of the token
+type FeeExempt struct {
+	DOCTYPEID   string       `json:"@fee_exempt"` // token code
+	Account     string       `json:"account"`
+	CreatedTime *txtime.Time `json:"created_time"`
+}
+
 // FeePolicy _
 type FeePolicy struct {
-	TargetAddress string             `json:"target_address"`
+	TargetAddress string             `json:"target_address"`    // the first target
+	Targets       []FeeTarget        `json:"targets,omitempty"` // empty if the target address is only one
 	Rates         map[string]FeeRate `json:"rates"`
 }
 
-// isValidFn returns true if given fn is defined.
-func isValidFn(fn string) bool {
-	switch fn {
-	case "transfer":
-		fallthrough
-	case "pay": // All valid fee rate type case should fallthrough here, the last one.
-		return true
+// FeeTarget is a recipient of the pruned fees and its share ratio.
+type FeeTarget struct {
+	Address string `json:"address"`
+	Share   int64  `json:"share"` // positive integer
+}
+
+// GetTargets returns the fee targets. If Targets is empty, the target address takes all.
+func (policy *FeePolicy) GetTargets() []FeeTarget {
+	if len(policy.Targets) > 0 {
+		return policy.Targets
+	}
+	return []FeeTarget{{Address: policy.TargetAddress, Share: 1}}
+}
+
+// IsTarget returns true if the address is one of the fee targets.
+func (policy *FeePolicy) IsTarget(addr string) bool {
+	for _, target := range policy.GetTargets() {
+		if target.Address == addr {
+			return true
+		}
 	}
 	return false
 }
 
+// SetTargets sets the fee targets and the first target address.
+func (policy *FeePolicy) SetTargets(targets []FeeTarget) {
+	if len(targets) > 1 {
+		policy.Targets = targets
+	} else {
+		policy.Targets = nil
+	}
+	if len(targets) > 0 {
+		policy.TargetAddress = targets[0].Address
+	} else {
+		policy.TargetAddress = ""
+	}
+}
+
+// ReplaceTarget replaces the target address with the new one. If the new one is already a target, the shares are merged.
+func (policy *FeePolicy) ReplaceTarget(old, addr string) {
+	targets := []FeeTarget{}
+	indexes := map[string]int{}
+	for _, target := range policy.GetTargets() {
+		if target.Address == old {
+			target.Address = addr
+		}
+		if i, ok := indexes[target.Address]; ok {
+			targets[i].Share += target.Share
+			continue
+		}
+		indexes[target.Address] = len(targets)
+		targets = append(targets, target)
+	}
+	policy.SetTargets(targets)
+}
+
+// Distribute splits the amount by the share ratios of the targets.
+// The rounding dust goes to the first target.
+func (policy *FeePolicy) Distribute(amount Amount) []*Amount {
+	targets := policy.GetTargets()
+	total := big.NewInt(0)
+	for _, target := range targets {
+		total.Add(total, big.NewInt(target.Share))
+	}
+	portions := make([]*Amount, len(targets))
+	rest := amount.Copy()
+	for i := len(targets) - 1; i > 0; i-- {
+		portion := new(big.Int).Mul(&amount.Int, big.NewInt(targets[i].Share))
+		portions[i] = NewAmountWithBigInt(portion.Quo(portion, total))
+		rest.Add(portions[i].Copy().Neg())
+	}
+	portions[0] = rest
+	return portions
+}
+
+// ParseFeeTargets parses the target address format string to fee targets.
+// format: "address" or "address1:share1;address2:share2;..."
+func ParseFeeTargets(s string) ([]FeeTarget, error) {
+	targets := []FeeTarget{}
+	if len(s) == 0 {
+		return targets, nil
+	}
+	addrs := map[string]bool{}
+	for _, t := range strings.Split(s, ";") {
+		if len(t) == 0 {
+			continue
+		}
+		as := strings.Split(t, ":")
+		share := int64(1)
+		if len(as) > 1 {
+			var err error
+			share, err = strconv.ParseInt(as[1], 10, 64)
+			if err != nil || share < 1 {
+				return nil, errors.New("failed to parse the share of the fee target")
+			}
+		}
+		if addrs[as[0]] {
+			return nil, errors.New("duplicated fee target")
+		}
+		addrs[as[0]] = true
+		targets = append(targets, FeeTarget{Address: as[0], Share: share})
+	}
+	return targets, nil
+}
+
+// feeFns is the set of fee fn names (fee rate types of the fee policy).
+// A route which charges the fee declares its fn name here, and calculates the fee by FeeStub.CalcFee with it.
+var feeFns = map[string]bool{
+	"account/create":           true, // joint account creation, charged to the creator's PAOT
+	"balance/pending/withdraw": true, // time-locked pending balance, charged to the receiver
+	"pay":                      true, // charged to the merchant
+	"pay/refund":               true, // charged to the merchant
+	"transfer":                 true, // charged to the sender
+}
+
+// flatFeeFns is the set of fee fns which are calculated with no amount, so only the min and flat fee apply. ("0,,min,flat")
+var flatFeeFns = map[string]bool{
+	"account/create": true,
+}
+
+// isValidFn returns true if given fn is defined.
+func isValidFn(fn string) bool {
+	return feeFns[fn]
+}
+
 // ParseFeePolicy parses fee policy format string to FeePolicy struct.
+// format: "fn1=rate[,max[,min[,flat]]];fn2=..." (empty max/min/flat is 0)
+// The rate can be volume brackets: "rate|threshold1:rate1|threshold2:rate2..."
 func ParseFeePolicy(s string) (policy *FeePolicy, err error) {
 	// fees -> map
 	rates := map[string]FeeRate{}
@@ -45,26 +169,20 @@ func ParseFeePolicy(s string) (policy *FeePolicy, err error) {
 	for _, f := range fees {
 		kv := strings.Split(f, "=")
 		if len(kv) > 1 {
-			// We limit fn(= kv[0]) to one of "transfer" or "pay".
+			// We limit fn(= kv[0]) to one of feeFns.
 			if valid := isValidFn(kv[0]); !valid {
 				return nil, errors.New("invalid fee rate type")
 			}
-			rm := strings.Split(kv[1], ",")
-			rate := rm[0]
-			if _, ok := new(big.Rat).SetString(rate); !ok {
-				return nil, errors.New("failed to parse rate")
+			feeRate, err := parseFeeRate(kv[1])
+			if err != nil {
+				return nil, err
 			}
-			max := int64(0)
-			if len(rm) > 1 {
-				max, err = strconv.ParseInt(rm[1], 10, 64)
-				if err != nil {
-					return nil, errors.New("failed to parse max fee amount")
+			if flatFeeFns[kv[0]] {
+				if r, _ := new(big.Rat).SetString(feeRate.Rate); r.Sign() != 0 || feeRate.Tiers != nil {
+					return nil, errors.New("only the min and flat fee amounts are allowed for " + kv[0])
 				}
 			}
-			rates[kv[0]] = FeeRate{
-				Rate:      rate,
-				MaxAmount: max,
-			}
+			rates[kv[0]] = *feeRate
 		}
 	}
 	policy = &FeePolicy{
@@ -73,10 +191,113 @@ func ParseFeePolicy(s string) (policy *FeePolicy, err error) {
 	return
 }
 
+// parseFeeRate parses "rate[,max[,min[,flat]]]" to FeeRate struct.
+func parseFeeRate(s string) (*FeeRate, error) {
+	rm := strings.Split(s, ",")
+	brackets := strings.Split(rm[0], "|")
+	rate := brackets[0]
+	if _, ok := new(big.Rat).SetString(rate); !ok {
+		return nil, errors.New("failed to parse rate")
+	}
+	var tiers []FeeTier
+	for _, b := range brackets[1:] {
+		tr := strings.Split(b, ":")
+		if len(tr) != 2 {
+			return nil, errors.New("failed to parse the fee tier")
+		}
+		threshold, err := strconv.ParseInt(tr[0], 10, 64)
+		if err != nil || threshold <= 0 {
+			return nil, errors.New("failed to parse the threshold of the fee tier")
+		}
+		if len(tiers) > 0 && tiers[len(tiers)-1].Threshold >= threshold {
+			return nil, errors.New("thresholds of the fee tiers must be ascending")
+		}
+		if _, ok := new(big.Rat).SetString(tr[1]); !ok {
+			return nil, errors.New("failed to parse the rate of the fee tier")
+		}
+		tiers = append(tiers, FeeTier{Threshold: threshold, Rate: tr[1]})
+	}
+	amounts := [3]int64{} // max, min, flat
+	for i, names := 0, []string{"max", "min", "flat"}; i < len(names) && i+1 < len(rm); i++ {
+		if len(rm[i+1]) > 0 {
+			a, err := strconv.ParseInt(rm[i+1], 10, 64)
+			if err != nil || a < 0 {
+				return nil, errors.New("failed to parse " + names[i] + " fee amount")
+			}
+			amounts[i] = a
+		}
+	}
+	if amounts[0] > 0 && amounts[1] > amounts[0] {
+		return nil, errors.New("min fee amount must be less than or equal to max fee amount")
+	}
+	return &FeeRate{
+		Rate:       rate,
+		MaxAmount:  amounts[0],
+		MinAmount:  amounts[1],
+		FlatAmount: amounts[2],
+		Tiers:      tiers,
+	}, nil
+}
+
 // FeeRate _
 type FeeRate struct {
-	Rate      string `json:"rate"`       // numeric string of positive decimal fraction
-	MaxAmount int64  `json:"max_amount"` // 0 is unlimit
+	Rate       string    `json:"rate"`                  // numeric string of positive decimal fraction
+	MaxAmount  int64     `json:"max_amount"`            // 0 is unlimit
+	MinAmount  int64     `json:"min_amount,omitempty"`  // 0 is no minimum
+	FlatAmount int64     `json:"flat_amount,omitempty"` // fixed fee added to the rate fee
+	Tiers      []FeeTier `json:"tiers,omitempty"`       // volume brackets, ascending by threshold
+}
+
+// FeeTier is a volume bracket of the fee rate.
+// The rate is applied if the amount is greater than or equal to the threshold.
+type FeeTier struct {
+	Threshold int64  `json:"threshold"`
+	Rate      string `json:"rate"`
+}
+
+// Calc returns the fee of the amount.
+// fee = flat + amount * rate (of the bracket), and it is limited by min and max.
+func (fr FeeRate) Calc(amount Amount) *Amount {
+	rate := fr.Rate
+	for _, tier := range fr.Tiers {
+		if amount.Int.Cmp(big.NewInt(tier.Threshold)) < 0 {
+			break
+		}
+		rate = tier.Rate
+	}
+	// We've already checked validity of rates on ParseFeePolicy()
+	rateRat, _ := new(big.Rat).SetString(rate)
+	// feeAmount = amount * rate
+	feeAmount := amount.Copy().MulRat(rateRat)
+	if feeAmount.Sign() < 0 { // fee must be zero or positive
+		feeAmount = ZeroAmount()
+	}
+	feeAmount.Add(NewAmountWithBigInt(big.NewInt(fr.FlatAmount)))
+	if fr.MinAmount > 0 { // minimum fee
+		minAmount := NewAmountWithBigInt(big.NewInt(fr.MinAmount))
+		if feeAmount.Cmp(minAmount) < 0 {
+			feeAmount = minAmount
+		}
+	}
+	if fr.MaxAmount > 0 { // fee limit
+		maxAmount := NewAmountWithBigInt(big.NewInt(fr.MaxAmount))
+		if feeAmount.Cmp(maxAmount) > 0 { // feeAmount is gt.
+			feeAmount = maxAmount
+		}
+	}
+	return feeAmount
+}
+
+// FeeQuote is the fee preview of transfer/pay
+type FeeQuote struct {
+	Fn         string  `json:"fn"`
+	Payer      string  `json:"payer"` // account address who pays the fee (sender of transfer, receiver of pay)
+	Amount     Amount  `json:"amount"`
+	Fee        *Amount `json:"fee"`
+	FeeExempt  bool    `json:"fee_exempt"`
+	TotalDebit *Amount `json:"total_debit"` // amount to be deducted from the sender's balance
+	Balance    Amount  `json:"balance"`     // sender's balance
+	Sufficient bool    `json:"sufficient"`
 }
 
 // FeeSum stands for amount&state of accumulated fee from Start to End
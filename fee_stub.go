@@ -5,7 +5,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"math/big"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
@@ -139,34 +138,98 @@ func (fb *FeeStub) GetFeeSumByTime(tokenCode string, stime, etime *txtime.Time)
 
 // CalcFee returns calculated fee amount from transfer/pay amount
 func (fb *FeeStub) CalcFee(payer *Address, fn string, amount Amount) (*Amount, error) {
+	fee, _, err := fb.CalcFeeWithExemption(payer, fn, amount)
+	return fee, err
+}
+
+// CalcFeeWithExemption returns calculated fee amount and whether the payer is exempted from the fee.
+func (fb *FeeStub) CalcFeeWithExemption(payer *Address, fn string, amount Amount) (*Amount, bool, error) {
 	token, err := NewTokenStub(fb.stub).GetToken(payer.Code)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if token.FeePolicy != nil {
 		feeRate, ok := token.FeePolicy.Rates[fn]
 		if ok {
 			payerAddr := payer.String()
-			// no fee if the payer is the target account of fee policy or the genesis account.
-			if token.GenesisAccount != payerAddr && token.FeePolicy.TargetAddress != payerAddr {
-				// We've already checked validity of Rate on GetFeePolicy()
-				feeRateRat, _ := new(big.Rat).SetString(feeRate.Rate)
-				// feeAmount = amount * rate
-				feeAmount := amount.Copy().MulRat(feeRateRat)
-				if feeAmount.Sign() < 0 { // fee must be zero or positive
-					return ZeroAmount(), nil
-				}
-				if feeRate.MaxAmount > 0 { // fee limit
-					maxAmount := NewAmountWithBigInt(big.NewInt(feeRate.MaxAmount))
-					if feeAmount.Cmp(maxAmount) > 0 { // feeAmount is gt.
-						return maxAmount, nil
-					}
-				}
-				return feeAmount, nil
+			// no fee if the payer is a target account of fee policy or the genesis account.
+			if token.GenesisAccount == payerAddr || token.FeePolicy.IsTarget(payerAddr) {
+				return ZeroAmount(), true, nil
 			}
+			// no fee if the payer is in the exemption list.
+			exempt, err := fb.IsExempt(payerAddr)
+			if err != nil {
+				return nil, false, err
+			}
+			if exempt {
+				return ZeroAmount(), true, nil
+			}
+			return feeRate.Calc(amount), false, nil
 		} // else no such fn
 	} // else policy does't exist
 
-	return ZeroAmount(), nil
+	return ZeroAmount(), false, nil
+}
+
+// CreateExemptKey _
+func (fb *FeeStub) CreateExemptKey(addr string) string {
+	return "FEX_" + addr
+}
+
+// IsExempt returns true if the account is in the fee exemption list.
+func (fb *FeeStub) IsExempt(addr string) (bool, error) {
+	data, err := fb.stub.GetState(fb.CreateExemptKey(addr))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the fee exempt state")
+	}
+	return data != nil, nil
+}
+
+// CreateExempt adds the account to the fee exemption list.
+func (fb *FeeStub) CreateExempt(addr string) (*FeeExempt, error) {
+	ts, err := txtime.GetTime(fb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	code, _ := ParseCode(addr)
+	exempt := &FeeExempt{
+		DOCTYPEID:   code,
+		Account:     addr,
+		CreatedTime: ts,
+	}
+	data, err := json.Marshal(exempt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the fee exempt")
+	}
+	if err = fb.stub.PutState(fb.CreateExemptKey(addr), data); err != nil {
+		return nil, errors.Wrap(err, "failed to put the fee exempt state")
+	}
+	return exempt, nil
+}
+
+// DeleteExempt removes the account from the fee exemption list.
+func (fb *FeeStub) DeleteExempt(addr string) error {
+	if err := fb.stub.DelState(fb.CreateExemptKey(addr)); err != nil {
+		return errors.Wrap(err, "failed to delete the fee exempt state")
+	}
+	return nil
+}
+
+// GetQueryExempts _
+func (fb *FeeStub) GetQueryExempts(tokenCode, bookmark string, fetchSize int) (*QueryResult, error) {
+	if fetchSize < 1 {
+		fetchSize = FeeFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+	query := CreateQueryFeeExemptsByCode(tokenCode)
+	iter, meta, err := fb.stub.GetQueryResultWithPagination(query, int32(fetchSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	return NewQueryResult(meta, iter)
 }
@@ -0,0 +1,402 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// copyTestTokenMeta returns a copy of testTokenMeta with the given fields.
+func copyTestTokenMeta(fields map[string]string) map[string]string {
+	meta := map[string]string{}
+	for k, v := range testTokenMeta {
+		meta[k] = v
+	}
+	for k, v := range fields {
+		meta[k] = v
+	}
+	return meta
+}
+
+func TestFeePolicyDistribute(t *testing.T) {
+	policy := &FeePolicy{}
+	targets, err := ParseFeeTargets("a:5;b:3;c:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.SetTargets(targets)
+	if policy.TargetAddress != "a" || len(policy.Targets) != 3 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	amount, _ := NewAmount("7")
+	for i, expected := range []string{"4", "2", "1"} {
+		if portion := policy.Distribute(*amount)[i]; portion.String() != expected {
+			t.Fatalf("portion of %s: expected %s, got %s", targets[i].Address, expected, portion.String())
+		}
+	}
+
+	// single target
+	targets, _ = ParseFeeTargets("a")
+	policy.SetTargets(targets)
+	if policy.TargetAddress != "a" || policy.Targets != nil {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	if portions := policy.Distribute(*amount); len(portions) != 1 || portions[0].String() != "7" {
+		t.Fatalf("unexpected portions: %v", portions)
+	}
+
+	// replace the target (merged if the new one is already a target)
+	targets, _ = ParseFeeTargets("a:5;b:3;c:2")
+	policy.SetTargets(targets)
+	policy.ReplaceTarget("a", "c")
+	if policy.TargetAddress != "c" || len(policy.Targets) != 2 || policy.Targets[0].Share != 7 || policy.Targets[1].Address != "b" {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	policy.ReplaceTarget("b", "c")
+	if policy.TargetAddress != "c" || policy.Targets != nil {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	for _, s := range []string{"a:0", "a:-1", "a:x", "a:1;a:2"} {
+		if _, err := ParseFeeTargets(s); err == nil {
+			t.Fatalf("%s must be invalid", s)
+		}
+	}
+}
+
+func TestFeePruneTargets(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	reserve := h.newKID("reserve")
+	partner := h.newKID("partner")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, reserve, partner} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	reserveAddr := testAccountAddr("PCI", reserve)
+	partnerAddr := testAccountAddr("PCI", partner)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	// genesis 50%, reserve 30%, partner 20%
+	h.setTokenMeta("PCI", copyTestTokenMeta(map[string]string{
+		"target_address": genesis + ":5;" + reserveAddr + ":3;" + partnerAddr + ":2",
+	}))
+	h.mustInvokeAs(issuer, "token/update", "PCI")
+	if policy := getTestToken(t, h, "PCI").FeePolicy; policy.TargetAddress != genesis || len(policy.Targets) != 3 {
+		t.Fatalf("unexpected fee policy: %+v", policy)
+	}
+
+	// no fee for the targets
+	h.mustInvokeAs(alice, "transfer", "", reserveAddr, "700")
+	h.mustInvokeAs(reserve, "transfer", "", partnerAddr, "100")
+	assertBalance(t, h, aliceAddr, "293")
+	assertBalance(t, h, reserveAddr, "600")
+
+	if res := h.invokeAs(alice, "fee/prune", "PCI", "false"); res.Status == shim.OK {
+		t.Fatal("fee/prune must be done by a holder of the fee targets")
+	}
+	feeSum := &FeeSum{}
+	if err := json.Unmarshal(h.mustInvokeAs(partner, "fee/prune", "PCI", "false"), feeSum); err != nil {
+		t.Fatal(err)
+	}
+	if feeSum.Count != 1 || feeSum.Sum.String() != "7" {
+		t.Fatalf("unexpected fee prune result: %+v", feeSum)
+	}
+
+	// 7 * 3/10 = 2, 7 * 2/10 = 1, dust to the first target
+	assertBalance(t, h, genesis, "9004")
+	assertBalance(t, h, reserveAddr, "602")
+	assertBalance(t, h, partnerAddr, "101")
+	event := getTestBalanceEvent(t, h)
+	if len(event.Changes) != 3 {
+		t.Fatalf("expected 3 balance changes, got %d", len(event.Changes))
+	}
+	for _, change := range event.Changes {
+		if change.Type != BalanceLogTypePruneFee {
+			t.Fatalf("unexpected balance change: %+v", change)
+		}
+	}
+}
+
+func TestFeeRateCalc(t *testing.T) {
+	policy, err := ParseFeePolicy("transfer=0.01,100;pay=0.005|1000:0.003|10000:0.001,20,5,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		fn, amount, expected string
+	}{
+		{"transfer", "150", "1"},
+		{"transfer", "50000", "100"}, // max
+		{"pay", "100", "5"},          // 2 + 0 => min
+		{"pay", "999", "6"},          // 2 + 4
+		{"pay", "1000", "5"},         // 2 + 3
+		{"pay", "5000", "17"},        // 2 + 15
+		{"pay", "10000", "12"},       // 2 + 10
+		{"pay", "30000", "20"},       // 2 + 30 => max
+	}
+	for _, c := range cases {
+		amount, _ := NewAmount(c.amount)
+		feeRate := policy.Rates[c.fn]
+		if fee := feeRate.Calc(*amount); fee.String() != c.expected {
+			t.Errorf("%s fee of %s: expected %s, got %s", c.fn, c.amount, c.expected, fee.String())
+		}
+	}
+
+	// backward compatible
+	if feeRate := policy.Rates["transfer"]; feeRate.Rate != "0.01" || feeRate.MaxAmount != 100 || feeRate.MinAmount != 0 || feeRate.Tiers != nil {
+		t.Fatalf("unexpected fee rate: %+v", feeRate)
+	}
+
+	for _, s := range []string{
+		"transfer=0.01,10,20",                // min > max
+		"transfer=0.01|1000",                 // no tier rate
+		"transfer=0.01|1000:x",               // invalid tier rate
+		"transfer=0.01|1000:0.005|500:0.001", // not ascending
+		"transfer=0.01,,-1",                  // negative min
+		"account/create=0.01,,,5",            // no amount to rate
+		"account/create=0|1000:0.01,,,5",     // no amount to rate
+	} {
+		if _, err := ParseFeePolicy(s); err == nil {
+			t.Errorf("%s must be invalid", s)
+		}
+	}
+}
+
+func TestFeeExempt(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	if res := h.invokeAs(alice, "fee/exempt/add", aliceAddr); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can add the fee exempt")
+	}
+	h.mustInvokeAs(issuer, "fee/exempt/add", aliceAddr)
+	h.mustInvokeAs(issuer, "fee/exempt/add", merchantAddr)
+	if res := h.invokeAs(issuer, "fee/exempt/add", aliceAddr); res.Status == shim.OK {
+		t.Fatal("already exempted")
+	}
+
+	// transfer
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	if !log.FeeExempt || log.Fee.Sign() != 0 {
+		t.Fatalf("unexpected send log: %+v", log)
+	}
+	assertBalance(t, h, aliceAddr, "900")
+
+	// pay (the fee is charged to the merchant)
+	result := &PayResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "pay", "", merchantAddr, "100"), result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.BalanceLog.FeeExempt || result.Pay.Fee.Sign() != 0 {
+		t.Fatalf("unexpected pay result: %+v", result)
+	}
+
+	// list
+	res := struct {
+		Records []*FeeExempt `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "fee/exempt/list", "PCI"), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 2 || res.Records[0].Account != merchantAddr {
+		t.Fatalf("unexpected fee exempts: %+v", res.Records)
+	}
+
+	// removed
+	h.mustInvokeAs(issuer, "fee/exempt/remove", aliceAddr)
+	if res := h.invokeAs(issuer, "fee/exempt/remove", aliceAddr); res.Status == shim.OK {
+		t.Fatal("not exempted")
+	}
+	log = &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100"), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.FeeExempt || log.Fee.String() != "1" {
+		t.Fatalf("unexpected send log: %+v", log)
+	}
+	assertBalance(t, h, aliceAddr, "699")
+}
+
+func TestFeeQuote(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	quote := func(kid string, params ...string) *FeeQuote {
+		t.Helper()
+		q := &FeeQuote{}
+		if err := json.Unmarshal(h.mustInvokeAs(kid, "fee/quote", params...), q); err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+
+	// transfer: amount + fee
+	q := quote(alice, "", merchantAddr, "transfer", "990")
+	if q.Payer != aliceAddr || q.Fee.String() != "9" || q.TotalDebit.String() != "999" || !q.Sufficient {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+	if q = quote(alice, "", merchantAddr, "transfer", "995"); q.Sufficient {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+
+	// pay: the fee is charged to the merchant
+	q = quote(alice, aliceAddr, merchantAddr, "pay", "1000")
+	if q.Payer != merchantAddr || q.Fee.String() != "20" || q.TotalDebit.String() != "1000" || !q.Sufficient {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+
+	// the same as the invoke
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer", "", merchantAddr, "990"), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Fee.String() != "9" {
+		t.Fatalf("unexpected fee: %s", log.Fee.String())
+	}
+
+	// exempted
+	if q = quote(issuer, genesis, merchantAddr, "transfer", "100"); !q.FeeExempt || q.Fee.Sign() != 0 || q.TotalDebit.String() != "100" {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+
+	if res := h.invokeAs(alice, "fee/quote", "", merchantAddr, "mint", "100"); res.Status == shim.OK {
+		t.Fatal("invalid fn")
+	}
+}
+
+func TestFeeMoreFns(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", copyTestTokenMeta(map[string]string{
+		"fee": "transfer=0.01;pay=0.02;pay/refund=0,,,1;balance/pending/withdraw=0.01;account/create=0,,,5",
+	}))
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, merchant} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+	h.mustInvokeAs(issuer, "transfer", genesis, merchantAddr, "10")
+
+	// account/create : joint account, charged to the creator's PAOT
+	if res := h.invokeAs(bob, "account/create", "PCI", aliceAddr); res.Status == shim.OK {
+		t.Fatal("not enough balance for the fee")
+	}
+	con := map[string]interface{}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "account/create", "PCI", bobAddr), &con); err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{alice, bob} {
+		if res := h.approveContract(con["@contract"].(string), kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	assertBalance(t, h, aliceAddr, "995")
+	if event := getTestBalanceEvent(t, h); len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeFee || event.Changes[0].Diff.String() != "-5" {
+		t.Fatalf("unexpected balance event: %+v", event)
+	}
+	fees := struct {
+		Records []*Fee `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "fee/list", "PCI"), &fees); err != nil {
+		t.Fatal(err)
+	}
+	created := false
+	for _, fee := range fees.Records {
+		if fee.Account == aliceAddr && fee.Amount.String() == "5" {
+			created = true
+		}
+	}
+	if !created {
+		t.Fatalf("the account/create fee is not collected: %+v", fees.Records)
+	}
+
+	// balance/pending/withdraw : time-locked transfer, deducted from the withdrawn amount
+	pendingTime := strconv.FormatInt(h.clock.Add(time.Minute).Unix(), 10)
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "100", "", pendingTime)
+	pbID := fmt.Sprintf("tx%08d", h.seq) // pending balance ID is the txid
+	assertBalance(t, h, aliceAddr, "894")
+	h.advance(2 * time.Minute)
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "balance/pending/withdraw", pbID), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Diff.String() != "99" || log.Fee == nil || log.Fee.String() != "1" {
+		t.Fatalf("unexpected withdraw log: %+v", log)
+	}
+	assertBalance(t, h, bobAddr, "99")
+
+	// pay/refund : deducted from the returned fee
+	result := &PayResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "pay", "", merchantAddr, "100"), result); err != nil {
+		t.Fatal(err)
+	}
+	h.mustInvokeAs(merchant, "pay/refund", result.Pay.PayID, "100")
+	assertBalance(t, h, aliceAddr, "894")
+	paySum := &PaySum{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "pay/prune", "PCI", "false"), paySum); err != nil {
+		t.Fatal(err)
+	}
+	if paySum.Sum.Sign() != 0 || paySum.Fee.String() != "1" {
+		t.Fatalf("unexpected pay prune result: %+v", paySum)
+	}
+	assertBalance(t, h, merchantAddr, "9")
+
+	// all fees are collected to the fee utxos
+	feeSum := &FeeSum{}
+	if err := json.Unmarshal(h.mustInvokeAs(issuer, "fee/prune", "PCI", "false"), feeSum); err != nil {
+		t.Fatal(err)
+	}
+	// 5 (account/create) + 1 (transfer) + 1 (balance/pending/withdraw) + 1 (pay - returned + pay/refund)
+	if feeSum.Count != 4 || feeSum.Sum.String() != "8" {
+		t.Fatalf("unexpected fee prune result: %+v", feeSum)
+	}
+}
@@ -97,9 +97,99 @@ func feeList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	return shim.Success(data)
 }
 
+// Preview the fee of transfer/pay before submitting it.
+// params[0] : sender's account address (empty string = personal account)
+// params[1] : receiver's account address
+// params[2] : fn ("transfer" or "pay")
+// params[3] : amount (big int string or decimal string)
+func feeQuote(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 4 {
+		return shim.Error("incorrect number of parameters. expecting 4")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, false)
+	if nil != err {
+		return shim.Error(err.Error())
+	}
+
+	// addresses
+	rAddr, err := ParseAddress(params[1])
+	if nil != err {
+		return responseError(err, "failed to parse the receiver's account address")
+	}
+	var sAddr *Address
+	if len(params[0]) > 0 {
+		sAddr, err = ParseAddress(params[0])
+		if nil != err {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// fee payer
+	fn := params[2]
+	var payer *Address
+	switch fn {
+	case "transfer":
+		payer = sAddr
+	case "pay":
+		payer = rAddr
+	default:
+		return shim.Error("invalid fee rate type")
+	}
+
+	// amount
+	amount, err := NewTokenStub(stub).ParseAmount(rAddr.Code, params[3])
+	if nil != err {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	// sender balance
+	sBal, err := NewBalanceStub(stub).GetBalance(sAddr.String())
+	if nil != err {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	fee, feeExempt, err := NewFeeStub(stub).CalcFeeWithExemption(payer, fn, *amount)
+	if nil != err {
+		return responseError(err, "failed to get the fee amount")
+	}
+
+	totalDebit := amount.Copy()
+	if payer == sAddr {
+		totalDebit.Add(fee)
+	}
+
+	quote := &FeeQuote{
+		Fn:         fn,
+		Payer:      payer.String(),
+		Amount:     *amount,
+		Fee:        fee,
+		FeeExempt:  feeExempt,
+		TotalDebit: totalDebit,
+		Balance:    sBal.Amount,
+		Sufficient: sBal.Amount.Cmp(totalDebit) >= 0,
+	}
+
+	data, err := json.Marshal(quote)
+	if nil != err {
+		return responseError(err, "failed to marshal the fee quote")
+	}
+	return shim.Success(data)
+}
+
 // prune the fees from last fee time to end_time.
 // if end_time is not provided, prune to 10 mins lesser than current time(if ten_minutes_flag is set to true).
-// Only holder of FeePolicy.TargetAddress is able to prune.
+// The fee sum is distributed to the fee targets by their share ratios. (rounding dust goes to the first target)
+// Only holders of the fee targets are able to prune.
 // ISSUE : Shoud this be in token_tx.go? And should route name be token/fee/prune?
 // params[0] : token code
 // params[1] : 10 minutes limit flag. if the value is true, 10 minutes check is activated.
@@ -143,13 +233,21 @@ func feePrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 
 	// If Token.FeePolicy is not nil, Token.FeePolicy.TargetAddress is never empty.
 	// ISSUE : We MUST validate target address before(tokenUpdate)
-	addr, _ := ParseAddress(token.FeePolicy.TargetAddress) // err is nil
+	targets := token.FeePolicy.GetTargets()
 	ab := NewAccountStub(stub, code)
-	account, err := ab.GetAccount(addr)
-	if nil != err {
-		return responseError(err, "failed to get the target account")
+	accounts := make([]AccountInterface, len(targets))
+	authorized := false
+	for i, target := range targets {
+		addr, _ := ParseAddress(target.Address) // err is nil
+		accounts[i], err = ab.GetAccount(addr)
+		if nil != err {
+			return responseError(err, "failed to get the target account")
+		}
+		if accounts[i].HasHolder(kid) {
+			authorized = true
+		}
 	}
-	if !account.HasHolder(kid) { // authority
+	if !authorized { // authority
 		return shim.Error("no authority")
 	}
 	// ISSUE : What if target account is suspended?
@@ -227,19 +325,34 @@ func feePrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		return responseError(err, "failed to get fees to prune")
 	}
 
-	bb := NewBalanceStub(stub)
-	bal, err := bb.GetBalance(account.GetID())
-	if nil != err {
-		return responseError(err, "failed to get the target account balance")
-	}
-
 	if feeSum.Count > 0 {
-		bal.Amount.Add(feeSum.Sum)
-		bal.UpdatedTime = ts
-		err = bb.PutBalance(bal)
-		if nil != err {
-			return responseError(err, "failed to update genesis account balance")
+		// distribute to the targets
+		bb := NewBalanceStub(stub)
+		portions := token.FeePolicy.Distribute(*feeSum.Sum)
+		for i, account := range accounts {
+			if portions[i].Sign() == 0 {
+				continue
+			}
+			bal, err := bb.GetBalance(account.GetID())
+			if nil != err {
+				return responseError(err, "failed to get the target account balance")
+			}
+			bal.Amount.Add(portions[i])
+			bal.UpdatedTime = ts
+			err = bb.PutBalance(bal)
+			if nil != err {
+				return responseError(err, "failed to update the target account balance")
+			}
+
+			// balance log
+			pruneLog := NewBalancePruneFeeLog(bal, *portions[i], feeSum.Start, feeSum.End)
+			pruneLog.CreatedTime = ts
+			err = bb.PutBalanceLog(pruneLog)
+			if nil != err {
+				return responseError(err, "failed to save balance log")
+			}
 		}
+
 		lastPrunedFeeID.FeeID = feeSum.End
 		lastPrunedFeeID.UpdatedTime = ts
 		err = lb.PutLastPrunedFeeID(lastPrunedFeeID)
@@ -247,14 +360,6 @@ func feePrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 			return responseError(err, "failed to update the last pruned fee id")
 		}
 
-		// balance log
-		pruneLog := NewBalancePruneFeeLog(bal, *feeSum.Sum, feeSum.Start, feeSum.End)
-		pruneLog.CreatedTime = ts
-		err = bb.PutBalanceLog(pruneLog)
-		if nil != err {
-			return responseError(err, "failed to save balance log")
-		}
-
 		data, err := json.Marshal(feeSum)
 		if nil != err {
 			return responseError(err, "failed to marshal the fee prune result")
@@ -269,3 +374,192 @@ func feePrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	return shim.Error("found no record to prune.")
 
 }
+
+// add the account to the fee exemption list (genesis account holders)
+// params[0] : account address
+func feeExemptAdd(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+	return setFeeExempt(stub, params[0], true)
+}
+
+// params[0] : token code
+// params[1] : optional. bookmark
+// params[2] : optional. fetch size (if less than 1, default size. max 200)
+func feeExemptList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if nil != err {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	_, err = kid.GetID(stub, false)
+	if nil != err {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := ""
+	fetchSize := 0
+	if len(params) > 1 {
+		bookmark = params[1]
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if nil != err {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	res, err := NewFeeStub(stub).GetQueryExempts(code, bookmark, fetchSize)
+	if nil != err {
+		return responseError(err, "failed to get fee exempts")
+	}
+
+	data, err := json.Marshal(res)
+	if nil != err {
+		return responseError(err, "failed to marshal fee exempts")
+	}
+	return shim.Success(data)
+}
+
+// remove the account from the fee exemption list (genesis account holders)
+// params[0] : account address
+func feeExemptRemove(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+	return setFeeExempt(stub, params[0], false)
+}
+
+// helpers
+
+// setFeeExempt adds(removes) the account to(from) the fee exemption list or creates a contract. (genesis account holders only)
+func setFeeExempt(stub shim.ChaincodeStubInterface, address string, exempt bool) peer.Response {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return responseError(err, "failed to parse the account address")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// token
+	token, err := NewTokenStub(stub).GetToken(addr.Code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	ab := NewAccountStub(stub, addr.Code)
+
+	// account
+	if exempt {
+		if _, err = ab.GetAccount(addr); err != nil {
+			return responseError(err, "failed to get the account")
+		}
+	}
+	fb := NewFeeStub(stub)
+	existed, err := fb.IsExempt(addr.String())
+	if err != nil {
+		return responseError(err, "failed to get the fee exempt")
+	}
+	if existed == exempt {
+		if exempt {
+			return shim.Error("already exempted")
+		}
+		return shim.Error("not exempted")
+	}
+
+	// genesis account
+	gAddr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := ab.GetAccount(gAddr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !genesis.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+
+	jac := genesis.(*JointAccount)
+	if jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"fee/exempt/remove", addr.String()}
+		if exempt {
+			doc[0] = "fee/exempt/add"
+		}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	if !exempt {
+		if err = fb.DeleteExempt(addr.String()); err != nil {
+			return responseError(err, "failed to remove the fee exempt")
+		}
+		return shim.Success(nil)
+	}
+
+	fex, err := fb.CreateExempt(addr.String())
+	if err != nil {
+		return responseError(err, "failed to add the fee exempt")
+	}
+
+	data, err := json.Marshal(fex)
+	if err != nil {
+		return responseError(err, "failed to marshal the fee exempt")
+	}
+	return shim.Success(data)
+}
+
+// contract callbacks
+
+// doc: ["fee/exempt/add", address]
+func executeFeeExemptAdd(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 2 {
+		return shim.Error("invalid contract document")
+	}
+
+	fb := NewFeeStub(stub)
+	addr := doc[1].(string)
+	existed, err := fb.IsExempt(addr)
+	if err != nil {
+		return responseError(err, "failed to get the fee exempt")
+	}
+	if existed {
+		return shim.Error("already exempted")
+	}
+
+	if _, err = fb.CreateExempt(addr); err != nil {
+		return responseError(err, "failed to add the fee exempt")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["fee/exempt/remove", address]
+func executeFeeExemptRemove(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 2 {
+		return shim.Error("invalid contract document")
+	}
+
+	fb := NewFeeStub(stub)
+	addr := doc[1].(string)
+	existed, err := fb.IsExempt(addr)
+	if err != nil {
+		return responseError(err, "failed to get the fee exempt")
+	}
+	if !existed {
+		return shim.Error("not exempted")
+	}
+
+	if err = fb.DeleteExempt(addr); err != nil {
+		return responseError(err, "failed to remove the fee exempt")
+	}
+
+	return shim.Success(nil)
+}
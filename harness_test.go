@@ -0,0 +1,721 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+	"github.com/key-inside/kiesnet-ccpkg/contract"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// In-process test harness.
+//
+// The token chaincode runs on a shim.MockStub, and the external chaincodes it
+// depends on (kiesnet-id, knt-{code} and kiesnet-contract) are replaced with
+// local stand-ins registered as peer chaincodes of the mock stub.
+// Each invocation behaves like a Fabric transaction: reads see committed state
+// only, writes are committed when the response is OK and discarded otherwise.
+// CouchDB rich queries are evaluated by a small selector engine.
+
+// testHarness _
+type testHarness struct {
+	t        *testing.T
+	mock     *shim.MockStub
+	id       *fakeKID
+	contract *fakeContract
+	knts     map[string]*fakeKNT
+	clock    time.Time            // timestamp of the last transaction
+	seq      int                  // transaction sequence
+	event    *peer.ChaincodeEvent // chaincode event of the last committed transaction
+}
+
+// newTestHarness _
+func newTestHarness(t *testing.T) *testHarness {
+	h := &testHarness{
+		t:    t,
+		mock: shim.NewMockStub("kiesnet-token", new(Chaincode)),
+		knts: map[string]*fakeKNT{},
+		// txtime.GetTime accepts timestamps within ±5 minutes of the wall clock.
+		// Starting in the past leaves room for the clock to move forward.
+		clock: time.Now().UTC().Add(-4 * time.Minute).Truncate(time.Second),
+	}
+	h.id = &fakeKID{}
+	h.mock.MockPeerChaincode(kid.KIDCfg.CC, shim.NewMockStub(kid.KIDCfg.CC, h.id))
+	h.contract = &fakeContract{h: h, contracts: map[string]*fakeContractDoc{}}
+	h.mock.MockPeerChaincode(contract.ContractCfg.CC, shim.NewMockStub(contract.ContractCfg.CC, h.contract))
+	return h
+}
+
+// newKID returns a deterministic kiesnet ID (40 hex) for the name.
+func (h *testHarness) newKID(name string) string {
+	return fmt.Sprintf("%040x", name)
+}
+
+// setTokenMeta registers the knt-{code} chaincode which serves the meta.
+func (h *testHarness) setTokenMeta(code string, meta map[string]string) {
+	if knt, ok := h.knts[code]; ok {
+		knt.meta = meta
+		return
+	}
+	knt := &fakeKNT{meta: meta}
+	h.knts[code] = knt
+	ccid := "knt-" + strings.ToLower(code)
+	h.mock.MockPeerChaincode(ccid, shim.NewMockStub(ccid, knt))
+}
+
+// advance moves the transaction clock forward.
+func (h *testHarness) advance(d time.Duration) {
+	h.clock = h.clock.Add(d)
+}
+
+// invokeAs invokes the token chaincode as the kiesnet ID.
+func (h *testHarness) invokeAs(kid string, fn string, params ...string) peer.Response {
+	return h.invokeWithProposal(kid, &peer.SignedProposal{}, fn, params...)
+}
+
+// mustInvokeAs invokes the token chaincode and fails the test if the response is not OK.
+func (h *testHarness) mustInvokeAs(kid string, fn string, params ...string) []byte {
+	h.t.Helper()
+	res := h.invokeAs(kid, fn, params...)
+	if res.Status != shim.OK {
+		h.t.Fatalf("%s %v: %s", fn, params, res.Message)
+	}
+	return res.Payload
+}
+
+// invokeWithTransient invokes the token chaincode as the kiesnet ID with the transient map.
+func (h *testHarness) invokeWithTransient(kid string, transient map[string][]byte, fn string, params ...string) peer.Response {
+	return h.invoke(kid, &peer.SignedProposal{}, transient, fn, params...)
+}
+
+// mustInvokeWithTransient invokes the token chaincode with the transient map and fails the test if the response is not OK.
+func (h *testHarness) mustInvokeWithTransient(kid string, transient map[string][]byte, fn string, params ...string) []byte {
+	h.t.Helper()
+	res := h.invokeWithTransient(kid, transient, fn, params...)
+	if res.Status != shim.OK {
+		h.t.Fatalf("%s %v: %s", fn, params, res.Message)
+	}
+	return res.Payload
+}
+
+func (h *testHarness) invokeWithProposal(kid string, sp *peer.SignedProposal, fn string, params ...string) peer.Response {
+	return h.invoke(kid, sp, nil, fn, params...)
+}
+
+func (h *testHarness) invoke(kid string, sp *peer.SignedProposal, transient map[string][]byte, fn string, params ...string) peer.Response {
+	h.seq++
+	h.clock = h.clock.Add(time.Second)
+	txid := fmt.Sprintf("tx%08d", h.seq)
+
+	args := [][]byte{[]byte(fn)}
+	for _, p := range params {
+		args = append(args, []byte(p))
+	}
+	stub := &testStub{
+		MockStub:  h.mock,
+		args:      args,
+		sp:        sp,
+		transient: transient,
+		writes:    map[string][]byte{},
+		order:     list.New(),
+	}
+
+	h.id.kid = kid
+	h.mock.MockTransactionStart(txid)
+	h.mock.TxTimestamp = &timestamp.Timestamp{Seconds: h.clock.Unix(), Nanos: int32(h.clock.Nanosecond())}
+	res := new(Chaincode).Invoke(stub)
+	if res.Status == shim.OK {
+		stub.commit()
+		h.event = stub.event
+	} else {
+		h.contract.discard(txid)
+	}
+	h.mock.MockTransactionEnd(txid)
+	h.id.kid = ""
+	return res
+}
+
+// approveContract approves the contract as the signer.
+// When every signer has approved, kiesnet-contract calls back 'contract/execute'.
+// M-of-N contracts are approved by 'contract/approve' of the token chaincode instead.
+func (h *testHarness) approveContract(cid, signer string) peer.Response {
+	c, ok := h.contract.contracts[cid]
+	if !ok {
+		return shim.Error("contract not found")
+	}
+	if !c.hasSigner(signer) {
+		return shim.Error("not a signer")
+	}
+	// M-of-N contracts are approved by the token chaincode
+	if h.getState(NewContractStub(nil).CreateKey(cid)) != nil {
+		return h.invokeAs(signer, "contract/approve", cid)
+	}
+	c.approved[signer] = true
+	if len(c.approved) < len(c.Signers) { // kiesnet-contract needs all signers
+		return shim.Success(nil)
+	}
+	res := h.invokeWithProposal(signer, h.contractProposal(), "contract/execute", cid, c.Document)
+	if res.Status != shim.OK {
+		delete(c.approved, signer)
+	}
+	return res
+}
+
+// cancelContract cancels the contract as the signer. It calls back 'contract/cancel'.
+func (h *testHarness) cancelContract(cid, signer string) peer.Response {
+	c, ok := h.contract.contracts[cid]
+	if !ok {
+		return shim.Error("contract not found")
+	}
+	if !c.hasSigner(signer) {
+		return shim.Error("not a signer")
+	}
+	return h.invokeWithProposal(signer, h.contractProposal(), "contract/cancel", cid, c.Document)
+}
+
+// contractProposal returns a signed proposal whose target chaincode is kiesnet-contract.
+func (h *testHarness) contractProposal() *peer.SignedProposal {
+	h.t.Helper()
+	cis := &peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			Type:        peer.ChaincodeSpec_GOLANG,
+			ChaincodeId: &peer.ChaincodeID{Name: contract.ContractCfg.CC},
+			Input:       &peer.ChaincodeInput{},
+		},
+	}
+	prop, _, err := utils.CreateChaincodeProposal(common.HeaderType_ENDORSER_TRANSACTION, "testchannel", cis, nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	data, err := utils.GetBytesProposal(prop)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return &peer.SignedProposal{ProposalBytes: data}
+}
+
+// getState returns the committed state.
+func (h *testHarness) getState(key string) []byte {
+	return h.mock.State[key]
+}
+
+// testStub wraps the MockStub with a transaction write set and rich queries.
+type testStub struct {
+	*shim.MockStub
+	args      [][]byte
+	sp        *peer.SignedProposal
+	transient map[string][]byte
+	writes    map[string][]byte // nil value means deletion
+	order     *list.List        // write order
+	event     *peer.ChaincodeEvent
+	paginated bool // a paginated query is executed. Fabric allows it only in read-only transactions
+}
+
+// GetArgs override
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs override
+func (s *testStub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// GetFunctionAndParameters override
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) < 1 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetSignedProposal override
+func (s *testStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return s.sp, nil
+}
+
+// GetTransient override
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	if s.transient == nil {
+		return map[string][]byte{}, nil
+	}
+	return s.transient, nil
+}
+
+// PutState override - writes are visible after commit
+func (s *testStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	if s.paginated {
+		return errPaginatedWrite
+	}
+	if _, ok := s.writes[key]; !ok {
+		s.order.PushBack(key)
+	}
+	s.writes[key] = value
+	return nil
+}
+
+// DelState override - deletions are visible after commit
+func (s *testStub) DelState(key string) error {
+	if s.paginated {
+		return errPaginatedWrite
+	}
+	if _, ok := s.writes[key]; !ok {
+		s.order.PushBack(key)
+	}
+	s.writes[key] = nil
+	return nil
+}
+
+// SetEvent override - only the last event of the transaction is kept like Fabric
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be nil string")
+	}
+	s.event = &peer.ChaincodeEvent{EventName: name, Payload: payload, TxId: s.TxID}
+	return nil
+}
+
+// GetQueryResult override
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	kvs, err := s.query(query)
+	if err != nil {
+		return nil, err
+	}
+	return &testQueryIterator{kvs: kvs}, nil
+}
+
+// errPaginatedWrite is the error of Fabric when a transaction writes after a paginated query (or vice versa).
+var errPaginatedWrite = fmt.Errorf("txSimulator: transaction with paginated queries is read-only. Writes are not allowed")
+
+// GetQueryResultWithPagination override - only for read-only transactions like Fabric
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if len(s.writes) > 0 {
+		return nil, nil, errPaginatedWrite
+	}
+	s.paginated = true
+	kvs, err := s.query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset := 0
+	if bookmark != "" {
+		if offset, err = strconv.Atoi(bookmark); err != nil {
+			return nil, nil, fmt.Errorf("invalid bookmark")
+		}
+	}
+	if offset > len(kvs) {
+		offset = len(kvs)
+	}
+	end := offset + int(pageSize)
+	if end > len(kvs) {
+		end = len(kvs)
+	}
+	meta := &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(end - offset),
+		Bookmark:            strconv.Itoa(end),
+	}
+	return &testQueryIterator{kvs: kvs[offset:end]}, meta, nil
+}
+
+func (s *testStub) commit() {
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if value := s.writes[key]; value != nil {
+			s.MockStub.PutState(key, value)
+		} else {
+			s.MockStub.DelState(key)
+		}
+	}
+}
+
+// query evaluates a CouchDB mango query against the committed state.
+// It supports equality, $exists, $gt, $gte, $lt, $lte, $ne, $in, $regex, $and, $or, sort and limit.
+// use_index is ignored.
+func (s *testStub) query(query string) ([]*queryresult.KV, error) {
+	q := struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []interface{}          `json:"sort"`
+		Limit    int                    `json:"limit"`
+	}{}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	type doc struct {
+		kv  *queryresult.KV
+		obj map[string]interface{}
+	}
+	docs := []doc{}
+	for e := s.MockStub.Keys.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value := s.MockStub.State[key]
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(value, &obj); err != nil {
+			continue // not a JSON document
+		}
+		if matchSelector(obj, q.Selector) {
+			docs = append(docs, doc{&queryresult.KV{Namespace: s.MockStub.Name, Key: key, Value: value}, obj})
+		}
+	}
+
+	// sort
+	type sortField struct {
+		name string
+		desc bool
+	}
+	fields := []sortField{}
+	for _, f := range q.Sort {
+		switch f := f.(type) {
+		case string:
+			fields = append(fields, sortField{f, false})
+		case map[string]interface{}:
+			for name, dir := range f {
+				fields = append(fields, sortField{name, dir == "desc"})
+			}
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, f := range fields {
+			c := compareValues(docs[i].obj[f.name], docs[j].obj[f.name])
+			if c != 0 {
+				return (c < 0) != f.desc
+			}
+		}
+		return false
+	})
+
+	if q.Limit > 0 && len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+	}
+
+	kvs := []*queryresult.KV{}
+	for _, d := range docs {
+		kvs = append(kvs, d.kv)
+	}
+	return kvs, nil
+}
+
+func matchSelector(obj map[string]interface{}, selector map[string]interface{}) bool {
+	for field, cond := range selector {
+		switch field {
+		case "$and":
+			for _, sub := range cond.([]interface{}) {
+				if !matchSelector(obj, sub.(map[string]interface{})) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+			for _, sub := range cond.([]interface{}) {
+				if matchSelector(obj, sub.(map[string]interface{})) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			value, exists := obj[field]
+			if !matchCondition(value, exists, cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchCondition(value interface{}, exists bool, cond interface{}) bool {
+	ops, ok := cond.(map[string]interface{})
+	if !ok { // equality
+		return exists && compareValues(value, cond) == 0
+	}
+	for op, arg := range ops {
+		switch op {
+		case "$exists":
+			if exists != arg.(bool) {
+				return false
+			}
+		case "$eq":
+			if !exists || compareValues(value, arg) != 0 {
+				return false
+			}
+		case "$ne":
+			if exists && compareValues(value, arg) == 0 {
+				return false
+			}
+		case "$gt":
+			if !exists || compareValues(value, arg) <= 0 {
+				return false
+			}
+		case "$gte":
+			if !exists || compareValues(value, arg) < 0 {
+				return false
+			}
+		case "$lt":
+			if !exists || compareValues(value, arg) >= 0 {
+				return false
+			}
+		case "$lte":
+			if !exists || compareValues(value, arg) > 0 {
+				return false
+			}
+		case "$regex":
+			str, ok := value.(string)
+			if !exists || !ok || !regexp.MustCompile(arg.(string)).MatchString(str) {
+				return false
+			}
+		case "$in":
+			found := false
+			for _, v := range arg.([]interface{}) {
+				if exists && compareValues(value, v) == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default: // nested object
+			sub, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			v, e := sub[op]
+			if !matchCondition(v, e, arg) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareValues compares JSON values in CouchDB collation order (null < bool < number < string < others).
+func compareValues(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if !a {
+			return -1
+		}
+		return 1
+	case float64:
+		b := b.(float64)
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// testQueryIterator _
+type testQueryIterator struct {
+	kvs []*queryresult.KV
+	i   int
+}
+
+// HasNext _
+func (iter *testQueryIterator) HasNext() bool {
+	return iter.i < len(iter.kvs)
+}
+
+// Next _
+func (iter *testQueryIterator) Next() (*queryresult.KV, error) {
+	if !iter.HasNext() {
+		return nil, fmt.Errorf("no more records")
+	}
+	kv := iter.kvs[iter.i]
+	iter.i++
+	return kv, nil
+}
+
+// Close _
+func (iter *testQueryIterator) Close() error {
+	return nil
+}
+
+// fakeKID stands in for the kiesnet-id chaincode.
+// It returns the KID of the current invoker.
+type fakeKID struct {
+	kid string
+}
+
+// Init _
+func (cc *fakeKID) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+// Invoke _
+func (cc *fakeKID) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	if fn, _ := stub.GetFunctionAndParameters(); fn != "kid" {
+		return shim.Error("unknown function: [" + fn + "]")
+	}
+	if cc.kid == "" {
+		return shim.Error("no identity")
+	}
+	return shim.Success([]byte(cc.kid))
+}
+
+// fakeKNT stands in for the knt-{code} chaincode.
+// 'mint' and 'burn' allow the requested amount as it is.
+type fakeKNT struct {
+	meta map[string]string
+}
+
+// Init _
+func (cc *fakeKNT) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+// Invoke _
+func (cc *fakeKNT) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	fn, params := stub.GetFunctionAndParameters()
+	switch fn {
+	case "token":
+		data, err := json.Marshal(cc.meta)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(data)
+	case "mint", "burn": // [supply, balance, amount]
+		if len(params) != 3 {
+			return shim.Error("incorrect number of parameters. expecting 3")
+		}
+		return shim.Success([]byte(params[2]))
+	}
+	return shim.Error("unknown function: [" + fn + "]")
+}
+
+// fakeContractDoc _
+type fakeContractDoc struct {
+	ID       string
+	Document string
+	Signers  []string
+	TxID     string
+	approved map[string]bool
+}
+
+func (c *fakeContractDoc) hasSigner(kid string) bool {
+	for _, s := range c.Signers {
+		if s == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeContract stands in for the kiesnet-contract chaincode.
+// Contracts are approved and cancelled through the harness.
+type fakeContract struct {
+	h         *testHarness
+	seq       int
+	contracts map[string]*fakeContractDoc
+}
+
+// Init _
+func (cc *fakeContract) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+// Invoke _
+// args : ["create", document, expiry, signers...]
+func (cc *fakeContract) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	args := stub.GetStringArgs()
+	if len(args) < 1 || args[0] != "create" {
+		return shim.Error("unknown function")
+	}
+	if len(args) < 5 {
+		return shim.Error("signers must be 2+")
+	}
+	expiry, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return shim.Error("invalid expiry")
+	}
+	if expiry <= 0 {
+		expiry = 15 * 24 * 60 * 60 // default 15 days
+	}
+
+	cc.seq++
+	c := &fakeContractDoc{
+		ID:       fmt.Sprintf("CTR%08d", cc.seq),
+		Document: args[1],
+		Signers:  args[3:],
+		TxID:     stub.GetTxID(),
+		approved: map[string]bool{},
+	}
+	cc.contracts[c.ID] = c
+
+	created := txtime.New(cc.h.clock)
+	data, err := json.Marshal(map[string]interface{}{
+		"@contract":    c.ID,
+		"document":     c.Document,
+		"signers":      c.Signers,
+		"created_time": created,
+		"expiry_time":  txtime.New(cc.h.clock.Add(time.Duration(expiry) * time.Second)),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(data)
+}
+
+// discard removes contracts created by the failed transaction.
+func (cc *fakeContract) discard(txid string) {
+	for id, c := range cc.contracts {
+		if c.TxID == txid {
+			delete(cc.contracts, id)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// HTLCStatus _
+type HTLCStatus int8
+
+const (
+	// HTLCStatusLocked _
+	HTLCStatusLocked HTLCStatus = iota
+	// HTLCStatusClaimed the receiver claimed with the preimage
+	HTLCStatusClaimed
+	// HTLCStatusRefunded the sender refunded after the time lock
+	HTLCStatusRefunded
+)
+
+// HTLC is the hash time-locked amount of the sender.
+// The receiver can claim it with the preimage of the hash lock before the time lock,
+// and the sender can refund it after the time lock.
+// HTLCs of different tokens with the same hash lock make a cross-token atomic swap.
+type HTLC struct {
+	DOCTYPEID   string       `json:"@htlc"`  // id
+	Sender      string       `json:"sender"` // address
+	Receiver    string       `json:"receiver"`
+	Amount      Amount       `json:"amount"`
+	Fee         *Amount      `json:"fee,omitempty"`
+	HashLock    string       `json:"hash_lock"` // hex encoded SHA-256 hash of the preimage
+	TimeLock    *txtime.Time `json:"time_lock"`
+	Preimage    string       `json:"preimage,omitempty"` // hex encoded, revealed by the claim
+	Status      HTLCStatus   `json:"status"`
+	Memo        string       `json:"memo"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// GetID implements Identifiable
+func (h *HTLC) GetID() string {
+	return h.DOCTYPEID
+}
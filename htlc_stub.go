@@ -0,0 +1,203 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// HTLCStub _
+type HTLCStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewHTLCStub _
+func NewHTLCStub(stub shim.ChaincodeStubInterface) *HTLCStub {
+	return &HTLCStub{stub}
+}
+
+// CreateKey _
+func (hb *HTLCStub) CreateKey(id string) string {
+	return "HTLC_" + id
+}
+
+// GetHTLC _
+func (hb *HTLCStub) GetHTLC(id string) (*HTLC, error) {
+	data, err := hb.GetHTLCState(id)
+	if err != nil {
+		return nil, err
+	}
+	// data is not nil
+	htlc := &HTLC{}
+	if err = json.Unmarshal(data, htlc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the htlc")
+	}
+	return htlc, nil
+}
+
+// GetHTLCState _
+func (hb *HTLCStub) GetHTLCState(id string) ([]byte, error) {
+	data, err := hb.stub.GetState(hb.CreateKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the htlc state")
+	}
+	if data != nil {
+		return data, nil
+	}
+	return nil, NotExistedHTLCError{id: id}
+}
+
+// PutHTLC _
+func (hb *HTLCStub) PutHTLC(htlc *HTLC) error {
+	data, err := json.Marshal(htlc)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the htlc")
+	}
+	if err = hb.stub.PutState(hb.CreateKey(htlc.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the htlc state")
+	}
+	return nil
+}
+
+// Lock locks (amount + fee) of the sender's balance into the HTLC. The HTLC ID is the txid.
+func (hb *HTLCStub) Lock(sender *Balance, receiver string, amount, fee Amount, hashLock string, timeLock *txtime.Time, memo string) (*HTLC, *BalanceLog, error) {
+	ts, err := txtime.GetTime(hb.stub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	htlc := &HTLC{
+		DOCTYPEID:   hb.stub.GetTxID(),
+		Sender:      sender.GetID(),
+		Receiver:    receiver,
+		Amount:      amount,
+		Fee:         &fee,
+		HashLock:    hashLock,
+		TimeLock:    timeLock,
+		Status:      HTLCStatusLocked,
+		Memo:        memo,
+		CreatedTime: ts,
+		UpdatedTime: ts,
+	}
+	if err = hb.PutHTLC(htlc); err != nil {
+		return nil, nil, err
+	}
+
+	// applied = (amount + fee)
+	applied := amount.Copy().Add(&fee)
+	sender.Amount.Add(applied.Neg()) // -applied
+	sender.UpdatedTime = ts
+	bb := NewBalanceStub(hb.stub)
+	if err = bb.PutBalance(sender); err != nil {
+		return nil, nil, err
+	}
+	log := NewBalanceHTLCLog(sender, BalanceLogTypeHTLCLock, htlc, *amount.Copy().Neg(), &fee)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, nil, err
+	}
+
+	return htlc, log, nil
+}
+
+// Claim adds the amount of the HTLC to the receiver's balance, and reveals the preimage.
+// The fee is charged to the sender when the HTLC is claimed.
+func (hb *HTLCStub) Claim(htlc *HTLC, bal *Balance, preimage string) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(hb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if htlc.Status != HTLCStatusLocked {
+		return nil, errors.New("the htlc is not locked")
+	}
+	if htlc.TimeLock.Cmp(ts) <= 0 {
+		return nil, errors.New("the htlc is expired")
+	}
+	if !MatchHashLock(htlc.HashLock, preimage) {
+		return nil, errors.New("invalid preimage")
+	}
+
+	htlc.Preimage = preimage
+	htlc.Status = HTLCStatusClaimed
+	htlc.UpdatedTime = ts
+	if err = hb.PutHTLC(htlc); err != nil {
+		return nil, err
+	}
+
+	bal.Amount.Add(&htlc.Amount)
+	bal.UpdatedTime = ts
+	bb := NewBalanceStub(hb.stub)
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceHTLCLog(bal, BalanceLogTypeHTLCClaim, htlc, htlc.Amount, nil)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	// fee
+	if htlc.Fee != nil {
+		if _, err = NewFeeStub(hb.stub).CreateFee(htlc.Sender, *htlc.Fee); err != nil {
+			return nil, err
+		}
+	}
+
+	return log, nil
+}
+
+// Refund returns (amount + fee) of the HTLC to the sender's balance after the time lock.
+func (hb *HTLCStub) Refund(htlc *HTLC, bal *Balance) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(hb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if htlc.Status != HTLCStatusLocked {
+		return nil, errors.New("the htlc is not locked")
+	}
+	if htlc.TimeLock.Cmp(ts) > 0 {
+		return nil, errors.New("too early to refund")
+	}
+
+	htlc.Status = HTLCStatusRefunded
+	htlc.UpdatedTime = ts
+	if err = hb.PutHTLC(htlc); err != nil {
+		return nil, err
+	}
+
+	applied := htlc.Amount.Copy()
+	if htlc.Fee != nil {
+		applied.Add(htlc.Fee)
+	}
+	bal.Amount.Add(applied)
+	bal.UpdatedTime = ts
+	bb := NewBalanceStub(hb.stub)
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceHTLCLog(bal, BalanceLogTypeHTLCRefund, htlc, *applied, nil)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// MatchHashLock checks the hex encoded preimage with the hash lock.
+func MatchHashLock(hashLock, preimage string) bool {
+	pre, err := hex.DecodeString(preimage)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256(pre)
+	return hex.EncodeToString(hash[:]) == hashLock
+}
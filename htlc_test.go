@@ -0,0 +1,129 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestHTLCAtomicSwap(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+	h.setTokenMeta("KIE", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	for _, code := range []string{"PCI", "KIE"} {
+		h.mustInvokeAs(issuer, "token/create", code)
+		h.mustInvokeAs(alice, "account/create", code)
+		h.mustInvokeAs(bob, "account/create", code)
+	}
+	alicePCI := testAccountAddr("PCI", alice)
+	aliceKIE := testAccountAddr("KIE", alice)
+	bobPCI := testAccountAddr("PCI", bob)
+	bobKIE := testAccountAddr("KIE", bob)
+	h.mustInvokeAs(issuer, "transfer", getTestToken(t, h, "PCI").GenesisAccount, alicePCI, "1000")
+	h.mustInvokeAs(issuer, "transfer", getTestToken(t, h, "KIE").GenesisAccount, bobKIE, "500")
+
+	preimage := hex.EncodeToString([]byte("secret"))
+	hash := sha256.Sum256([]byte("secret"))
+	hashLock := hex.EncodeToString(hash[:])
+
+	// alice locks PCI for bob, and bob locks KIE for alice with the same hash lock (shorter time lock)
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "htlc/lock", "", bobPCI, "100", hashLock, strconv.FormatInt(h.clock.Unix()+120, 10)), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeHTLCLock || log.Diff.String() != "-100" || log.Fee.String() != "1" {
+		t.Fatalf("unexpected lock log: %+v", log)
+	}
+	pciID := log.RID
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "htlc/lock", "", aliceKIE, "50", hashLock, strconv.FormatInt(h.clock.Unix()+60, 10)), log); err != nil {
+		t.Fatal(err)
+	}
+	kieID := log.RID
+	assertBalance(t, h, alicePCI, "899")
+	assertBalance(t, h, bobKIE, "450")
+
+	if res := h.invokeAs(alice, "htlc/claim", kieID, hex.EncodeToString([]byte("wrong"))); res.Status == shim.OK {
+		t.Fatal("invalid preimage")
+	}
+	if res := h.invokeAs(bob, "htlc/claim", kieID, preimage); res.Status == shim.OK {
+		t.Fatal("only the receiver can claim")
+	}
+
+	// alice claims KIE and reveals the preimage
+	h.mustInvokeAs(alice, "htlc/claim", kieID, preimage)
+	assertBalance(t, h, aliceKIE, "50")
+
+	htlc := &HTLC{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "htlc/get", kieID), htlc); err != nil {
+		t.Fatal(err)
+	}
+	if htlc.Status != HTLCStatusClaimed || htlc.Preimage != preimage {
+		t.Fatalf("unexpected htlc: %+v", htlc)
+	}
+
+	// bob claims PCI with the revealed preimage
+	h.mustInvokeAs(bob, "htlc/claim", pciID, htlc.Preimage)
+	assertBalance(t, h, bobPCI, "100")
+	if res := h.invokeAs(alice, "htlc/refund", pciID); res.Status == shim.OK {
+		t.Fatal("the claimed htlc can't be refunded")
+	}
+}
+
+func TestHTLCRefund(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	preimage := hex.EncodeToString([]byte("secret"))
+	hash := sha256.Sum256([]byte("secret"))
+	hashLock := hex.EncodeToString(hash[:])
+
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "htlc/lock", "", bobAddr, "200", hashLock, strconv.FormatInt(h.clock.Unix()+30, 10)), log); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, h, aliceAddr, "798")
+
+	if res := h.invokeAs(alice, "htlc/refund", log.RID); res.Status == shim.OK {
+		t.Fatal("too early to refund")
+	}
+
+	h.advance(30 * time.Second)
+	if res := h.invokeAs(bob, "htlc/claim", log.RID, preimage); res.Status == shim.OK {
+		t.Fatal("the htlc is expired")
+	}
+	if res := h.invokeAs(bob, "htlc/refund", log.RID); res.Status == shim.OK {
+		t.Fatal("only the sender can refund")
+	}
+
+	// amount + fee
+	h.mustInvokeAs(alice, "htlc/refund", log.RID)
+	assertBalance(t, h, aliceAddr, "1000")
+	event := getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeHTLCRefund || event.Changes[0].Diff.String() != "202" {
+		t.Fatalf("unexpected balance event: %+v", event)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// params[0] : sender address (empty string = personal account)
+// params[1] : receiver address
+// params[2] : amount (big int string or decimal string)
+// params[3] : hash lock (hex encoded SHA-256 hash of the preimage)
+// params[4] : time lock (time represented by int64 seconds)
+// params[5] : optional. memo (see MemoMaxLength)
+func htlcLock(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 5 {
+		return shim.Error("incorrect number of parameters. expecting 5+")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// addresses
+	rAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the receiver's account address")
+	}
+	var sAddr *Address
+	if len(params[0]) > 0 {
+		sAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// IMPORTANT: assert(sender != receiver)
+	if sAddr.Equal(rAddr) {
+		return shim.Error("can't lock to self")
+	}
+
+	// hash lock
+	hashLock := strings.ToLower(params[3])
+	if h, err := hex.DecodeString(hashLock); err != nil || len(h) != 32 {
+		return shim.Error("invalid hash lock: need hex encoded SHA-256 hash")
+	}
+
+	// time lock
+	seconds, err := strconv.ParseInt(params[4], 10, 64)
+	if err != nil {
+		return shim.Error("invalid time lock: need seconds since 1970")
+	}
+	timeLock := txtime.Unix(seconds, 0)
+	if timeLock.Cmp(ts) <= 0 {
+		return shim.Error("the time lock must be in the future")
+	}
+
+	// memo
+	memo := ""
+	if len(params) > 5 {
+		if len(params[5]) > MemoMaxLength { // length limit
+			memo = params[5][:MemoMaxLength]
+		} else {
+			memo = params[5]
+		}
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to lock")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(rAddr.Code, params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	ab := NewAccountStub(stub, rAddr.Code)
+
+	// sender
+	sender, err := ab.GetAccount(sAddr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !sender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if sender.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+	if jac, ok := sender.(*JointAccount); ok && jac.Quorum() > 1 {
+		return shim.Error("multi-sig account can't lock")
+	}
+
+	// receiver
+	receiver, err := ab.GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the receiver account")
+	}
+	if receiver.IsSuspended() {
+		return shim.Error("the receiver account is suspended")
+	}
+
+	// sender balance
+	sBal, err := NewBalanceStub(stub).GetBalance(sender.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	fee, err := NewFeeStub(stub).CalcFee(sAddr, "transfer", *amount)
+	if err != nil {
+		return responseError(err, "failed to get the fee amount")
+	}
+
+	// fee is not nil
+	applied := amount.Copy().Add(fee)
+
+	if sBal.Amount.Cmp(applied) < 0 {
+		return shim.Error("not enough balance")
+	}
+
+	_, log, err := NewHTLCStub(stub).Lock(sBal, receiver.GetID(), *amount, *fee, hashLock, timeLock, memo)
+	if err != nil {
+		return responseError(err, "failed to lock")
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : HTLC ID
+// params[1] : preimage (hex encoded)
+func htlcClaim(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// htlc
+	hb := NewHTLCStub(stub)
+	htlc, err := hb.GetHTLC(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the htlc")
+	}
+	if htlc.Status != HTLCStatusLocked {
+		return shim.Error("the htlc is not locked")
+	}
+	if htlc.TimeLock.Cmp(ts) <= 0 {
+		return shim.Error("the htlc is expired")
+	}
+	preimage := strings.ToLower(params[1])
+	if !MatchHashLock(htlc.HashLock, preimage) {
+		return shim.Error("invalid preimage")
+	}
+
+	// receiver
+	addr, _ := ParseAddress(htlc.Receiver) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to claim")
+	}
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the receiver account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if account.IsSuspended() {
+		return shim.Error("the receiver account is suspended")
+	}
+
+	// balance
+	bal, err := NewBalanceStub(stub).GetBalance(account.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the receiver's balance")
+	}
+
+	log, err := hb.Claim(htlc, bal, preimage)
+	if err != nil {
+		return responseError(err, "failed to claim")
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : HTLC ID
+func htlcGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	_, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	data, err := NewHTLCStub(stub).GetHTLCState(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the htlc")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : HTLC ID
+func htlcRefund(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// htlc
+	hb := NewHTLCStub(stub)
+	htlc, err := hb.GetHTLC(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the htlc")
+	}
+	if htlc.Status != HTLCStatusLocked {
+		return shim.Error("the htlc is not locked")
+	}
+	if htlc.TimeLock.Cmp(ts) > 0 {
+		return shim.Error("too early to refund")
+	}
+
+	// sender
+	addr, _ := ParseAddress(htlc.Sender) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to refund")
+	}
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+
+	// balance
+	bal, err := NewBalanceStub(stub).GetBalance(account.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	log, err := hb.Refund(htlc, bal)
+	if err != nil {
+		return responseError(err, "failed to refund")
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+	return shim.Success(data)
+}
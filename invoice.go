@@ -0,0 +1,57 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// InvoiceStatus _
+type InvoiceStatus int8
+
+const (
+	// InvoiceStatusOpen _
+	InvoiceStatusOpen InvoiceStatus = iota
+	// InvoiceStatusPaid _
+	InvoiceStatusPaid
+	// InvoiceStatusExpired is not stored. The open invoice is expired after the expiry time.
+	InvoiceStatusExpired
+	// InvoiceStatusCancelled _
+	InvoiceStatusCancelled
+	// InvoiceStatusRefunded the pay of the invoice is fully refunded
+	InvoiceStatusRefunded
+)
+
+// Invoice is the payment request created by the merchant.
+// It is settled by invoice/pay, which creates the pay of the invoice.
+type Invoice struct {
+	DOCTYPEID   string        `json:"@invoice"` // merchant address
+	InvoiceID   string        `json:"invoice_id"`
+	Amount      Amount        `json:"amount"`
+	OrderID     string        `json:"order_id,omitempty"`
+	Payer       string        `json:"payer,omitempty"` // allowed payer address (empty = anyone)
+	Status      InvoiceStatus `json:"status"`
+	PayID       string        `json:"pay_id,omitempty"` // pay of the invoice
+	Memo        string        `json:"memo"`
+	CreatedTime *txtime.Time  `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time  `json:"updated_time,omitempty"`
+	ExpiryTime  *txtime.Time  `json:"expiry_time,omitempty"` // nil = no expiry
+}
+
+// GetID implements Identifiable
+func (inv *Invoice) GetID() string {
+	return inv.InvoiceID
+}
+
+// IsExpired _
+func (inv *Invoice) IsExpired(t *txtime.Time) bool {
+	return inv.ExpiryTime != nil && inv.ExpiryTime.Cmp(t) <= 0
+}
+
+// GetStatus returns the status at the time. (open or expired)
+func (inv *Invoice) GetStatus(t *txtime.Time) InvoiceStatus {
+	if inv.Status == InvoiceStatusOpen && inv.IsExpired(t) {
+		return InvoiceStatusExpired
+	}
+	return inv.Status
+}
@@ -0,0 +1,157 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// InvoicesFetchSize _
+const InvoicesFetchSize = 20
+
+// InvoiceStub _
+type InvoiceStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewInvoiceStub _
+func NewInvoiceStub(stub shim.ChaincodeStubInterface) *InvoiceStub {
+	return &InvoiceStub{stub}
+}
+
+// CreateKey _
+func (ib *InvoiceStub) CreateKey(id string) string {
+	return "INV_" + id
+}
+
+// GetInvoice _
+func (ib *InvoiceStub) GetInvoice(id string) (*Invoice, error) {
+	data, err := ib.stub.GetState(ib.CreateKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the invoice state")
+	}
+	if data == nil {
+		return nil, NotExistedInvoiceError{id: id}
+	}
+	inv := &Invoice{}
+	if err = json.Unmarshal(data, inv); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the invoice")
+	}
+	return inv, nil
+}
+
+// GetQueryInvoices _
+func (ib *InvoiceStub) GetQueryInvoices(addr, bookmark string, fetchSize int) (*QueryResult, error) {
+	if fetchSize < 1 {
+		fetchSize = InvoicesFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+	query := CreateQueryInvoicesByAddress(addr)
+	iter, meta, err := ib.stub.GetQueryResultWithPagination(query, int32(fetchSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	return NewQueryResult(meta, iter)
+}
+
+// PutInvoice _
+func (ib *InvoiceStub) PutInvoice(inv *Invoice) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the invoice")
+	}
+	if err = ib.stub.PutState(ib.CreateKey(inv.InvoiceID), data); err != nil {
+		return errors.Wrap(err, "failed to put the invoice state")
+	}
+	return nil
+}
+
+// CreateInvoice _
+func (ib *InvoiceStub) CreateInvoice(merchant string, amount Amount, orderID, payer, memo string, expiryTime *txtime.Time) (*Invoice, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	inv := &Invoice{
+		DOCTYPEID:   merchant,
+		InvoiceID:   fmt.Sprintf("%d%s", ts.UnixNano(), ib.stub.GetTxID()),
+		Amount:      amount,
+		OrderID:     orderID,
+		Payer:       payer,
+		Status:      InvoiceStatusOpen,
+		Memo:        memo,
+		CreatedTime: ts,
+		UpdatedTime: ts,
+		ExpiryTime:  expiryTime,
+	}
+	if err = ib.PutInvoice(inv); err != nil {
+		return nil, err
+	}
+	// the order id is reserved until the invoice is paid or cancelled
+	if len(orderID) > 0 {
+		if err = NewPayStub(ib.stub).ReserveOrderID(merchant, orderID, inv.InvoiceID); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// Pay creates the pay of the invoice and marks the invoice paid.
+func (ib *InvoiceStub) Pay(inv *Invoice, sender *Balance, fee Amount) (*PayResult, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if inv.GetStatus(ts) != InvoiceStatusOpen {
+		return nil, errors.New("the invoice is not open")
+	}
+
+	res, err := NewPayStub(ib.stub).PayInvoice(sender, inv.DOCTYPEID, inv.Amount, fee, inv.OrderID, inv.InvoiceID, inv.Memo)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Status = InvoiceStatusPaid
+	inv.PayID = res.Pay.PayID
+	inv.UpdatedTime = ts
+	if err = ib.PutInvoice(inv); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Cancel marks the invoice cancelled and releases the reserved order id.
+func (ib *InvoiceStub) Cancel(inv *Invoice) (*Invoice, error) {
+	if len(inv.OrderID) > 0 {
+		if err := NewPayStub(ib.stub).ReleaseOrderID(inv.DOCTYPEID, inv.OrderID, inv.InvoiceID); err != nil {
+			return nil, err
+		}
+	}
+	return ib.SetStatus(inv, InvoiceStatusCancelled)
+}
+
+// SetStatus updates the status of the invoice. (cancelled or refunded)
+func (ib *InvoiceStub) SetStatus(inv *Invoice, status InvoiceStatus) (*Invoice, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	inv.Status = status
+	inv.UpdatedTime = ts
+	if err = ib.PutInvoice(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
@@ -0,0 +1,140 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// getTestInvoice _
+func getTestInvoice(t *testing.T, h *testHarness, kid, id string) *Invoice {
+	t.Helper()
+	inv := &Invoice{}
+	if err := json.Unmarshal(h.mustInvokeAs(kid, "invoice/get", id), inv); err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func TestInvoice(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	merchant := h.newKID("merchant")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, merchant} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+	h.mustInvokeAs(issuer, "transfer", genesis, bobAddr, "1000")
+
+	// invoice for alice
+	inv := &Invoice{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "invoice/create", "PCI", "100", "order-1", "60", aliceAddr), inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Status != InvoiceStatusOpen || inv.Payer != aliceAddr || inv.ExpiryTime == nil {
+		t.Fatalf("unexpected invoice: %+v", inv)
+	}
+	if res := h.invokeAs(bob, "invoice/pay", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("not allowed payer")
+	}
+
+	// the order id is reserved by the invoice
+	if res := h.invokeAs(bob, "pay", "", merchantAddr, "10", "order-1"); res.Status == shim.OK {
+		t.Fatal("the order id is reserved by the invoice")
+	}
+	if res := h.invokeAs(merchant, "invoice/create", "PCI", "100", "order-1"); res.Status == shim.OK {
+		t.Fatal("the order id is reserved by the invoice")
+	}
+	if res := h.invokeAs(bob, "pay/get", "", merchantAddr, "order-1"); res.Status == shim.OK {
+		t.Fatal("the invoice is not paid yet")
+	}
+
+	payResult := &PayResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "invoice/pay", inv.InvoiceID), payResult); err != nil {
+		t.Fatal(err)
+	}
+	if payResult.Pay.InvoiceID != inv.InvoiceID || payResult.Pay.OrderID != "order-1" || payResult.Pay.Amount.String() != "100" {
+		t.Fatalf("unexpected pay: %+v", payResult.Pay)
+	}
+	assertBalance(t, h, aliceAddr, "900")
+	pay := &Pay{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "pay/get", "", merchantAddr, "order-1"), pay); err != nil {
+		t.Fatal(err)
+	}
+	if pay.PayID != payResult.Pay.PayID {
+		t.Fatalf("unexpected pay of the order id: %+v", pay)
+	}
+	if res := h.invokeAs(alice, "invoice/pay", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("the invoice is already paid")
+	}
+	if paid := getTestInvoice(t, h, alice, inv.InvoiceID); paid.Status != InvoiceStatusPaid || paid.PayID != payResult.Pay.PayID {
+		t.Fatalf("unexpected invoice: %+v", paid)
+	}
+
+	// partial refund keeps the status
+	h.mustInvokeAs(merchant, "pay/refund", payResult.Pay.PayID, "40")
+	if paid := getTestInvoice(t, h, alice, inv.InvoiceID); paid.Status != InvoiceStatusPaid {
+		t.Fatalf("unexpected invoice status: %d", paid.Status)
+	}
+	h.mustInvokeAs(merchant, "pay/refund", payResult.Pay.PayID, "60")
+	if refunded := getTestInvoice(t, h, alice, inv.InvoiceID); refunded.Status != InvoiceStatusRefunded {
+		t.Fatalf("unexpected invoice status: %d", refunded.Status)
+	}
+	assertBalance(t, h, aliceAddr, "1000")
+
+	// cancelled
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "invoice/create", "PCI", "100", "order-2"), inv); err != nil {
+		t.Fatal(err)
+	}
+	if res := h.invokeAs(bob, "invoice/cancel", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("only the merchant can cancel")
+	}
+	h.mustInvokeAs(merchant, "invoice/cancel", inv.InvoiceID)
+	if res := h.invokeAs(bob, "invoice/pay", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("the invoice is cancelled")
+	}
+
+	// the cancelled invoice releases the order id
+	h.mustInvokeAs(bob, "pay", "", merchantAddr, "10", "order-2")
+	assertBalance(t, h, bobAddr, "990")
+
+	// expired
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "invoice/create", "PCI", "100", "order-3", "10"), inv); err != nil {
+		t.Fatal(err)
+	}
+	h.advance(10 * time.Second)
+	if res := h.invokeAs(bob, "invoice/pay", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("the invoice is expired")
+	}
+	assertBalance(t, h, bobAddr, "990")
+
+	// list (latest first)
+	res := struct {
+		Records []*Invoice `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(merchant, "invoice/list", "PCI"), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 3 {
+		t.Fatalf("expected 3 invoices, got %d", len(res.Records))
+	}
+	for i, status := range []InvoiceStatus{InvoiceStatusExpired, InvoiceStatusCancelled, InvoiceStatusRefunded} {
+		if res.Records[i].Status != status {
+			t.Errorf("status of invoice %s: expected %d, got %d", res.Records[i].OrderID, status, res.Records[i].Status)
+		}
+	}
+}
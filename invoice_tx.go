@@ -0,0 +1,383 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// params[0] : merchant's token code | account address
+// params[1] : amount (big int string or decimal string)
+// params[2] : order id
+// params[3] : optional. expiry (duration represented by int64 seconds, 0 = no expiry)
+// params[4] : optional. allowed payer's address (empty string = anyone)
+// params[5] : optional. memo (see MemoMaxLength)
+func invoiceCreate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 3 {
+		return shim.Error("incorrect number of parameters. expecting 3+")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the merchant's account address")
+		}
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to create the invoice")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(addr.Code, params[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	orderID := params[2]
+
+	// options
+	var expiryTime *txtime.Time
+	payer := ""
+	memo := ""
+	if len(params) > 3 {
+		if len(params[3]) > 0 {
+			expiry, err := strconv.ParseInt(params[3], 10, 64)
+			if err != nil || expiry < 0 {
+				return shim.Error("invalid expiry: need seconds")
+			}
+			if expiry > 0 {
+				expiryTime = txtime.Unix(ts.Unix()+expiry, int64(ts.Nanosecond()))
+			}
+		}
+		// payer
+		if len(params) > 4 {
+			if len(params[4]) > 0 {
+				pAddr, err := ParseAddress(params[4])
+				if err != nil {
+					return responseError(err, "failed to parse the payer's account address")
+				}
+				if pAddr.Code != addr.Code { // not same token
+					return shim.Error("different token accounts")
+				}
+				if pAddr.Equal(addr) {
+					return shim.Error("can't request to self")
+				}
+				payer = pAddr.String()
+			}
+			// memo
+			if len(params) > 5 {
+				if len(params[5]) > MemoMaxLength { // length limit
+					memo = params[5][:MemoMaxLength]
+				} else {
+					memo = params[5]
+				}
+			}
+		}
+	}
+
+	// merchant
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the merchant account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if account.IsSuspended() {
+		return shim.Error("the merchant account is suspended")
+	}
+
+	// order id must be unique per merchant, and it is reserved by the invoice
+	if len(orderID) > 0 {
+		if err = NewPayStub(stub).AssertOrderIDNotUsed(account.GetID(), orderID); err != nil {
+			return responseError(err, "failed to create the invoice")
+		}
+	}
+
+	inv, err := NewInvoiceStub(stub).CreateInvoice(account.GetID(), *amount, orderID, payer, memo, expiryTime)
+	if err != nil {
+		return responseError(err, "failed to create the invoice")
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return responseError(err, "failed to marshal the invoice")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : invoice id
+func invoiceCancel(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ib := NewInvoiceStub(stub)
+	inv, err := ib.GetInvoice(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the invoice")
+	}
+	if inv.Status != InvoiceStatusOpen {
+		return shim.Error("the invoice is not open")
+	}
+
+	// merchant
+	addr, _ := ParseAddress(inv.DOCTYPEID) // err is nil
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the merchant account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+
+	if inv, err = ib.Cancel(inv); err != nil {
+		return responseError(err, "failed to cancel the invoice")
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return responseError(err, "failed to marshal the invoice")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : invoice id
+func invoiceGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	_, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	inv, err := NewInvoiceStub(stub).GetInvoice(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the invoice")
+	}
+	inv.Status = inv.GetStatus(ts)
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return responseError(err, "failed to marshal the invoice")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : merchant's token code | account address
+// params[1] : optional. bookmark
+// params[2] : optional. fetch size (if < 1 => default size, max 200)
+func invoiceList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+	}
+
+	bookmark := ""
+	fetchSize := 0
+	if len(params) > 1 {
+		bookmark = params[1]
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	res, err := NewInvoiceStub(stub).GetQueryInvoices(addr.String(), bookmark, fetchSize)
+	if err != nil {
+		return responseError(err, "failed to get invoices")
+	}
+
+	// expired status
+	invs := []*Invoice{}
+	if err = json.Unmarshal(res.Records, &invs); err != nil {
+		return responseError(err, "failed to unmarshal invoices")
+	}
+	for _, inv := range invs {
+		inv.Status = inv.GetStatus(ts)
+	}
+	if res.Records, err = json.Marshal(invs); err != nil {
+		return responseError(err, "failed to marshal invoices")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal invoices")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : invoice id
+// params[1] : optional. sender's address (empty string = personal account)
+func invoicePay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// invoice
+	ib := NewInvoiceStub(stub)
+	inv, err := ib.GetInvoice(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the invoice")
+	}
+	switch inv.GetStatus(ts) {
+	case InvoiceStatusOpen:
+	case InvoiceStatusExpired:
+		return shim.Error("the invoice is expired")
+	default:
+		return shim.Error("the invoice is not open")
+	}
+
+	// addresses
+	rAddr, _ := ParseAddress(inv.DOCTYPEID) // err is nil
+	var sAddr *Address
+	if len(params) > 1 && len(params[1]) > 0 {
+		sAddr, err = ParseAddress(params[1])
+		if err != nil {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+	if sAddr.Equal(rAddr) {
+		return shim.Error("can't pay to self")
+	}
+	if len(inv.Payer) > 0 && inv.Payer != sAddr.String() {
+		return shim.Error("not allowed payer")
+	}
+
+	// token
+	if err = NewTokenStub(stub).AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to pay")
+	}
+
+	ab := NewAccountStub(stub, rAddr.Code)
+
+	// sender account validation
+	sender, err := ab.GetAccount(sAddr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !sender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if sender.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+	if jac, ok := sender.(*JointAccount); ok && jac.Quorum() > 1 {
+		return shim.Error("multi-sig account can't pay the invoice")
+	}
+
+	// receiver account validation
+	receiver, err := ab.GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the merchant account")
+	}
+	if receiver.IsSuspended() {
+		return shim.Error("the merchant account is suspended")
+	}
+
+	// sender balance
+	sBal, err := NewBalanceStub(stub).GetBalance(sender.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+	if sBal.Amount.Cmp(&inv.Amount) < 0 {
+		return shim.Error("not enough balance")
+	}
+
+	fee, feeExempt, err := NewFeeStub(stub).CalcFeeWithExemption(rAddr, "pay", inv.Amount)
+	if err != nil {
+		return responseError(err, "failed to get the fee amount")
+	}
+
+	payResult, err := ib.Pay(inv, sBal, *fee)
+	if err != nil {
+		return responseError(err, "failed to pay")
+	}
+	payResult.BalanceLog.FeeExempt = feeExempt
+
+	data, err := json.Marshal(payResult)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+	return shim.Success(data)
+}
@@ -22,7 +22,7 @@ func (cc *Chaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
 func (cc *Chaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 	fn, params := stub.GetFunctionAndParameters()
 	if txFn := routes[fn]; txFn != nil {
-		return txFn(stub, params)
+		return txFn(NewTxStub(stub), params)
 	}
 	return shim.Error("unknown function: [" + fn + "]")
 }
@@ -33,32 +33,75 @@ type TxFunc func(shim.ChaincodeStubInterface, []string) peer.Response
 // routes is the map of invoke functions
 var routes = map[string]TxFunc{
 	"account/create":           accountCreate,
+	"account/delta/set":        accountDeltaSet,
+	"account/freeze":           accountFreeze,
+	"account/freeze/logs":      accountFreezeLogs,
 	"account/get":              accountGet,
 	"account/holder/add":       accountHolderAdd,
 	"account/holder/remove":    accountHolderRemove,
 	"account/list":             accountList,
 	"account/suspend":          accountSuspend,
+	"account/threshold/set":    accountThresholdSet,
+	"account/unfreeze":         accountUnfreeze,
 	"account/unsuspend":        accountUnsuspend,
+	"allowance/approve":        allowanceApprove,
+	"allowance/get":            allowanceGet,
+	"allowance/revoke":         allowanceRevoke,
+	"balance/at":               balanceAt,
 	"balance/logs":             balanceLogs,
+	"balance/merge":            balanceMerge,
+	"balance/pending/cancel":   balancePendingCancel,
 	"balance/pending/get":      balancePendingGet,
 	"balance/pending/list":     balancePendingList,
 	"balance/pending/withdraw": balancePendingWithdraw,
+	"balance/reindex":          balanceReindex,
+	"contract/approve":         contractApprove,
+	"contract/reject":          contractReject,
 	"contract/execute":         contractExecute,
 	"contract/cancel":          contractCancel,
+	"fee/exempt/add":           feeExemptAdd,
+	"fee/exempt/list":          feeExemptList,
+	"fee/exempt/remove":        feeExemptRemove,
 	"fee/list":                 feeList,
 	"fee/prune":                feePrune,
-	"pay":                      pay,
+	"fee/quote":                feeQuote,
+	"htlc/claim":               htlcClaim,
+	"htlc/get":                 htlcGet,
+	"htlc/lock":                htlcLock,
+	"htlc/refund":              htlcRefund,
+	"invoice/cancel":           invoiceCancel,
+	"invoice/create":           invoiceCreate,
+	"invoice/get":              invoiceGet,
+	"invoice/list":             invoiceList,
+	"invoice/pay":              invoicePay,
+	"pay":                      idempotent(pay),
 	"pay/get":                  payGet,
 	"pay/prune":                payPrune,
 	"pay/list":                 payList,
-	"pay/refund":               payRefund,
-	"token/burn":               tokenBurn,
+	"pay/refund":               idempotent(payRefund),
+	"schedule/cancel":          scheduleCancel,
+	"schedule/create":          scheduleCreate,
+	"schedule/list":            scheduleList,
+	"schedule/run":             scheduleRun,
+	"token/audit":              tokenAudit,
+	"token/burn":               idempotent(tokenBurn),
 	"token/create":             tokenCreate,
+	"token/genesis/rotate":     tokenGenesisRotate,
 	"token/get":                tokenGet,
-	"token/mint":               tokenMint,
+	"token/holders":            tokenHolders,
+	"token/mint":               idempotent(tokenMint),
+	"token/pause":              tokenPause,
+	"token/stats":              tokenStats,
+	"token/unpause":            tokenUnpause,
 	"token/update":             tokenUpdate,
-	"transfer":                 transfer,
+	"transfer":                 idempotent(transfer),
+	"transfer/batch":           transferBatch,
+	"transfer/from":            transferFrom,
 	"ver":                      ver,
+	"vesting/claim":            vestingClaim,
+	"vesting/create":           vestingCreate,
+	"vesting/get":              vestingGet,
+	"vesting/revoke":           vestingRevoke,
 }
 
 func ver(stub shim.ChaincodeStubInterface, params []string) peer.Response {
@@ -3,7 +3,10 @@
 package main
 
 import (
+	"strconv"
+
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
 )
 
 // Pay _
@@ -11,11 +14,12 @@ type Pay struct {
 	DOCTYPEID   string       `json:"@pay"`                   //address
 	PayID       string       `json:"pay_id"`                 //used for the external client to pass the pay id for refund
 	Amount      Amount       `json:"amount"`                 //can be positive(pay) or negative(refund)
-	Fee         Amount       `json:"fee"`                    //can be positive(pay) or negative(refund, to return fee to merchant when she prune her pays)
+	Fee         Amount       `json:"fee"`                    //can be positive(pay) or negative(refund, to return fee to merchant when she prune her pays). refund fee is added to the refund's.
 	TotalRefund Amount       `json:"total_refund,omitempty"` //total refund value
 	RID         string       `json:"rid"`                    //related id. user who pays to the merchant or receives refund from the merchant.
 	ParentID    string       `json:"parent_id,omitempty"`    //parent id. this value exists only when the pay type is refund(negative amount)
 	OrderID     string       `json:"order_id,omitempty"`     // order id. vendor specific unique identifier.
+	InvoiceID   string       `json:"invoice_id,omitempty"`   // invoice id. exists only when the pay settles the invoice.
 	Memo        string       `json:"memo"`
 	CreatedTime *txtime.Time `json:"created_time,omitempty"`
 }
@@ -35,6 +39,22 @@ func NewPay(id, payid string, amount, fee Amount, rid, pid, orderID, memo string
 	}
 }
 
+// GetPayIDTime returns the created time encoded in the pay ID (unix nano + txid)
+func GetPayIDTime(payID string) (*txtime.Time, error) {
+	if len(payID) < 19 {
+		return nil, errors.New("invalid pay ID")
+	}
+	s, err := strconv.ParseInt(payID[0:10], 10, 64)
+	if nil != err {
+		return nil, errors.Wrap(err, "failed to get seconds from timestamp")
+	}
+	n, err := strconv.ParseInt(payID[10:19], 10, 64)
+	if nil != err {
+		return nil, errors.Wrap(err, "failed to get nanoseconds from timestamp")
+	}
+	return txtime.Unix(s, n), nil
+}
+
 // PaySum _
 type PaySum struct {
 	Sum     *Amount `json:"sum"`
@@ -5,6 +5,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
@@ -62,9 +63,132 @@ func (pb *PayStub) GetPayState(id string) ([]byte, error) {
 	return nil, NotExistedPayError{id: id}
 }
 
-// GetPayByOrderID retrieves Pay by vendor specific order id field.
-func (pb *PayStub) GetPayByOrderID(orderID string) (*Pay, error) {
-	query := CreateQueryPayByOrderID(orderID)
+// CreateOrderKey creates the composite key of the order id index record. (unique per merchant)
+func (pb *PayStub) CreateOrderKey(merchant, orderID string) (string, error) {
+	return pb.stub.CreateCompositeKey("PAY_ORDER", []string{merchant, orderID})
+}
+
+// CreateOrderReservation returns the order id index record value reserved by the invoice. (the invoice key)
+func (pb *PayStub) CreateOrderReservation(invoiceID string) string {
+	return NewInvoiceStub(pb.stub).CreateKey(invoiceID)
+}
+
+// GetPayIDByOrderID returns the pay id of the merchant's order id. (empty string = no pay)
+// If the order id is reserved by the open invoice, it returns the invoice key. (see CreateOrderReservation)
+func (pb *PayStub) GetPayIDByOrderID(merchant, orderID string) (string, error) {
+	key, err := pb.CreateOrderKey(merchant, orderID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create the order key")
+	}
+	data, err := pb.stub.GetState(key)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the order state")
+	}
+	return string(data), nil
+}
+
+// PutOrderID puts the order id index record of the pay.
+// If the merchant's order id is already used, it returns ExistedOrderIDError.
+func (pb *PayStub) PutOrderID(merchant, orderID, payID string) error {
+	key, err := pb.CreateOrderKey(merchant, orderID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the order key")
+	}
+	data, err := pb.stub.GetState(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the order state")
+	}
+	if data != nil {
+		return ExistedOrderIDError{orderID: orderID}
+	}
+	if err = pb.stub.PutState(key, []byte(payID)); err != nil {
+		return errors.Wrap(err, "failed to put the order state")
+	}
+	return nil
+}
+
+// ReserveOrderID reserves the merchant's order id for the invoice. (see invoice/create)
+// If the merchant's order id is already used, it returns ExistedOrderIDError.
+func (pb *PayStub) ReserveOrderID(merchant, orderID, invoiceID string) error {
+	return pb.PutOrderID(merchant, orderID, pb.CreateOrderReservation(invoiceID))
+}
+
+// PutInvoiceOrderID replaces the order id reserved by the invoice with the pay id of the invoice.
+// If the order id is used by the other pay or invoice, it returns ExistedOrderIDError.
+// Invoices created before the reservation have no record, so it puts the new one.
+func (pb *PayStub) PutInvoiceOrderID(merchant, orderID, invoiceID, payID string) error {
+	key, err := pb.CreateOrderKey(merchant, orderID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the order key")
+	}
+	data, err := pb.stub.GetState(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the order state")
+	}
+	if data != nil && string(data) != pb.CreateOrderReservation(invoiceID) {
+		return ExistedOrderIDError{orderID: orderID}
+	}
+	if err = pb.stub.PutState(key, []byte(payID)); err != nil {
+		return errors.Wrap(err, "failed to put the order state")
+	}
+	return nil
+}
+
+// ReleaseOrderID deletes the order id reserved by the invoice. (see invoice/cancel)
+// If the order id is not reserved by the invoice, it does nothing.
+func (pb *PayStub) ReleaseOrderID(merchant, orderID, invoiceID string) error {
+	key, err := pb.CreateOrderKey(merchant, orderID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the order key")
+	}
+	data, err := pb.stub.GetState(key)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the order state")
+	}
+	if string(data) != pb.CreateOrderReservation(invoiceID) {
+		return nil
+	}
+	if err = pb.stub.DelState(key); err != nil {
+		return errors.Wrap(err, "failed to delete the order state")
+	}
+	return nil
+}
+
+// AssertOrderIDNotUsed returns ExistedOrderIDError if the merchant's order id is already used or reserved by the invoice.
+func (pb *PayStub) AssertOrderIDNotUsed(merchant, orderID string) error {
+	payID, err := pb.GetPayIDByOrderID(merchant, orderID)
+	if err != nil {
+		return err
+	}
+	if len(payID) > 0 {
+		return ExistedOrderIDError{orderID: orderID}
+	}
+	_, err = pb.GetPayByOrderID(merchant, orderID)
+	if err == nil {
+		return ExistedOrderIDError{orderID: orderID}
+	}
+	if _, ok := err.(NotExistedPayError); ok {
+		return nil
+	}
+	return err
+}
+
+// GetPayByOrderID retrieves the pay by the merchant's order id.
+// Pays created before the order id index record are searched by the query.
+// The order id reserved by the open invoice has no pay yet.
+func (pb *PayStub) GetPayByOrderID(merchant, orderID string) (*Pay, error) {
+	payID, err := pb.GetPayIDByOrderID(merchant, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(payID, pb.CreateOrderReservation("")) {
+		return nil, NotExistedPayError{id: orderID}
+	}
+	if len(payID) > 0 {
+		return pb.GetPay(payID)
+	}
+
+	query := CreateQueryPayByOrderID(merchant, orderID)
 	iter, err := pb.stub.GetQueryResult(query)
 	if nil != err {
 		return nil, err
@@ -72,7 +196,7 @@ func (pb *PayStub) GetPayByOrderID(orderID string) (*Pay, error) {
 	defer iter.Close()
 
 	if !iter.HasNext() {
-		return nil, errors.New("cannot find pay of the order id")
+		return nil, NotExistedPayError{id: orderID}
 	}
 	kv, err := iter.Next()
 	if nil != err {
@@ -112,15 +236,31 @@ func (pb *PayStub) PutParentPay(key string, pay *Pay) error {
 
 // Pay _
 func (pb *PayStub) Pay(sender *Balance, receiver string, amount, fee Amount, orderID, memo string) (*PayResult, error) {
+	return pb.PayInvoice(sender, receiver, amount, fee, orderID, "", memo)
+}
+
+// PayInvoice creates the pay which settles the invoice. (empty invoiceID = not invoice)
+func (pb *PayStub) PayInvoice(sender *Balance, receiver string, amount, fee Amount, orderID, invoiceID, memo string) (*PayResult, error) {
 	ts, err := txtime.GetTime(pb.stub)
 	if nil != err {
 		return nil, errors.Wrap(err, "failed to get the timestamp")
 	}
 	payid := fmt.Sprintf("%d%s", ts.UnixNano(), pb.stub.GetTxID())
 	pay := NewPay(receiver, payid, amount, fee, sender.GetID(), "", orderID, memo, ts)
+	pay.InvoiceID = invoiceID
 	if err = pb.PutPay(pay); nil != err {
 		return nil, errors.Wrap(err, "failed to put new pay")
 	}
+	if len(orderID) > 0 {
+		if len(invoiceID) > 0 {
+			err = pb.PutInvoiceOrderID(receiver, orderID, invoiceID, payid)
+		} else {
+			err = pb.PutOrderID(receiver, orderID, payid)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	amount.Neg()
 	sender.Amount.Add(&amount)
@@ -260,10 +400,12 @@ func (pb *PayStub) PayPendingBalance(pbalance *PendingBalance, fee Amount, merch
 	if err = pb.PutPay(pay); nil != err {
 		return errors.Wrap(err, "failed to put new pay")
 	}
+	if len(orderID) > 0 {
+		if err = pb.PutOrderID(merchant, orderID, payid); err != nil {
+			return err
+		}
+	}
 
 	// remove pending balance
-	if err := pb.stub.DelState(NewBalanceStub(pb.stub).CreatePendingKey(pbalance.DOCTYPEID)); err != nil {
-		return errors.Wrap(err, "failed to delete the pending balance")
-	}
-	return nil
+	return NewBalanceStub(pb.stub).DeletePendingBalance(pbalance)
 }
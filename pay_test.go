@@ -0,0 +1,73 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPayOrderIDUniquePerMerchant(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	shop1 := h.newKID("shop1")
+	shop2 := h.newKID("shop2")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, shop1, shop2} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	shop1Addr := testAccountAddr("PCI", shop1)
+	shop2Addr := testAccountAddr("PCI", shop2)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	// the same order id of different merchants
+	r1 := &PayResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "pay", "", shop1Addr, "100", "order-1"), r1); err != nil {
+		t.Fatal(err)
+	}
+	r2 := &PayResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "pay", "", shop2Addr, "200", "order-1"), r2); err != nil {
+		t.Fatal(err)
+	}
+
+	// double submitted
+	if res := h.invokeAs(alice, "pay", "", shop1Addr, "100", "order-1"); res.Status == shim.OK {
+		t.Fatal("the order id must be unique per merchant")
+	}
+	if res := h.invokeAs(shop1, "invoice/create", "PCI", "100", "order-1"); res.Status == shim.OK {
+		t.Fatal("the order id is already paid")
+	}
+	assertBalance(t, h, aliceAddr, "700")
+
+	// get by (merchant, order id)
+	for _, r := range []*PayResult{r1, r2} {
+		pay := &Pay{}
+		if err := json.Unmarshal(h.mustInvokeAs(alice, "pay/get", "", r.Pay.DOCTYPEID, "order-1"), pay); err != nil {
+			t.Fatal(err)
+		}
+		if pay.PayID != r.Pay.PayID {
+			t.Fatalf("expected pay %s, got %s", r.Pay.PayID, pay.PayID)
+		}
+	}
+	if res := h.invokeAs(alice, "pay/get", "", shop1Addr, "order-2"); res.Status == shim.OK {
+		t.Fatal("no pay of the order id")
+	}
+
+	// invoice pays are also unique
+	inv := &Invoice{}
+	if err := json.Unmarshal(h.mustInvokeAs(shop1, "invoice/create", "PCI", "100", "order-2"), inv); err != nil {
+		t.Fatal(err)
+	}
+	h.mustInvokeAs(alice, "pay", "", shop1Addr, "100", "order-2")
+	if res := h.invokeAs(alice, "invoice/pay", inv.InvoiceID); res.Status == shim.OK {
+		t.Fatal("the order id is already paid")
+	}
+}
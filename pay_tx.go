@@ -10,7 +10,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
-	"github.com/key-inside/kiesnet-ccpkg/contract"
 	"github.com/key-inside/kiesnet-ccpkg/kid"
 	"github.com/key-inside/kiesnet-ccpkg/stringset"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
@@ -18,7 +17,7 @@ import (
 
 // params[0] : sender's address or token code
 // params[1] : receiver's address
-// params[2] : amount(>0)
+// params[2] : amount(>0, big int string or decimal string)
 // params[3] : optional. order id
 // params[4] : optional. memo (see MemoMaxLength)
 // params[5] : optional. expiry (duration represented by int64 seconds, multi-sig only)
@@ -56,8 +55,14 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		return shim.Error("can't pay to self")
 	}
 
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to pay")
+	}
+
 	// amount
-	amount, err := NewAmount(params[2])
+	amount, err := tb.ParseAmount(rAddr.Code, params[2])
 	if nil != err {
 		return shim.Error(err.Error())
 	}
@@ -104,8 +109,10 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	var expiry int64
 	orderID := ""
 	signers := stringset.New(kid)
+	quorum := 1
 	if a, ok := sender.(*JointAccount); ok {
 		signers.AppendSet(a.Holders)
+		quorum = a.Quorum()
 	}
 	// order id
 	if len(params) > 3 {
@@ -127,9 +134,16 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		}
 	}
 
+	// order id must be unique per merchant
+	if len(orderID) > 0 {
+		if err = NewPayStub(stub).AssertOrderIDNotUsed(receiver.GetID(), orderID); err != nil {
+			return responseError(err, "failed to pay")
+		}
+	}
+
 	var log *BalanceLog // log for response
 	payResult := &PayResult{}
-	if signers.Size() > 1 {
+	if quorum > 1 {
 		if signers.Size() > 128 {
 			return shim.Error("too many signers")
 		}
@@ -141,7 +155,7 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		if err != nil {
 			return responseError(err, "failed to marshal contract document")
 		}
-		con, err := contract.CreateContract(stub, docb, expiry, signers)
+		con, err := createContract(stub, docb, expiry, signers, quorum)
 		if err != nil {
 			return responseError(err, "failed to create a contract")
 		}
@@ -154,7 +168,7 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		}
 	} else {
 		fb := NewFeeStub(stub)
-		feeAmount, err := fb.CalcFee(rAddr, "pay", *amount)
+		feeAmount, feeExempt, err := fb.CalcFeeWithExemption(rAddr, "pay", *amount)
 		if err != nil {
 			return responseError(err, "failed to get the fee amount")
 		}
@@ -162,6 +176,7 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		if err != nil {
 			return responseError(err, "failed to pay")
 		}
+		payResult.BalanceLog.FeeExempt = feeExempt
 	}
 
 	if payResult.BalanceLog == nil {
@@ -177,7 +192,7 @@ func pay(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 }
 
 // params[0] : original pay id
-// params[1] : refund amount
+// params[1] : refund amount (big int string or decimal string)
 // params[2] : optional. memo (see MemoMaxLength)
 func payRefund(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 2 {
@@ -190,15 +205,6 @@ func payRefund(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return shim.Error(err.Error())
 	}
 
-	// amount
-	amount, err := NewAmount(params[1])
-	if nil != err {
-		return shim.Error(err.Error())
-	}
-	if amount.Sign() < 1 {
-		return shim.Error("invalid amount. must be greater than 0")
-	}
-
 	pb := NewPayStub(stub)
 	parentID := params[0]
 
@@ -231,6 +237,21 @@ func payRefund(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return shim.Error("can't refund to self")
 	}
 
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to refund")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(rAddr.Code, params[1])
+	if nil != err {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() < 1 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
 	// refund amount validation
 	if parentPay.Amount.Cmp(parentPay.TotalRefund.Copy().Add(amount)) < 0 {
 		return shim.Error("can't exceed the original pay amount")
@@ -296,12 +317,32 @@ func payRefund(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		feeAmount = parentPay.Fee.Copy()
 	}
 
+	// refund fee is charged to the merchant. it is deducted from the returned fee,
+	// so it is collected to the fee utxo when the merchant prunes the pays.
+	refundFee, err := NewFeeStub(stub).CalcFee(sAddr, "pay/refund", *amount)
+	if err != nil {
+		return responseError(err, "failed to get the fee amount")
+	}
+	feeAmount.Add(refundFee.Neg())
+
 	var log *BalanceLog
 	log, err = pb.Refund(sBal, rBal, *amount, *feeAmount, memo, parentPay)
 	if err != nil {
 		return responseError(err, "failed to pay")
 	}
 
+	// the invoice is refunded when its pay is fully refunded
+	if len(parentPay.InvoiceID) > 0 && parentPay.TotalRefund.Cmp(&parentPay.Amount) == 0 {
+		ib := NewInvoiceStub(stub)
+		inv, err := ib.GetInvoice(parentPay.InvoiceID)
+		if err != nil {
+			return responseError(err, "failed to get the invoice")
+		}
+		if _, err = ib.SetStatus(inv, InvoiceStatusRefunded); err != nil {
+			return responseError(err, "failed to update the invoice")
+		}
+	}
+
 	// log is not nil
 	data, err := json.Marshal(log)
 	if nil != err {
@@ -356,15 +397,10 @@ func payPrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	// start time
 	stime := txtime.Unix(0, 0)
 	if 0 < len(bal.LastPrunedPayID) {
-		s, err := strconv.ParseInt(bal.LastPrunedPayID[0:10], 10, 64)
-		if nil != err {
-			return responseError(err, "failed to get seconds from timestamp")
-		}
-		n, err := strconv.ParseInt(bal.LastPrunedPayID[10:19], 10, 64)
+		stime, err = GetPayIDTime(bal.LastPrunedPayID)
 		if nil != err {
-			return responseError(err, "failed to get nanoseconds from timestamp")
+			return responseError(err, "failed to get the last pruned time")
 		}
-		stime = txtime.Unix(s, n)
 	}
 
 	ts, err := txtime.GetTime(stub)
@@ -449,6 +485,7 @@ func payPrune(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 // params[3] : fetch size (if < 1 => default size, max 200)
 // params[4] : start time (time represented by int64 seconds)
 // params[5] : end time (time represented by int64 seconds)
+// params[6] : formatted flag (true = add formatted amounts with the token decimal)
 func payList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 1 {
 		return shim.Error("incorrect number of parameters. expecting 1+")
@@ -463,6 +500,7 @@ func payList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	bookmark := ""
 	fetchSize := 0
 	sortOrder := "desc" // if not specified to "asc", default is decending order
+	formatted := false
 	var stime, etime *txtime.Time
 	// sort order
 	if len(params) > 1 {
@@ -499,6 +537,13 @@ func payList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 								return shim.Error("invalid time parameters")
 							}
 						}
+						// formatted
+						if len(params) > 6 && len(params[6]) > 0 {
+							formatted, err = strconv.ParseBool(params[6])
+							if err != nil {
+								return shim.Error("invalid formatted flag")
+							}
+						}
 					}
 				}
 			}
@@ -519,6 +564,11 @@ func payList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if nil != err {
 		return responseError(err, "failed to get pays log")
 	}
+	if formatted {
+		if err = formatAmountsOfQueryResult(stub, addr.Code, res); err != nil {
+			return responseError(err, "failed to format pays log")
+		}
+	}
 
 	data, err := json.Marshal(res)
 	if err != nil {
@@ -528,11 +578,12 @@ func payList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	return shim.Success(data)
 }
 
-// params[0] : pay id
-// params[1] : optional. order id (vendor specific)
+// params[0] : pay id (empty string = get by the order id)
+// params[1] : optional. merchant's address
+// params[2] : optional. order id (vendor specific)
 func payGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 1 {
-		return shim.Error("incorrect number of parameters. expecting 1 or 2")
+		return shim.Error("incorrect number of parameters. expecting 1 or 3")
 	}
 
 	// authentication
@@ -542,19 +593,20 @@ func payGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	}
 
 	payID := params[0]
-	orderID := ""
-	if len(params) == 2 {
-		orderID = params[1]
-	}
 
 	pb := NewPayStub(stub)
 	var pay *Pay
 	if "" == payID {
-		if "" == orderID {
-			return shim.Error("invalid parameter")
+		if len(params) != 3 || "" == params[2] {
+			return shim.Error("invalid parameter. expecting merchant's address and order id")
+		}
+		var addr *Address
+		addr, err = ParseAddress(params[1])
+		if err != nil {
+			return responseError(err, "failed to parse the merchant's account address")
 		}
 		// get by order id
-		pay, err = pb.GetPayByOrderID(orderID)
+		pay, err = pb.GetPayByOrderID(addr.String(), params[2])
 	} else {
 		// get by pay id
 		pay, err = pb.GetPay(payID)
@@ -590,6 +642,9 @@ func executePay(stub shim.ChaincodeStubInterface, cid string, doc []interface{})
 
 	fb := NewFeeStub(stub)
 	rAddr, _ := ParseAddress(doc[3].(string)) // merchant
+	if err = NewTokenStub(stub).AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to pay a pending balance")
+	}
 	feeAmount, err := fb.CalcFee(rAddr, "pay", pb.Amount)
 	if err != nil {
 		return responseError(err, "failed to get the fee amount")
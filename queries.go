@@ -72,6 +72,33 @@ func CreateQueryBalanceLogsByIDAndTimes(id, typeStr string, stime, etime *txtime
 	return fmt.Sprintf(QueryBalanceLogsByIDAndTimes, id, _type, stime.String(), etime.String(), _sort, _index)
 }
 
+// QueryBalanceLogsByIDAtTime _
+const QueryBalanceLogsByIDAtTime = `{
+	"selector": {
+		"@balance_log": "%s",
+		%s
+		"created_time": {
+			"$lte": "%s"
+		}
+	},
+	"sort": [%s],
+	"use_index": ["balance", "%s"]
+}`
+
+// CreateQueryBalanceLogsByIDAtTime generates query string to fetch balance logs created at or before the time (latest first).
+// Without the type, receive delta logs are excluded.
+func CreateQueryBalanceLogsByIDAtTime(id, typeStr string, t *txtime.Time) string {
+	_type := fmt.Sprintf(`"type":{"$ne":%d},`, BalanceLogTypeReceiveDelta) // the amount of the receive delta log is not the balance
+	_sort := `{"@balance_log": "desc"}, {"created_time": "desc"}`
+	_index := "logs"
+	if typeStr != "" {
+		_type = fmt.Sprintf(`"type":%s,`, typeStr)
+		_sort = `{"@balance_log": "desc"}, {"type": "desc"}, {"created_time": "desc"}`
+		_index = "logs-type"
+	}
+	return fmt.Sprintf(QueryBalanceLogsByIDAtTime, id, _type, t.String(), _sort, _index)
+}
+
 // QueryHoldersByID _
 const QueryHoldersByID = `{
 	"selector": {
@@ -124,6 +151,49 @@ func CreateQueryPendingBalancesByAddress(addr, sort string) string {
 	return fmt.Sprintf(QueryPendingBalancesByAddress, addr, _sort)
 }
 
+// QueryPendingBalancesByAddressAtTime _
+const QueryPendingBalancesByAddressAtTime = `{
+	"selector": {
+		"@pending_balance": {
+			"$exists": true
+		},
+		"account": "%s",
+		"created_time": {
+			"$lte": "%s"
+		}
+	},
+	"sort": ["account", "created_time"],
+	"use_index": ["pending-balance", "created-time"]
+}`
+
+// CreateQueryPendingBalancesByAddressAtTime generates query string to fetch pending balances created at or before the time.
+func CreateQueryPendingBalancesByAddressAtTime(addr string, t *txtime.Time) string {
+	return fmt.Sprintf(QueryPendingBalancesByAddressAtTime, addr, t.String())
+}
+
+// QueryRemovedPendingBalancesByAddressAtTime _
+const QueryRemovedPendingBalancesByAddressAtTime = `{
+	"selector": {
+		"@removed_pending_balance": {
+			"$exists": true
+		},
+		"account": "%s",
+		"created_time": {
+			"$lte": "%s"
+		},
+		"removed_time": {
+			"$gt": "%s"
+		}
+	},
+	"sort": ["account", "created_time"],
+	"use_index": ["removed-pending-balance", "created-time"]
+}`
+
+// CreateQueryRemovedPendingBalancesByAddressAtTime generates query string to fetch pending balances created at or before the time and removed after the time.
+func CreateQueryRemovedPendingBalancesByAddressAtTime(addr string, t *txtime.Time) string {
+	return fmt.Sprintf(QueryRemovedPendingBalancesByAddressAtTime, addr, t.String(), t.String())
+}
+
 // QueryPrunePays _
 const QueryPrunePays = `{
 	"selector":{		
@@ -198,15 +268,16 @@ func CreateQueryPaysByID(id, sortOrder string) string {
 // QueryPayByOrderID _
 const QueryPayByOrderID = `{
 	"selector":{
+		"@pay":"%s",
 		"order_id":"%s"
 	},
-	"sort":["order_id"],
+	"sort":["@pay","order_id"],
 	"use_index":["pay","order-id"]
 }`
 
 // CreateQueryPayByOrderID _
-func CreateQueryPayByOrderID(orderID string) string {
-	return fmt.Sprintf(QueryPayByOrderID, orderID)
+func CreateQueryPayByOrderID(merchant, orderID string) string {
+	return fmt.Sprintf(QueryPayByOrderID, merchant, orderID)
 }
 
 // QueryPruneFee _
@@ -265,3 +336,157 @@ const QueryFeesByCode = `{
 func CreateQueryFeesByCode(tokenCode string) string {
 	return fmt.Sprintf(QueryFeesByCode, tokenCode)
 }
+
+// QueryAccountFreezeLogs _
+const QueryAccountFreezeLogs = `{
+	"selector":{
+		"@account_freeze_log":"%s"
+	},
+	"sort":[{"@account_freeze_log":"desc"},{"created_time":"desc"}],
+	"use_index":["account","freeze-logs"]
+}`
+
+// CreateQueryAccountFreezeLogs _
+func CreateQueryAccountFreezeLogs(addr string) string {
+	return fmt.Sprintf(QueryAccountFreezeLogs, addr)
+}
+
+// QueryInvoicesByAddress _
+const QueryInvoicesByAddress = `{
+	"selector":{
+		"@invoice":"%s"
+	},
+	"sort":[{"@invoice":"desc"},{"created_time":"desc"}],
+	"use_index":["invoice","list"]
+}`
+
+// CreateQueryInvoicesByAddress _
+func CreateQueryInvoicesByAddress(addr string) string {
+	return fmt.Sprintf(QueryInvoicesByAddress, addr)
+}
+
+// QueryFeeExemptsByCode _
+const QueryFeeExemptsByCode = `{
+	"selector":{
+		"@fee_exempt":"%s"
+	},
+	"sort":[{"@fee_exempt":"desc"},{"created_time":"desc"}],
+	"use_index":["fee","exempt-list"]
+}`
+
+// CreateQueryFeeExemptsByCode _
+func CreateQueryFeeExemptsByCode(tokenCode string) string {
+	return fmt.Sprintf(QueryFeeExemptsByCode, tokenCode)
+}
+
+// QuerySchedulesByAddress _
+const QuerySchedulesByAddress = `{
+	"selector":{
+		"@schedule":"%s"
+	},
+	"sort":[{"@schedule":"desc"},{"created_time":"desc"}],
+	"use_index":["schedule","list"]
+}`
+
+// CreateQuerySchedulesByAddress _
+func CreateQuerySchedulesByAddress(addr string) string {
+	return fmt.Sprintf(QuerySchedulesByAddress, addr)
+}
+
+// QueryDueSchedules _
+const QueryDueSchedules = `{
+	"selector":{
+		"@schedule":{
+			"$exists":true
+		},
+		"token":"%s",
+		"status":%d,
+		"next_time":{
+			"$lte":"%s"
+		}
+	},
+	"sort":["token","status","next_time"],
+	"limit":%d,
+	"use_index":["schedule","due"]
+}`
+
+// CreateQueryDueSchedules generates query string to fetch active schedules due at or before the time. (max ScheduleRunSize)
+func CreateQueryDueSchedules(tokenCode string, t *txtime.Time) string {
+	return fmt.Sprintf(QueryDueSchedules, tokenCode, ScheduleStatusActive, t.String(), ScheduleRunSize)
+}
+
+// QueryAuditRecords _
+const QueryAuditRecords = `{
+	"selector":{
+		%s
+	},
+	"use_index":[%s]
+}`
+
+// CreateQueryAuditRecords generates query string to fetch the records of the token audit step.
+// The addresses are selected by the range of the token (indexed), and the regex filters out the other tokens which have the code as a prefix.
+func CreateQueryAuditRecords(tokenCode string, step TokenAuditStep) string {
+	addr := fmt.Sprintf(`{"$gte":"%s01","$lt":"%s03","$regex":"^%s0[12][0-9A-F]{48}$"}`, tokenCode, tokenCode, tokenCode) // account addresses of the token
+	var selector, index string
+	switch step {
+	case TokenAuditStepBalance:
+		selector = fmt.Sprintf(`"@balance":{"$exists":true},"token":"%s"`, tokenCode)
+		index = `"balance","holders"`
+	case TokenAuditStepPendingBalance:
+		selector = fmt.Sprintf(`"@pending_balance":{"$exists":true},"account":%s`, addr)
+		index = `"pending-balance","created-time"`
+	case TokenAuditStepBalanceDelta:
+		selector = fmt.Sprintf(`"@balance_delta":%s`, addr)
+		index = `"balance","delta-audit"`
+	case TokenAuditStepPay:
+		selector = fmt.Sprintf(`"@pay":%s`, addr)
+		index = `"pay","list"`
+	case TokenAuditStepFee:
+		selector = fmt.Sprintf(`"@fee":"%s"`, tokenCode)
+		index = `"fee","list"`
+	case TokenAuditStepHTLC:
+		selector = fmt.Sprintf(`"@htlc":{"$exists":true},"sender":%s,"status":%d`, addr, HTLCStatusLocked)
+		index = `"htlc","audit"`
+	default: // vesting
+		selector = fmt.Sprintf(`"@vesting":{"$exists":true},"sender":%s`, addr)
+		index = `"vesting","audit"`
+	}
+	return fmt.Sprintf(QueryAuditRecords, selector, index)
+}
+
+// QueryHolders _
+const QueryHolders = `{
+	"selector":{
+		"@balance":{
+			"$exists":true
+		},
+		"token":"%s",
+		"digits":{
+			"$gt":0
+		}
+	},
+	"sort":[{"token":"desc"},{"digits":"desc"},{"amount":"desc"}],
+	"use_index":["balance","holders"]
+}`
+
+// CreateQueryHolders generates query string to fetch funded balances of the token. (largest first)
+// Amounts are strings, so they are sorted by the number of digits first.
+func CreateQueryHolders(tokenCode string) string {
+	return fmt.Sprintf(QueryHolders, tokenCode)
+}
+
+// QueryAccountsByToken _
+const QueryAccountsByToken = `{
+	"selector":{
+		"@account":{
+			"$exists":true
+		},
+		"token":"%s"
+	},
+	"use_index":["account","token"]
+}`
+
+// CreateQueryAccountsByToken _
+func CreateQueryAccountsByToken(tokenCode string) string {
+	return fmt.Sprintf(QueryAccountsByToken, tokenCode)
+}
@@ -77,3 +77,20 @@ func (qr *QueryResult) MarshalJSON() ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// FormatAmounts adds formatted amounts to the records. (see AppendFormattedAmounts)
+func (qr *QueryResult) FormatAmounts(decimal int) error {
+	docs := []map[string]interface{}{}
+	if err := json.Unmarshal(qr.Records, &docs); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		AppendFormattedAmounts(doc, decimal)
+	}
+	records, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	qr.Records = records
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// RequestIDTransientKey is the transient key of the client-supplied request ID (idempotency key)
+const RequestIDTransientKey = "request_id"
+
+// RequestIDMaxLength _
+const RequestIDMaxLength = 128
+
+// Request is the result of the invocation with the request ID.
+// It is scoped to the invoker, so different invokers can use the same request ID.
+type Request struct {
+	DOCTYPEID   string          `json:"@request"` // invoker's KID
+	RequestID   string          `json:"request_id"`
+	Fn          string          `json:"fn"`
+	TxID        string          `json:"txid"`
+	Payload     json.RawMessage `json:"payload,omitempty"` // the original response payload
+	CreatedTime *txtime.Time    `json:"created_time,omitempty"`
+}
@@ -0,0 +1,89 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// RequestStub _
+type RequestStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewRequestStub _
+func NewRequestStub(stub shim.ChaincodeStubInterface) *RequestStub {
+	return &RequestStub{stub}
+}
+
+// CreateKey _
+func (rb *RequestStub) CreateKey(kid, requestID string) string {
+	return fmt.Sprintf("REQ_%s_%s", kid, requestID)
+}
+
+// GetRequestID returns the request ID in the transient map. (empty string = no request ID)
+func (rb *RequestStub) GetRequestID() (string, error) {
+	transient, err := rb.stub.GetTransient()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the transient map")
+	}
+	requestID := string(transient[RequestIDTransientKey])
+	if len(requestID) > RequestIDMaxLength {
+		return "", errors.Errorf("the request ID is too long (max %d)", RequestIDMaxLength)
+	}
+	return requestID, nil
+}
+
+// GetRequest _
+func (rb *RequestStub) GetRequest(kid, requestID string) (*Request, error) {
+	data, err := rb.stub.GetState(rb.CreateKey(kid, requestID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the request state")
+	}
+	if data == nil {
+		return nil, NotExistedRequestError{id: requestID}
+	}
+	req := &Request{}
+	if err = json.Unmarshal(data, req); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the request")
+	}
+	return req, nil
+}
+
+// CreateRequest stores the response payload of the invocation.
+func (rb *RequestStub) CreateRequest(kid, requestID, fn string, payload []byte) (*Request, error) {
+	ts, err := txtime.GetTime(rb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	req := &Request{
+		DOCTYPEID:   kid,
+		RequestID:   requestID,
+		Fn:          fn,
+		TxID:        rb.stub.GetTxID(),
+		Payload:     payload,
+		CreatedTime: ts,
+	}
+	if err = rb.PutRequest(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// PutRequest _
+func (rb *RequestStub) PutRequest(req *Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the request")
+	}
+	if err = rb.stub.PutState(rb.CreateKey(req.DOCTYPEID, req.RequestID), data); err != nil {
+		return errors.Wrap(err, "failed to put the request state")
+	}
+	return nil
+}
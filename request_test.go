@@ -0,0 +1,62 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestIdempotentRequest(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	transient := map[string][]byte{RequestIDTransientKey: []byte("req-1")}
+
+	// retried transfer returns the original log
+	first := h.invokeWithTransient(alice, transient, "transfer", "", bobAddr, "100")
+	if first.Status != shim.OK {
+		t.Fatal(first.Message)
+	}
+	retry := h.invokeWithTransient(alice, transient, "transfer", "", bobAddr, "100")
+	if retry.Status != shim.OK || !bytes.Equal(first.Payload, retry.Payload) {
+		t.Fatalf("unexpected retry response: %s", retry.Payload)
+	}
+	assertBalance(t, h, aliceAddr, "899")
+	assertBalance(t, h, bobAddr, "100")
+
+	// the request ID of the other function
+	if res := h.invokeWithTransient(alice, transient, "pay", "", bobAddr, "100"); res.Status == shim.OK {
+		t.Fatal("the request ID must not be reused by the other function")
+	}
+
+	// scoped to the invoker
+	if res := h.invokeWithTransient(bob, transient, "transfer", "", aliceAddr, "10"); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "909")
+
+	// failed invocations are not saved
+	transient = map[string][]byte{RequestIDTransientKey: []byte("req-2")}
+	if res := h.invokeWithTransient(alice, transient, "transfer", "", bobAddr, "100000"); res.Status == shim.OK {
+		t.Fatal("transfer must fail")
+	}
+	if res := h.invokeWithTransient(alice, transient, "transfer", "", bobAddr, "9"); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "900")
+}
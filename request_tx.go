@@ -0,0 +1,52 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+)
+
+// idempotent wraps the invoke function with the client-supplied request ID. (see RequestIDTransientKey)
+// If the invoker has already succeeded with the request ID, it returns the original payload without executing again.
+// Without the request ID, it is the same as the wrapped function.
+func idempotent(txFn TxFunc) TxFunc {
+	return func(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+		rb := NewRequestStub(stub)
+		requestID, err := rb.GetRequestID()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(requestID) == 0 {
+			return txFn(stub, params)
+		}
+
+		// authentication
+		kid, err := kid.GetID(stub, false)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		fn, _ := stub.GetFunctionAndParameters()
+		req, err := rb.GetRequest(kid, requestID)
+		if err == nil { // replay
+			if req.Fn != fn {
+				return shim.Error("the request ID is already used by [" + req.Fn + "]")
+			}
+			return shim.Success(req.Payload)
+		}
+		if _, ok := err.(NotExistedRequestError); !ok {
+			return responseError(err, "failed to get the request")
+		}
+
+		res := txFn(stub, params)
+		if res.Status != shim.OK {
+			return res
+		}
+		if _, err = rb.CreateRequest(kid, requestID, fn, res.Payload); err != nil {
+			return responseError(err, "failed to save the request")
+		}
+		return res
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// testTokenMeta is the knt meta used by scenarios.
+// transfer fee 1%, pay fee 2%
+var testTokenMeta = map[string]string{
+	"decimal":        "0",
+	"max_supply":     "1000000",
+	"initial_supply": "10000",
+	"fee":            "transfer=0.01;pay=0.02",
+}
+
+// testAccountAddr returns the PAOT address of the KID.
+func testAccountAddr(code, kid string) string {
+	return NewAddress(code, AccountTypePersonal, kid).String()
+}
+
+// getTestToken _
+func getTestToken(t *testing.T, h *testHarness, code string) *Token {
+	t.Helper()
+	token := &Token{}
+	if err := json.Unmarshal(h.getState(NewTokenStub(nil).CreateKey(code)), token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// assertBalance checks the committed balance of the account.
+func assertBalance(t *testing.T, h *testHarness, addr, expected string) {
+	t.Helper()
+	bal := &Balance{}
+	if err := json.Unmarshal(h.getState(NewBalanceStub(nil).CreateKey(addr)), bal); err != nil {
+		t.Fatal(err)
+	}
+	if bal.Amount.String() != expected {
+		t.Fatalf("balance of %s: expected %s, got %s", addr, expected, bal.Amount.String())
+	}
+}
+
+// create → account → transfer → pay → refund → pay/prune → fee/prune
+func TestScenarioTransferPayPrune(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	merchant := h.newKID("merchant")
+
+	// token/create
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	token := getTestToken(t, h, "PCI")
+	genesis := token.GenesisAccount
+	if token.Supply.String() != "10000" {
+		t.Fatalf("unexpected supply: %s", token.Supply.String())
+	}
+	if token.FeePolicy == nil || token.FeePolicy.TargetAddress != genesis {
+		t.Fatal("fee target must be the genesis account")
+	}
+	assertBalance(t, h, genesis, "10000")
+
+	// account/create
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(merchant, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	merchantAddr := testAccountAddr("PCI", merchant)
+	if res := h.invokeAs(alice, "account/create", "PCI"); res.Status == shim.OK {
+		t.Fatal("duplicated account must not be created")
+	}
+
+	// transfer from genesis (no fee)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+	assertBalance(t, h, genesis, "9000")
+	assertBalance(t, h, aliceAddr, "1000")
+
+	// transfer with fee
+	data := h.mustInvokeAs(alice, "transfer", "", merchantAddr, "100", "hello")
+	log := &BalanceLog{}
+	if err := json.Unmarshal(data, log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeSend || log.Fee == nil || log.Fee.String() != "1" {
+		t.Fatalf("unexpected send log: %s", data)
+	}
+	assertBalance(t, h, aliceAddr, "899")
+	assertBalance(t, h, merchantAddr, "100")
+
+	if res := h.invokeAs(alice, "transfer", "", merchantAddr, "1000"); res.Status == shim.OK {
+		t.Fatal("transfer must fail on insufficient balance")
+	}
+	if res := h.invokeAs(merchant, "transfer", aliceAddr, merchantAddr, "1"); res.Status == shim.OK {
+		t.Fatal("transfer must fail if the invoker is not holder")
+	}
+	assertBalance(t, h, aliceAddr, "899")
+
+	// pay
+	data = h.mustInvokeAs(alice, "pay", "", merchantAddr, "200", "order-1", "goods")
+	result := &PayResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Pay == nil || result.Pay.Fee.String() != "4" || result.Pay.OrderID != "order-1" {
+		t.Fatalf("unexpected pay result: %s", data)
+	}
+	assertBalance(t, h, aliceAddr, "699")
+	assertBalance(t, h, merchantAddr, "100") // UTXO
+
+	// pay/refund (partial)
+	if res := h.invokeAs(alice, "pay/refund", result.Pay.PayID, "50"); res.Status == shim.OK {
+		t.Fatal("refund must be done by the merchant")
+	}
+	if res := h.invokeAs(merchant, "pay/refund", result.Pay.PayID, "300"); res.Status == shim.OK {
+		t.Fatal("refund must not exceed the pay amount")
+	}
+	h.mustInvokeAs(merchant, "pay/refund", result.Pay.PayID, "50", "partial")
+	assertBalance(t, h, aliceAddr, "749")
+
+	// pay/prune : (200 - 50) - (4 - 1)
+	data = h.mustInvokeAs(merchant, "pay/prune", "PCI", "false")
+	paySum := &PaySum{}
+	if err := json.Unmarshal(data, paySum); err != nil {
+		t.Fatal(err)
+	}
+	if paySum.Count != 2 || paySum.Sum.String() != "150" || paySum.Fee.String() != "3" {
+		t.Fatalf("unexpected pay prune result: %s", data)
+	}
+	assertBalance(t, h, merchantAddr, "247")
+	if res := h.invokeAs(merchant, "pay/prune", "PCI", "false"); res.Status == shim.OK {
+		t.Fatal("pays must not be pruned twice")
+	}
+
+	// fee/prune : 1 (transfer) + 3 (pay)
+	if res := h.invokeAs(alice, "fee/prune", "PCI", "false"); res.Status == shim.OK {
+		t.Fatal("fee/prune must be done by a holder of the fee target")
+	}
+	data = h.mustInvokeAs(issuer, "fee/prune", "PCI", "false")
+	feeSum := &FeeSum{}
+	if err := json.Unmarshal(data, feeSum); err != nil {
+		t.Fatal(err)
+	}
+	if feeSum.Count != 2 || feeSum.Sum.String() != "4" {
+		t.Fatalf("unexpected fee prune result: %s", data)
+	}
+	assertBalance(t, h, genesis, "9004")
+
+	// supply = sum of balances
+	token = getTestToken(t, h, "PCI")
+	if token.Supply.String() != "10000" {
+		t.Fatalf("unexpected supply: %s", token.Supply.String())
+	}
+}
+
+// joint account and multi-sig transfer through kiesnet-contract
+func TestScenarioJointAccountContract(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+
+	// joint account
+	data := h.mustInvokeAs(alice, "account/create", "PCI", bobAddr)
+	con := map[string]interface{}{}
+	if err := json.Unmarshal(data, &con); err != nil {
+		t.Fatal(err)
+	}
+	cid := con["@contract"].(string)
+	if res := h.approveContract(cid, alice); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	if res := h.approveContract(cid, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	res := h.invokeAs(alice, "account/list", "PCI")
+	list := struct {
+		Records []*Holder `json:"records"`
+	}{}
+	if err := json.Unmarshal(res.Payload, &list); err != nil {
+		t.Fatal(err)
+	}
+	jointAddr := ""
+	for _, holder := range list.Records {
+		if holder.Type == AccountTypeJoint {
+			jointAddr = holder.Address
+		}
+	}
+	if jointAddr == "" {
+		t.Fatal("joint account is not created")
+	}
+
+	h.mustInvokeAs(issuer, "transfer", genesis, jointAddr, "500")
+
+	// multi-sig transfer: deposit to a pending balance
+	data = h.mustInvokeAs(alice, "transfer", jointAddr, aliceAddr, "100")
+	log := &BalanceLog{}
+	if err := json.Unmarshal(data, log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeDeposit {
+		t.Fatalf("unexpected log: %s", data)
+	}
+	assertBalance(t, h, jointAddr, "399") // 500 - (100 + 1)
+	assertBalance(t, h, aliceAddr, "0")
+
+	cid = log.RID
+	if res := h.invokeAs(alice, "contract/execute", cid, "[]"); res.Status == shim.OK {
+		t.Fatal("contract callbacks must be invoked by kiesnet-contract")
+	}
+	if res := h.approveContract(cid, alice); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "0")
+	if res := h.approveContract(cid, bob); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "100")
+
+	// cancelled contract returns the pending balance
+	data = h.mustInvokeAs(bob, "transfer", jointAddr, bobAddr, "100")
+	if err := json.Unmarshal(data, log); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, h, jointAddr, "298")
+	if res := h.cancelContract(log.RID, alice); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, jointAddr, "399")
+	assertBalance(t, h, bobAddr, "0")
+}
@@ -0,0 +1,89 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"time"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// ScheduleMinInterval is the minimum interval (seconds) of the schedule.
+const ScheduleMinInterval = 60
+
+// ScheduleStatus _
+type ScheduleStatus int8
+
+const (
+	// ScheduleStatusActive _
+	ScheduleStatusActive ScheduleStatus = iota
+	// ScheduleStatusCancelled _
+	ScheduleStatusCancelled
+	// ScheduleStatusFinished the next run time is over the end time
+	ScheduleStatusFinished
+)
+
+// Schedule is the standing order of the recurring transfer.
+// Its due run instances are executed by schedule/run.
+type Schedule struct {
+	DOCTYPEID      string         `json:"@schedule"` // sender address
+	ScheduleID     string         `json:"schedule_id"`
+	Token          string         `json:"token"`
+	Receiver       string         `json:"receiver"`
+	Amount         Amount         `json:"amount"`
+	Interval       int64          `json:"interval,omitempty"`        // seconds
+	IntervalMonths int            `json:"interval_months,omitempty"` // calendar months
+	Runs           int            `json:"runs"`                      // executed run instances, including failures
+	Failures       int            `json:"failures"`
+	LastRun        *ScheduleRun   `json:"last_run,omitempty"`
+	Status         ScheduleStatus `json:"status"`
+	Memo           string         `json:"memo"`
+	CreatedTime    *txtime.Time   `json:"created_time,omitempty"`
+	UpdatedTime    *txtime.Time   `json:"updated_time,omitempty"`
+	StartTime      *txtime.Time   `json:"start_time"`
+	NextTime       *txtime.Time   `json:"next_time,omitempty"` // nil if not active
+	EndTime        *txtime.Time   `json:"end_time,omitempty"`  // nil = no end
+}
+
+// ScheduleRun is the result of a run instance of the schedule.
+type ScheduleRun struct {
+	ScheduleID string       `json:"schedule_id"`
+	Seq        int          `json:"seq"`  // 0-based sequence of the run instance
+	Time       *txtime.Time `json:"time"` // scheduled time
+	Error      string       `json:"error,omitempty"`
+	Log        *BalanceLog  `json:"log,omitempty"` // sender's transfer log if succeeded
+}
+
+// ScheduleRunResult _
+type ScheduleRunResult struct {
+	Runs    []*ScheduleRun `json:"runs"`
+	HasMore bool           `json:"has_more"` // due run instances may remain
+}
+
+// GetID implements Identifiable
+func (s *Schedule) GetID() string {
+	return s.ScheduleID
+}
+
+// TimeOf returns the scheduled time of the n-th (0-based) run instance.
+func (s *Schedule) TimeOf(n int) *txtime.Time {
+	if s.IntervalMonths > 0 {
+		return txtime.New(s.StartTime.AddDate(0, n*s.IntervalMonths, 0))
+	}
+	return txtime.New(s.StartTime.Add(time.Duration(int64(n)*s.Interval) * time.Second))
+}
+
+// Advance records the run instance and moves the next time.
+// The schedule is finished if the next time is over the end time.
+func (s *Schedule) Advance(run *ScheduleRun) {
+	s.Runs++
+	if len(run.Error) > 0 {
+		s.Failures++
+	}
+	s.LastRun = run
+	s.NextTime = s.TimeOf(s.Runs)
+	if s.EndTime != nil && s.NextTime.Cmp(s.EndTime) > 0 {
+		s.Status = ScheduleStatusFinished
+		s.NextTime = nil
+	}
+}
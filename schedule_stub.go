@@ -0,0 +1,169 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// SchedulesFetchSize _
+const SchedulesFetchSize = 20
+
+// ScheduleRunSize is the maximum number of run instances executed by a schedule/run.
+const ScheduleRunSize = 100
+
+// ScheduleStub _
+type ScheduleStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewScheduleStub _
+func NewScheduleStub(stub shim.ChaincodeStubInterface) *ScheduleStub {
+	return &ScheduleStub{stub}
+}
+
+// CreateKey _
+func (sb *ScheduleStub) CreateKey(id string) string {
+	return "SCH_" + id
+}
+
+// GetSchedule _
+func (sb *ScheduleStub) GetSchedule(id string) (*Schedule, error) {
+	data, err := sb.stub.GetState(sb.CreateKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the schedule state")
+	}
+	if data == nil {
+		return nil, NotExistedScheduleError{id: id}
+	}
+	s := &Schedule{}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the schedule")
+	}
+	return s, nil
+}
+
+// GetQuerySchedules _
+func (sb *ScheduleStub) GetQuerySchedules(addr, bookmark string, fetchSize int) (*QueryResult, error) {
+	if fetchSize < 1 {
+		fetchSize = SchedulesFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+	query := CreateQuerySchedulesByAddress(addr)
+	iter, meta, err := sb.stub.GetQueryResultWithPagination(query, int32(fetchSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	return NewQueryResult(meta, iter)
+}
+
+// GetDueSchedules returns the active schedules of the token whose next time is at or before the time. (max ScheduleRunSize)
+// It is called by schedule/run which writes states, so it can't use a paginated query.
+func (sb *ScheduleStub) GetDueSchedules(tokenCode string, t *txtime.Time) ([]*Schedule, error) {
+	query := CreateQueryDueSchedules(tokenCode, t)
+	iter, err := sb.stub.GetQueryResult(query)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	ss := []*Schedule{}
+	for iter.HasNext() && len(ss) < ScheduleRunSize {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		s := &Schedule{}
+		if err = json.Unmarshal(kv.Value, s); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the schedule")
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// PutSchedule _
+func (sb *ScheduleStub) PutSchedule(s *Schedule) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the schedule")
+	}
+	if err = sb.stub.PutState(sb.CreateKey(s.ScheduleID), data); err != nil {
+		return errors.Wrap(err, "failed to put the schedule state")
+	}
+	return nil
+}
+
+// CreateSchedule _
+func (sb *ScheduleStub) CreateSchedule(sender, receiver string, amount Amount, interval int64, intervalMonths int, memo string, startTime, endTime *txtime.Time) (*Schedule, error) {
+	ts, err := txtime.GetTime(sb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	code, _ := ParseCode(sender)
+	s := &Schedule{
+		DOCTYPEID:      sender,
+		ScheduleID:     fmt.Sprintf("%d%s", ts.UnixNano(), sb.stub.GetTxID()),
+		Token:          code,
+		Receiver:       receiver,
+		Amount:         amount,
+		Interval:       interval,
+		IntervalMonths: intervalMonths,
+		Status:         ScheduleStatusActive,
+		Memo:           memo,
+		CreatedTime:    ts,
+		UpdatedTime:    ts,
+		StartTime:      startTime,
+		NextTime:       startTime,
+		EndTime:        endTime,
+	}
+	if err = sb.PutSchedule(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Cancel _
+func (sb *ScheduleStub) Cancel(s *Schedule) (*Schedule, error) {
+	ts, err := txtime.GetTime(sb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	s.Status = ScheduleStatusCancelled
+	s.NextTime = nil
+	s.UpdatedTime = ts
+	if err = sb.PutSchedule(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// scheduleRunStub shifts the tx timestamp by the sequence of the run instance in nanoseconds.
+// Balance logs and fee utxos are keyed by the tx timestamp, so every run instance
+// executed in the same transaction needs its own timestamp.
+type scheduleRunStub struct {
+	shim.ChaincodeStubInterface
+	seq int64
+}
+
+// GetTxTimestamp overrides shim.ChaincodeStubInterface
+func (s *scheduleRunStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	ts, err := s.ChaincodeStubInterface.GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	nanos := int64(ts.Nanos) + s.seq
+	return &timestamp.Timestamp{Seconds: ts.Seconds + nanos/1e9, Nanos: int32(nanos % 1e9)}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// getTestSchedules returns schedules of the sender. (latest first)
+func getTestSchedules(t *testing.T, h *testHarness, kid, sender string) []*Schedule {
+	t.Helper()
+	res := struct {
+		Records []*Schedule `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(kid, "schedule/list", sender), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Records
+}
+
+func TestSchedule(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	carolAddr := testAccountAddr("PCI", carol)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	if res := h.invokeAs(alice, "schedule/create", "", bobAddr, "100", "10"); res.Status == shim.OK {
+		t.Fatal("too short interval")
+	}
+	if res := h.invokeAs(bob, "schedule/create", aliceAddr, bobAddr, "100", "60"); res.Status == shim.OK {
+		t.Fatal("invoker is not holder")
+	}
+
+	// 100 to bob every minute (3 runs), 500 to carol every minute
+	end := strconv.FormatInt(h.clock.Unix()+150, 10)
+	toBob := &Schedule{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "schedule/create", "", bobAddr, "100", "60", "", end, "rent"), toBob); err != nil {
+		t.Fatal(err)
+	}
+	if toBob.Status != ScheduleStatusActive || toBob.NextTime == nil || toBob.EndTime == nil {
+		t.Fatalf("unexpected schedule: %+v", toBob)
+	}
+	toCarol := &Schedule{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "schedule/create", "", carolAddr, "500", "60"), toCarol); err != nil {
+		t.Fatal(err)
+	}
+
+	// both are due, executed in a transaction
+	res := &ScheduleRunResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "schedule/run", "PCI"), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Runs) != 2 || res.HasMore {
+		t.Fatalf("unexpected run result: %+v", res)
+	}
+	for _, run := range res.Runs {
+		if len(run.Error) > 0 || run.Log == nil {
+			t.Fatalf("unexpected run: %+v", run)
+		}
+	}
+	if changes := getTestBalanceEvent(t, h).Changes; len(changes) != 4 {
+		t.Fatalf("expected 4 balance changes, got %d", len(changes))
+	}
+	assertBalance(t, h, aliceAddr, "394") // 1000 - 101 - 505
+	assertBalance(t, h, bobAddr, "100")
+	assertBalance(t, h, carolAddr, "500")
+	fees := struct {
+		Records []*Fee `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "fee/list", "PCI"), &fees); err != nil {
+		t.Fatal(err)
+	}
+	if len(fees.Records) != 2 {
+		t.Fatalf("expected 2 fees, got %d", len(fees.Records))
+	}
+
+	// not due yet
+	res = &ScheduleRunResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "schedule/run", "PCI"), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Runs) != 0 {
+		t.Fatalf("expected no run, got %d", len(res.Runs))
+	}
+
+	// the failure of carol's doesn't block bob's
+	h.advance(60 * time.Second)
+	res = &ScheduleRunResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "schedule/run", "PCI"), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(res.Runs))
+	}
+	assertBalance(t, h, aliceAddr, "293")
+	assertBalance(t, h, carolAddr, "500")
+	for _, s := range getTestSchedules(t, h, alice, "PCI") {
+		switch s.ScheduleID {
+		case toBob.ScheduleID:
+			if s.Runs != 2 || s.Failures != 0 || s.Status != ScheduleStatusActive {
+				t.Fatalf("unexpected schedule: %+v", s)
+			}
+		case toCarol.ScheduleID:
+			if s.Runs != 2 || s.Failures != 1 || s.LastRun == nil || s.LastRun.Error != "not enough balance" {
+				t.Fatalf("unexpected schedule: %+v", s)
+			}
+			if s.NextTime.Cmp(s.TimeOf(2)) != 0 {
+				t.Fatalf("unexpected next time: %s", s.NextTime)
+			}
+		}
+	}
+
+	// cancelled by the sender only
+	if res := h.invokeAs(carol, "schedule/cancel", toCarol.ScheduleID); res.Status == shim.OK {
+		t.Fatal("only the sender can cancel")
+	}
+	h.mustInvokeAs(alice, "schedule/cancel", toCarol.ScheduleID)
+	if res := h.invokeAs(alice, "schedule/cancel", toCarol.ScheduleID); res.Status == shim.OK {
+		t.Fatal("the schedule is already cancelled")
+	}
+
+	// suspended receiver, and then finished after the end time
+	h.advance(60 * time.Second)
+	h.mustInvokeAs(bob, "account/suspend", "PCI")
+	res = &ScheduleRunResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "schedule/run", "PCI"), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Runs) != 1 || res.Runs[0].Error != "the receiver account is suspended" {
+		t.Fatalf("unexpected run result: %+v", res)
+	}
+	assertBalance(t, h, aliceAddr, "293")
+	for _, s := range getTestSchedules(t, h, alice, "PCI") {
+		if s.ScheduleID == toBob.ScheduleID && (s.Status != ScheduleStatusFinished || s.NextTime != nil || s.Runs != 3) {
+			t.Fatalf("unexpected schedule: %+v", s)
+		}
+		if s.ScheduleID == toCarol.ScheduleID && s.Status != ScheduleStatusCancelled {
+			t.Fatalf("unexpected schedule: %+v", s)
+		}
+	}
+	h.advance(60 * time.Second)
+	res = &ScheduleRunResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "schedule/run", "PCI"), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Runs) != 0 {
+		t.Fatalf("expected no run, got %d", len(res.Runs))
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// params[0] : sender address (empty string = personal account)
+// params[1] : receiver address
+// params[2] : amount (big int string or decimal string)
+// params[3] : interval (int64 seconds, or calendar months with 'M' suffix. e.g. "1M")
+// params[4] : optional. start time (time represented by int64 seconds, empty string or 0 = now)
+// params[5] : optional. end time (time represented by int64 seconds, empty string or 0 = no end)
+// params[6] : optional. memo (see MemoMaxLength)
+func scheduleCreate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 4 {
+		return shim.Error("incorrect number of parameters. expecting 4+")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// addresses
+	rAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the receiver's account address")
+	}
+	var sAddr *Address
+	if len(params[0]) > 0 {
+		sAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+	if sAddr.Equal(rAddr) {
+		return shim.Error("can't transfer to self")
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to create the schedule")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(rAddr.Code, params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	// interval
+	var interval int64
+	intervalMonths := 0
+	if strings.HasSuffix(params[3], "M") {
+		intervalMonths, err = strconv.Atoi(strings.TrimSuffix(params[3], "M"))
+		if err != nil || intervalMonths < 1 {
+			return shim.Error("invalid interval: need months")
+		}
+	} else {
+		interval, err = strconv.ParseInt(params[3], 10, 64)
+		if err != nil || interval < ScheduleMinInterval {
+			return shim.Error("invalid interval: need seconds (at least 60)")
+		}
+	}
+
+	// options
+	startTime := ts
+	var endTime *txtime.Time
+	memo := ""
+	if len(params) > 4 {
+		if len(params[4]) > 0 {
+			seconds, err := strconv.ParseInt(params[4], 10, 64)
+			if err != nil || seconds < 0 {
+				return shim.Error("invalid start time: need seconds since 1970")
+			}
+			if seconds > ts.Unix() {
+				startTime = txtime.Unix(seconds, 0)
+			}
+		}
+		// end time
+		if len(params) > 5 {
+			if len(params[5]) > 0 {
+				seconds, err := strconv.ParseInt(params[5], 10, 64)
+				if err != nil || seconds < 0 {
+					return shim.Error("invalid end time: need seconds since 1970")
+				}
+				if seconds > 0 {
+					endTime = txtime.Unix(seconds, 0)
+					if endTime.Cmp(startTime) < 0 {
+						return shim.Error("the end time is before the start time")
+					}
+				}
+			}
+			// memo
+			if len(params) > 6 {
+				if len(params[6]) > MemoMaxLength { // length limit
+					memo = params[6][:MemoMaxLength]
+				} else {
+					memo = params[6]
+				}
+			}
+		}
+	}
+
+	ab := NewAccountStub(stub, rAddr.Code)
+
+	// sender
+	sender, err := ab.GetAccount(sAddr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !sender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if sender.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+	if jac, ok := sender.(*JointAccount); ok && jac.Quorum() > 1 {
+		return shim.Error("multi-sig account can't create the schedule")
+	}
+
+	// receiver
+	receiver, err := ab.GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the receiver account")
+	}
+	if receiver.IsSuspended() {
+		return shim.Error("the receiver account is suspended")
+	}
+
+	s, err := NewScheduleStub(stub).CreateSchedule(sender.GetID(), receiver.GetID(), *amount, interval, intervalMonths, memo, startTime, endTime)
+	if err != nil {
+		return responseError(err, "failed to create the schedule")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return responseError(err, "failed to marshal the schedule")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : schedule id
+func scheduleCancel(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	sb := NewScheduleStub(stub)
+	s, err := sb.GetSchedule(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the schedule")
+	}
+	if s.Status != ScheduleStatusActive {
+		return shim.Error("the schedule is not active")
+	}
+
+	// sender
+	addr, _ := ParseAddress(s.DOCTYPEID) // err is nil
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+
+	if s, err = sb.Cancel(s); err != nil {
+		return responseError(err, "failed to cancel the schedule")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return responseError(err, "failed to marshal the schedule")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : sender's token code | account address
+// params[1] : optional. bookmark
+// params[2] : optional. fetch size (if < 1 => default size, max 200)
+func scheduleList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var addr *Address
+	code, err := ValidateTokenCode(params[0])
+	if nil == err { // by token code
+		addr = NewAddress(code, AccountTypePersonal, kid)
+	} else { // by address
+		addr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+	}
+
+	bookmark := ""
+	fetchSize := 0
+	if len(params) > 1 {
+		bookmark = params[1]
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	res, err := NewScheduleStub(stub).GetQuerySchedules(addr.String(), bookmark, fetchSize)
+	if err != nil {
+		return responseError(err, "failed to get schedules")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal schedules")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : token code
+// Anyone can run the due schedules. It executes at most ScheduleRunSize run instances.
+func scheduleRun(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	if _, err = kid.GetID(stub, true); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// token
+	if err = NewTokenStub(stub).AssertNotPaused(code); err != nil {
+		return responseError(err, "failed to run schedules")
+	}
+
+	sb := NewScheduleStub(stub)
+	ss, err := sb.GetDueSchedules(code, ts)
+	if err != nil {
+		return responseError(err, "failed to get due schedules")
+	}
+
+	runner := &scheduleRunner{
+		ab:       NewAccountStub(stub, code),
+		bb:       NewBalanceStub(stub),
+		balances: map[string]*Balance{},
+	}
+	res := &ScheduleRunResult{Runs: []*ScheduleRun{}}
+	for _, s := range ss {
+		if len(res.Runs) >= ScheduleRunSize {
+			break
+		}
+		// every due run instance, failures don't block the next one
+		for s.Status == ScheduleStatusActive && s.NextTime.Cmp(ts) <= 0 && len(res.Runs) < ScheduleRunSize {
+			run, err := runner.Run(&scheduleRunStub{stub, int64(len(res.Runs))}, s)
+			if err != nil {
+				return responseError(err, "failed to run the schedule")
+			}
+			s.Advance(run)
+			res.Runs = append(res.Runs, run)
+		}
+		s.UpdatedTime = ts
+		if err = sb.PutSchedule(s); err != nil {
+			return responseError(err, "failed to update the schedule")
+		}
+	}
+	res.HasMore = len(ss) >= ScheduleRunSize || len(res.Runs) >= ScheduleRunSize
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal the run result")
+	}
+	return shim.Success(data)
+}
+
+// scheduleRunner executes run instances in a transaction.
+// Written states are not readable in the same transaction, so it keeps the balances in progress.
+type scheduleRunner struct {
+	ab       *AccountStub
+	bb       *BalanceStub
+	balances map[string]*Balance
+}
+
+func (r *scheduleRunner) getBalance(account AccountInterface) (*Balance, error) {
+	if bal, ok := r.balances[account.GetID()]; ok {
+		return bal, nil
+	}
+	bal, err := r.bb.GetBalance(account.GetID())
+	if err != nil {
+		return nil, err
+	}
+	r.balances[account.GetID()] = bal
+	return bal, nil
+}
+
+// Run executes the next run instance of the schedule through the normal transfer and fee path.
+// The failure of the run instance is recorded in the result, and err is returned only if the transaction must be aborted.
+func (r *scheduleRunner) Run(stub shim.ChaincodeStubInterface, s *Schedule) (*ScheduleRun, error) {
+	run := &ScheduleRun{
+		ScheduleID: s.ScheduleID,
+		Seq:        s.Runs,
+		Time:       s.NextTime,
+	}
+
+	sAddr, _ := ParseAddress(s.DOCTYPEID) // err is nil
+	rAddr, _ := ParseAddress(s.Receiver)  // err is nil
+
+	sender, err := r.ab.GetAccount(sAddr)
+	if err != nil {
+		return nil, err
+	}
+	if sender.IsSuspended() {
+		run.Error = "the sender account is suspended"
+		return run, nil
+	}
+	receiver, err := r.ab.GetAccount(rAddr)
+	if err != nil {
+		return nil, err
+	}
+	if receiver.IsSuspended() {
+		run.Error = "the receiver account is suspended"
+		return run, nil
+	}
+
+	amount := s.Amount.Copy()
+	fee, err := NewFeeStub(stub).CalcFee(sAddr, "transfer", *amount)
+	if err != nil {
+		return nil, err
+	}
+	sBal, err := r.getBalance(sender)
+	if err != nil {
+		return nil, err
+	}
+	if sBal.Amount.Cmp(amount.Copy().Add(fee)) < 0 {
+		run.Error = "not enough balance"
+		return run, nil
+	}
+
+	var rBal *Balance
+	if receiver.IsDeltaReceiving() {
+		rBal, err = r.bb.GetReceiverBalance(receiver)
+	} else {
+		rBal, err = r.getBalance(receiver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	run.Log, err = NewBalanceStub(stub).Transfer(sBal, rBal, *amount, *fee, s.Memo, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -31,13 +31,108 @@ type Token struct {
 	LastPrunedFeeID string       `json:"last_pruned_fee_id,omitempty"`
 	GenesisAccount  string       `json:"genesis_account"`
 	FeePolicy       *FeePolicy   `json:"fee_policy,omitempty"` // FeePolicy is nil if and only if knt fee is never yet imported. Once knt is initiated/upgraded with fee, it wil always exists.
+	PausedTime      *txtime.Time `json:"paused_time,omitempty"`
+	PauseReason     string       `json:"pause_reason,omitempty"`
 	CreatedTime     *txtime.Time `json:"created_time,omitempty"`
 	UpdatedTime     *txtime.Time `json:"updated_time,omitempty"`
 }
 
+// IsPaused _
+func (t *Token) IsPaused() bool {
+	return t.PausedTime != nil
+}
+
 // TokenResult is response payload of token/burn and token/mint.
 type TokenResult struct {
 	Token      *Token             `json:"token,omitempty"`
 	BalanceLog *BalanceLog        `json:"balance_log,omitempty"`
 	Contract   *contract.Contract `json:"contract,omitempty"`
 }
+
+// TokenAuditStep is the doc type walked by token/audit, in order.
+type TokenAuditStep int8
+
+const (
+	// TokenAuditStepBalance _
+	TokenAuditStepBalance TokenAuditStep = iota
+	// TokenAuditStepPendingBalance _
+	TokenAuditStepPendingBalance
+	// TokenAuditStepBalanceDelta _
+	TokenAuditStepBalanceDelta
+	// TokenAuditStepPay unpruned pays
+	TokenAuditStepPay
+	// TokenAuditStepFee unpruned fees
+	TokenAuditStepFee
+	// TokenAuditStepHTLC locked HTLCs
+	TokenAuditStepHTLC
+	// TokenAuditStepVesting _
+	TokenAuditStepVesting
+	// TokenAuditStepDone _
+	TokenAuditStepDone
+)
+
+// TokenAudit is the totals of the token amounts, accumulated across pages by token/audit.
+// When all steps are walked, the total is compared with the supply.
+type TokenAudit struct {
+	Token          string         `json:"token"`
+	Step           TokenAuditStep `json:"step"`           // the next step
+	QueryBookmark  string         `json:"query_bookmark"` // bookmark of the step query
+	Records        int            `json:"records"`        // number of walked records
+	Balance        Amount         `json:"balance"`
+	PendingBalance Amount         `json:"pending_balance"`
+	PendingFee     Amount         `json:"pending_fee"`
+	BalanceDelta   Amount         `json:"balance_delta"`
+	Pay            Amount         `json:"pay"`     // unpruned pays (including the fee of the pays)
+	Fee            Amount         `json:"fee"`     // unpruned fees
+	HTLC           Amount         `json:"htlc"`    // amount + fee of locked HTLCs
+	Vesting        Amount         `json:"vesting"` // amount - claimed - revoked
+	Supply         *Amount        `json:"supply,omitempty"`
+	Total          *Amount        `json:"total,omitempty"`
+	Discrepancy    *Amount        `json:"discrepancy,omitempty"` // total - supply
+	Done           bool           `json:"done"`
+}
+
+// Sum returns the total of the accumulated amounts.
+func (a *TokenAudit) Sum() *Amount {
+	total := ZeroAmount()
+	for _, amount := range []*Amount{&a.Balance, &a.PendingBalance, &a.PendingFee, &a.BalanceDelta, &a.Pay, &a.Fee, &a.HTLC, &a.Vesting} {
+		total.Add(amount)
+	}
+	return total
+}
+
+// TokenAuditResult is response payload of token/audit.
+type TokenAuditResult struct {
+	*TokenAudit
+	Bookmark string `json:"bookmark,omitempty"` // pass it to the next token/audit (empty if done)
+}
+
+// TokenStatsStep _
+type TokenStatsStep int8
+
+const (
+	// TokenStatsStepAccount _
+	TokenStatsStepAccount TokenStatsStep = iota
+	// TokenStatsStepBalance funded balances
+	TokenStatsStepBalance
+	// TokenStatsStepDone _
+	TokenStatsStepDone
+)
+
+// TokenStats is the account statistics of the token, accumulated across pages by token/stats.
+type TokenStats struct {
+	Token         string              `json:"token"`
+	Step          TokenStatsStep      `json:"step"`           // the next step
+	QueryBookmark string              `json:"query_bookmark"` // bookmark of the step query
+	Accounts      map[AccountType]int `json:"accounts"`       // number of accounts by the account type
+	Suspended     int                 `json:"suspended"`      // number of suspended accounts (including frozen accounts)
+	Funded        int                 `json:"funded"`         // number of accounts which have a positive balance
+	Histogram     map[int]int         `json:"histogram"`      // number of funded balances by the digits of the amount
+	Done          bool                `json:"done"`
+}
+
+// TokenStatsResult is response payload of token/stats.
+type TokenStatsResult struct {
+	*TokenStats
+	Bookmark string `json:"bookmark,omitempty"` // pass it to the next token/stats (empty if done)
+}
@@ -11,6 +11,15 @@ import (
 	"github.com/pkg/errors"
 )
 
+// DecimalTransientKey is the transient key of the flag that amount parameters are decimal strings. ("true")
+const DecimalTransientKey = "decimal"
+
+// TokenAuditFetchSize _
+const TokenAuditFetchSize = 100
+
+// TokenStatsFetchSize _
+const TokenStatsFetchSize = 100
+
 // TokenStub _
 type TokenStub struct {
 	stub shim.ChaincodeStubInterface
@@ -30,15 +39,17 @@ func (tb *TokenStub) CreateKey(code string) string {
 func (tb *TokenStub) CreateToken(code string, decimal int, maxSupply, supply Amount, feePolicy *FeePolicy, holders *stringset.Set) (*Token, error) {
 	// create genesis account (joint account)
 	ab := NewAccountStub(tb.stub, code)
-	account, balance, err := ab.CreateJointAccount(holders)
+	account, balance, err := ab.CreateJointAccount(holders, 0)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create the genesis account")
 	}
 
 	if feePolicy != nil {
 		if len(feePolicy.TargetAddress) > 0 {
-			if _, err := ab.GetAccountState(feePolicy.TargetAddress); err != nil {
-				return nil, err
+			for _, target := range feePolicy.GetTargets() {
+				if _, err := ab.GetAccountState(target.Address); err != nil {
+					return nil, err
+				}
 			}
 		} else {
 			feePolicy.TargetAddress = account.GetID()
@@ -122,6 +133,9 @@ func (tb *TokenStub) Burn(token *Token, bal *Balance, amount Amount) (*Token, *B
 	}
 
 	// token
+	if token.IsPaused() {
+		return token, nil, PausedTokenError{code: token.DOCTYPEID}
+	}
 	if token.Supply.Sign() == 0 {
 		return token, nil, SupplyError{reason: "no supply"}
 	}
@@ -160,6 +174,9 @@ func (tb *TokenStub) Mint(token *Token, bal *Balance, amount Amount) (*Token, *B
 	}
 
 	// token
+	if token.IsPaused() {
+		return token, nil, PausedTokenError{code: token.DOCTYPEID}
+	}
 	if token.Supply.Cmp(&token.MaxSupply) >= 0 {
 		return token, nil, SupplyError{reason: "max supplied"}
 	}
@@ -186,3 +203,297 @@ func (tb *TokenStub) Mint(token *Token, bal *Balance, amount Amount) (*Token, *B
 
 	return token, log, nil
 }
+
+// ParseAmount parses the amount string.
+// If the decimal transient is "true", it is a decimal string (e.g. "12.345") scaled by the token decimal.
+// If not, it is a raw big int string.
+func (tb *TokenStub) ParseAmount(code, val string) (*Amount, error) {
+	transient, err := tb.stub.GetTransient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the transient map")
+	}
+	if string(transient[DecimalTransientKey]) != "true" {
+		return NewAmount(val)
+	}
+	token, err := tb.GetToken(code)
+	if err != nil {
+		return nil, err
+	}
+	return NewAmountWithDecimal(val, token.Decimal)
+}
+
+// AssertNotPaused returns PausedTokenError if the token is paused.
+func (tb *TokenStub) AssertNotPaused(code string) error {
+	token, err := tb.GetToken(code)
+	if err != nil {
+		return err
+	}
+	if token.IsPaused() {
+		return PausedTokenError{code: code}
+	}
+	return nil
+}
+
+// Pause _
+func (tb *TokenStub) Pause(token *Token, reason string) (*Token, error) {
+	if token.IsPaused() {
+		return nil, errors.New("already paused")
+	}
+
+	ts, err := txtime.GetTime(tb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	token.PausedTime = ts
+	token.PauseReason = reason
+	token.UpdatedTime = ts
+	if err = tb.PutToken(token); err != nil {
+		return nil, errors.Wrap(err, "failed to update the token")
+	}
+
+	return token, nil
+}
+
+// Unpause _
+func (tb *TokenStub) Unpause(token *Token) (*Token, error) {
+	if !token.IsPaused() {
+		return nil, errors.New("not paused")
+	}
+
+	ts, err := txtime.GetTime(tb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	token.PausedTime = nil
+	token.PauseReason = ""
+	token.UpdatedTime = ts
+	if err = tb.PutToken(token); err != nil {
+		return nil, errors.Wrap(err, "failed to update the token")
+	}
+
+	return token, nil
+}
+
+// SetGenesisAccount moves the genesis role to the joint account.
+// The fee target which is the old genesis account is moved too, but the balance of the old genesis account is not.
+func (tb *TokenStub) SetGenesisAccount(token *Token, account *JointAccount) (*Token, error) {
+	if token.GenesisAccount == account.GetID() {
+		return nil, errors.New("already the genesis account")
+	}
+
+	ts, err := txtime.GetTime(tb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if token.FeePolicy != nil && token.FeePolicy.IsTarget(token.GenesisAccount) {
+		token.FeePolicy.ReplaceTarget(token.GenesisAccount, account.GetID())
+	}
+	token.GenesisAccount = account.GetID()
+	token.UpdatedTime = ts
+	if err = tb.PutToken(token); err != nil {
+		return nil, errors.Wrap(err, "failed to update the token")
+	}
+
+	return token, nil
+}
+
+// GetDecimal returns the decimal of the token.
+func (tb *TokenStub) GetDecimal(code string) (int, error) {
+	token, err := tb.GetToken(code)
+	if err != nil {
+		return 0, err
+	}
+	return token.Decimal, nil
+}
+
+// Audit walks a page of records of the current audit step, and accumulates the amounts.
+// When all steps are walked, it compares the total with the supply of the token.
+func (tb *TokenStub) Audit(token *Token, audit *TokenAudit, fetchSize int) error {
+	if fetchSize < 1 {
+		fetchSize = TokenAuditFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+
+	// pruned time of the fees (fee ID has the same format with pay ID)
+	var feePrunedTime *txtime.Time
+	if audit.Step == TokenAuditStepFee {
+		feeID := token.LastPrunedFeeID // legacy
+		lastPrunedFeeID, err := NewLastPrunedFeeIDStub(tb.stub).GetLastPrunedFeeID(token.DOCTYPEID)
+		if err != nil {
+			if _, ok := err.(NotInitLastPrunedFeeIDError); !ok {
+				return err
+			}
+		} else {
+			feeID = lastPrunedFeeID.FeeID
+		}
+		feePrunedTime = txtime.Unix(0, 0)
+		if len(feeID) > 0 {
+			if feePrunedTime, err = GetPayIDTime(feeID); err != nil {
+				return err
+			}
+		}
+	}
+	payPrunedTimes := map[string]*txtime.Time{} // merchant address -> pruned time of the pays
+
+	query := CreateQueryAuditRecords(token.DOCTYPEID, audit.Step)
+	iter, meta, err := tb.stub.GetQueryResultWithPagination(query, int32(fetchSize), audit.QueryBookmark)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		audit.Records++
+
+		switch audit.Step {
+		case TokenAuditStepBalance:
+			bal := &Balance{}
+			if err = json.Unmarshal(kv.Value, bal); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the balance")
+			}
+			audit.Balance.Add(&bal.Amount)
+		case TokenAuditStepPendingBalance:
+			pb := &PendingBalance{}
+			if err = json.Unmarshal(kv.Value, pb); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the pending balance")
+			}
+			audit.PendingBalance.Add(&pb.Amount)
+			if pb.Fee != nil {
+				audit.PendingFee.Add(pb.Fee)
+			}
+		case TokenAuditStepBalanceDelta:
+			delta := &BalanceDelta{}
+			if err = json.Unmarshal(kv.Value, delta); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the balance delta")
+			}
+			audit.BalanceDelta.Add(&delta.Amount)
+		case TokenAuditStepPay:
+			pay := &Pay{}
+			if err = json.Unmarshal(kv.Value, pay); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the pay")
+			}
+			prunedTime, ok := payPrunedTimes[pay.DOCTYPEID]
+			if !ok {
+				bal, err := NewBalanceStub(tb.stub).GetBalance(pay.DOCTYPEID)
+				if err != nil {
+					return err
+				}
+				prunedTime = txtime.Unix(0, 0)
+				if len(bal.LastPrunedPayID) > 0 {
+					if prunedTime, err = GetPayIDTime(bal.LastPrunedPayID); err != nil {
+						return err
+					}
+				}
+				payPrunedTimes[pay.DOCTYPEID] = prunedTime
+			}
+			if pay.CreatedTime.Cmp(prunedTime) > 0 { // unpruned
+				audit.Pay.Add(&pay.Amount)
+			}
+		case TokenAuditStepFee:
+			fee := &Fee{}
+			if err = json.Unmarshal(kv.Value, fee); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the fee")
+			}
+			if fee.CreatedTime.Cmp(feePrunedTime) > 0 { // unpruned
+				audit.Fee.Add(&fee.Amount)
+			}
+		case TokenAuditStepHTLC:
+			htlc := &HTLC{}
+			if err = json.Unmarshal(kv.Value, htlc); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the htlc")
+			}
+			audit.HTLC.Add(&htlc.Amount)
+			if htlc.Fee != nil {
+				audit.HTLC.Add(htlc.Fee)
+			}
+		case TokenAuditStepVesting:
+			v := &Vesting{}
+			if err = json.Unmarshal(kv.Value, v); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the vesting")
+			}
+			audit.Vesting.Add(&v.Amount).Add(v.Claimed.Copy().Neg()).Add(v.Revoked.Copy().Neg())
+		}
+	}
+
+	// next page or next step
+	if meta.FetchedRecordsCount < int32(fetchSize) {
+		audit.Step++
+		audit.QueryBookmark = ""
+	} else {
+		audit.QueryBookmark = meta.Bookmark
+	}
+
+	if audit.Step == TokenAuditStepDone {
+		audit.Supply = token.Supply.Copy()
+		audit.Total = audit.Sum()
+		audit.Discrepancy = audit.Total.Copy().Add(token.Supply.Copy().Neg())
+		audit.Done = true
+	}
+
+	return nil
+}
+
+// Stats walks a page of records of the current stats step, and counts the accounts and the funded balances.
+func (tb *TokenStub) Stats(stats *TokenStats, fetchSize int) error {
+	if fetchSize < 1 {
+		fetchSize = TokenStatsFetchSize
+	}
+	if fetchSize > 200 {
+		fetchSize = 200
+	}
+
+	query := CreateQueryAccountsByToken(stats.Token)
+	if stats.Step == TokenStatsStepBalance {
+		query = CreateQueryHolders(stats.Token)
+	}
+	iter, meta, err := tb.stub.GetQueryResultWithPagination(query, int32(fetchSize), stats.QueryBookmark)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		switch stats.Step {
+		case TokenStatsStepAccount:
+			account := &Account{}
+			if err = json.Unmarshal(kv.Value, account); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the account")
+			}
+			stats.Accounts[account.Type]++
+			if account.IsSuspended() {
+				stats.Suspended++
+			}
+		case TokenStatsStepBalance:
+			bal := &Balance{}
+			if err = json.Unmarshal(kv.Value, bal); err != nil {
+				return errors.Wrap(err, "failed to unmarshal the balance")
+			}
+			stats.Funded++
+			stats.Histogram[bal.Digits]++
+		}
+	}
+
+	// next page or next step
+	if meta.FetchedRecordsCount < int32(fetchSize) {
+		stats.Step++
+		stats.QueryBookmark = ""
+	} else {
+		stats.QueryBookmark = meta.Bookmark
+	}
+	stats.Done = stats.Step == TokenStatsStepDone
+
+	return nil
+}
@@ -0,0 +1,435 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestTokenPause(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	// time-locked transfer to be withdrawn while paused
+	pendingTime := strconv.FormatInt(h.clock.Add(2*time.Minute).Unix(), 10)
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "10", "", pendingTime)
+	pbID := fmt.Sprintf("tx%08d", h.seq) // pending balance ID is the txid
+
+	if res := h.invokeAs(alice, "token/pause", "PCI", "incident"); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can pause the token")
+	}
+	h.mustInvokeAs(issuer, "token/pause", "PCI", "incident")
+	token := getTestToken(t, h, "PCI")
+	if !token.IsPaused() || token.PauseReason != "incident" {
+		t.Fatal("the token must be paused")
+	}
+	if res := h.invokeAs(issuer, "token/pause", "PCI", "again"); res.Status == shim.OK {
+		t.Fatal("the token must not be paused twice")
+	}
+
+	// rejected operations
+	rejected := [][]string{
+		{"transfer", "", bobAddr, "10"},
+		{"pay", "", bobAddr, "10"},
+		{"token/mint", "PCI", "10"},
+		{"token/burn", "PCI", "10"},
+	}
+	for _, args := range rejected {
+		kid := alice
+		if strings.HasPrefix(args[0], "token/") {
+			kid = issuer
+		}
+		res := h.invokeAs(kid, args[0], args[1:]...)
+		if res.Status == shim.OK || !strings.Contains(res.Message, "is paused") {
+			t.Fatalf("%s must be rejected while the token is paused: %s", args[0], res.Message)
+		}
+	}
+	h.advance(3 * time.Minute)
+	if res := h.invokeAs(bob, "balance/pending/withdraw", pbID); res.Status == shim.OK {
+		t.Fatal("withdrawal must be rejected while the token is paused")
+	}
+
+	// queries keep working
+	h.mustInvokeAs(alice, "token/get", "PCI")
+	h.mustInvokeAs(alice, "account/get", "PCI")
+
+	if res := h.invokeAs(alice, "token/unpause", "PCI"); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can unpause the token")
+	}
+	h.mustInvokeAs(issuer, "token/unpause", "PCI")
+	if getTestToken(t, h, "PCI").IsPaused() {
+		t.Fatal("the token must be unpaused")
+	}
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "10")
+	h.mustInvokeAs(bob, "balance/pending/withdraw", pbID)
+	assertBalance(t, h, bobAddr, "20")
+}
+
+// getTestContractID returns the contract ID of the response.
+func getTestContractID(t *testing.T, data []byte) string {
+	t.Helper()
+	con := map[string]interface{}{}
+	if err := json.Unmarshal(data, &con); err != nil {
+		t.Fatal(err)
+	}
+	cid, ok := con["@contract"].(string)
+	if !ok {
+		t.Fatalf("not a contract: %s", data)
+	}
+	return cid
+}
+
+func TestTokenGenesisRotate(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{issuer, alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	issuerAddr := testAccountAddr("PCI", issuer)
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	carolAddr := testAccountAddr("PCI", carol)
+	holderKey := func(kid, addr string) string {
+		return NewAccountStub(nil, "").CreateHolderKey(kid, addr)
+	}
+
+	if res := h.invokeAs(bob, "token/genesis/rotate", "PCI", bobAddr); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can rotate")
+	}
+	if res := h.invokeAs(issuer, "token/genesis/rotate", "PCI", aliceAddr); res.Status == shim.OK {
+		t.Fatal("the genesis account needs 2+ holders")
+	}
+
+	// the incoming holder approves too
+	cid := getTestContractID(t, h.mustInvokeAs(issuer, "token/genesis/rotate", "PCI", issuerAddr, aliceAddr))
+	for _, kid := range []string{issuer, alice} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	if jac := getTestJointAccount(t, h, genesis); jac.Holders.Size() != 2 || !jac.HasHolder(alice) {
+		t.Fatalf("unexpected genesis holders: %v", jac.Holders.Strings())
+	}
+	if h.getState(holderKey(alice, genesis)) == nil {
+		t.Fatal("the holder relationship is not created")
+	}
+	if res := h.invokeAs(alice, "token/genesis/rotate", "PCI", aliceAddr, issuerAddr); res.Status == shim.OK {
+		t.Fatal("same holders")
+	}
+	if res := h.invokeAs(alice, "token/genesis/rotate", "PCI", bobAddr); res.Status == shim.OK {
+		t.Fatal("the genesis account needs 2+ holders")
+	}
+
+	// replaces the whole holders at once
+	cid = getTestContractID(t, h.mustInvokeAs(alice, "token/genesis/rotate", "PCI", bobAddr, carolAddr))
+	for _, kid := range []string{issuer, alice, bob, carol} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	if jac := getTestJointAccount(t, h, genesis); jac.Holders.Size() != 2 || !jac.HasHolder(bob) || !jac.HasHolder(carol) {
+		t.Fatalf("unexpected genesis holders: %v", jac.Holders.Strings())
+	}
+	for _, kid := range []string{issuer, alice} {
+		if h.getState(holderKey(kid, genesis)) != nil {
+			t.Fatal("the holder relationship is not deleted")
+		}
+	}
+	if h.getState(holderKey(bob, genesis)) == nil {
+		t.Fatal("the holder relationship is not created")
+	}
+	if res := h.invokeAs(issuer, "token/pause", "PCI", "incident"); res.Status == shim.OK {
+		t.Fatal("the old holder must not have authority")
+	}
+
+	// moves the role to the joint account of alice and carol
+	cid = getTestContractID(t, h.mustInvokeAs(alice, "account/create", "PCI", carolAddr))
+	for _, kid := range []string{alice, carol} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	list := struct {
+		Records []*Holder `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(carol, "account/list", "PCI"), &list); err != nil {
+		t.Fatal(err)
+	}
+	jointAddr := ""
+	for _, holder := range list.Records {
+		if holder.Type == AccountTypeJoint {
+			jointAddr = holder.Address
+		}
+	}
+	cid = getTestContractID(t, h.mustInvokeAs(bob, "token/genesis/rotate", "PCI", jointAddr))
+	for _, kid := range []string{bob, alice, carol} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	token := getTestToken(t, h, "PCI")
+	if token.GenesisAccount != jointAddr {
+		t.Fatal("the genesis account is not moved")
+	}
+	if targets := token.FeePolicy.GetTargets(); len(targets) != 1 || targets[0].Address != jointAddr {
+		t.Fatalf("the fee target is not moved: %+v", targets)
+	}
+	assertBalance(t, h, genesis, "10000") // the balance is not moved
+	assertBalance(t, h, jointAddr, "0")
+	if res := h.invokeAs(bob, "token/pause", "PCI", "incident"); res.Status == shim.OK {
+		t.Fatal("the old genesis holder must not have authority")
+	}
+	if h.getState(holderKey(bob, genesis)) == nil {
+		t.Fatal("the old genesis account keeps its holders")
+	}
+}
+
+// walkTestTokenStats calls token/stats with the bookmark until done, and returns the last result.
+func walkTestTokenStats(t *testing.T, h *testHarness, kid, code, fetchSize string) (*TokenStatsResult, int) {
+	t.Helper()
+	bookmark := ""
+	for calls := 1; calls <= 100; calls++ {
+		res := &TokenStatsResult{}
+		if err := json.Unmarshal(h.mustInvokeAs(kid, "token/stats", code, bookmark, fetchSize), res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Done {
+			if len(res.Bookmark) > 0 {
+				t.Fatal("the bookmark must be empty if done")
+			}
+			return res, calls
+		}
+		if len(res.Bookmark) == 0 {
+			t.Fatal("the bookmark must be set if not done")
+		}
+		bookmark = res.Bookmark
+	}
+	t.Fatal("the stats are not done")
+	return nil, 0
+}
+
+// walkTestTokenAudit calls token/audit with the bookmark until done, and returns the last result.
+func walkTestTokenAudit(t *testing.T, h *testHarness, kid, code, fetchSize string) (*TokenAuditResult, int) {
+	t.Helper()
+	bookmark := ""
+	for calls := 1; calls <= 100; calls++ {
+		res := &TokenAuditResult{}
+		if err := json.Unmarshal(h.mustInvokeAs(kid, "token/audit", code, bookmark, fetchSize), res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Done {
+			if len(res.Bookmark) > 0 {
+				t.Fatal("the bookmark must be empty if done")
+			}
+			return res, calls
+		}
+		if len(res.Bookmark) == 0 {
+			t.Fatal("the bookmark must be set if not done")
+		}
+		bookmark = res.Bookmark
+	}
+	t.Fatal("the audit is not done")
+	return nil, 0
+}
+
+func TestTokenAudit(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	carolAddr := testAccountAddr("PCI", carol)
+
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+	h.mustInvokeAs(alice, "transfer", "", bobAddr, "100")       // unpruned fee
+	h.mustInvokeAs(alice, "pay", "", bobAddr, "100", "order-1") // unpruned pay
+	pendingTime := strconv.FormatInt(h.clock.Add(time.Minute).Unix(), 10)
+	h.mustInvokeAs(alice, "transfer", "", carolAddr, "200", "", pendingTime) // pending balance
+	h.mustInvokeAs(issuer, "token/mint", "PCI", "500")
+
+	// a page per call
+	res, calls := walkTestTokenAudit(t, h, bob, "PCI", "2")
+	if res.Supply == nil || res.Supply.String() != "10500" {
+		t.Fatalf("unexpected supply: %v", res.Supply)
+	}
+	if res.Total == nil || res.Total.String() != "10500" || res.Discrepancy == nil || res.Discrepancy.String() != "0" {
+		t.Fatalf("unexpected audit: %+v", res.TokenAudit)
+	}
+	if res.Records < 4 || calls < res.Records/2 {
+		t.Fatalf("unexpected records %d in %d calls", res.Records, calls)
+	}
+	if res.Pay.String() != "100" || res.Fee.Sign() <= 0 || res.PendingBalance.String() != "200" {
+		t.Fatalf("unexpected audit: %+v", res.TokenAudit)
+	}
+
+	// same totals with the default fetch size
+	all, calls := walkTestTokenAudit(t, h, bob, "PCI", "")
+	if all.Total.Cmp(res.Total) != 0 || all.Records != res.Records || calls != int(TokenAuditStepDone) {
+		t.Fatalf("unexpected audit in %d calls: %+v", calls, all.TokenAudit)
+	}
+
+	// pruned pays and fees are applied to the balances
+	h.mustInvokeAs(bob, "pay/prune", "PCI", "false")
+	h.mustInvokeAs(issuer, "fee/prune", "PCI", "false")
+	res, _ = walkTestTokenAudit(t, h, bob, "PCI", "2")
+	if res.Pay.Sign() != 0 || res.Fee.Sign() != 0 || res.Discrepancy.String() != "0" {
+		t.Fatalf("unexpected audit: %+v", res.TokenAudit)
+	}
+
+	// the token which has the code as a prefix is not counted
+	h.setTokenMeta("PCI01A", testTokenMeta)
+	h.mustInvokeAs(issuer, "token/create", "PCI01A")
+	h.mustInvokeAs(alice, "account/create", "PCI01A")
+	pendingTime = strconv.FormatInt(h.clock.Add(time.Minute).Unix(), 10)
+	h.mustInvokeAs(issuer, "transfer", getTestToken(t, h, "PCI01A").GenesisAccount, testAccountAddr("PCI01A", alice), "300", "", pendingTime)
+	res, _ = walkTestTokenAudit(t, h, bob, "PCI", "2")
+	if res.PendingBalance.String() != "200" || res.Discrepancy.String() != "0" {
+		t.Fatalf("unexpected audit: %+v", res.TokenAudit)
+	}
+
+	// invalid bookmarks
+	if res := h.invokeAs(bob, "token/audit", "PCI", "invalid"); res.Status == shim.OK {
+		t.Fatal("invalid bookmark")
+	}
+	h.setTokenMeta("ABC", testTokenMeta)
+	h.mustInvokeAs(issuer, "token/create", "ABC")
+	data, _ := json.Marshal(&TokenAudit{Token: "ABC"})
+	if res := h.invokeAs(bob, "token/audit", "PCI", base64.StdEncoding.EncodeToString(data)); res.Status == shim.OK {
+		t.Fatal("the bookmark of the other token")
+	}
+}
+
+func TestTokenHoldersAndStats(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	cid := getTestContractID(t, h.mustInvokeAs(alice, "account/create", "PCI", bobAddr))
+	for _, kid := range []string{alice, bob} {
+		if res := h.approveContract(cid, kid); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	h.mustInvokeAs(carol, "account/suspend", "PCI")
+
+	// "90" is greater than "1000" as a string
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+	h.mustInvokeAs(issuer, "transfer", genesis, bobAddr, "90")
+
+	// largest first, unfunded balances are not listed
+	expected := []string{genesis, aliceAddr, bobAddr}
+	amounts := []string{"8910", "1000", "90"}
+	bookmark := ""
+	for page := 0; page < 2; page++ {
+		res := struct {
+			Meta    *peer.QueryResponseMetadata `json:"meta"`
+			Records []*Balance                  `json:"records"`
+		}{}
+		if err := json.Unmarshal(h.mustInvokeAs(carol, "token/holders", "PCI", bookmark, "2"), &res); err != nil {
+			t.Fatal(err)
+		}
+		for i, bal := range res.Records {
+			n := page*2 + i
+			if n >= len(expected) || bal.DOCTYPEID != expected[n] || bal.Amount.String() != amounts[n] {
+				t.Fatalf("unexpected holder %d: %+v", n, bal)
+			}
+		}
+		if page == 0 && len(res.Records) != 2 || page == 1 && len(res.Records) != 1 {
+			t.Fatalf("unexpected records of the page %d: %d", page, len(res.Records))
+		}
+		bookmark = res.Meta.Bookmark
+	}
+
+	// 5 accounts and 3 funded balances, 2 records per page
+	stats, calls := walkTestTokenStats(t, h, carol, "PCI", "2")
+	if stats.Accounts[AccountTypePersonal] != 3 || stats.Accounts[AccountTypeJoint] != 2 {
+		t.Fatalf("unexpected account counts: %v", stats.Accounts)
+	}
+	if stats.Suspended != 1 || stats.Funded != 3 || calls != 5 {
+		t.Fatalf("unexpected stats: %+v (%d calls)", stats, calls)
+	}
+	if len(stats.Histogram) != 2 || stats.Histogram[4] != 2 || stats.Histogram[2] != 1 {
+		t.Fatalf("unexpected histogram: %v", stats.Histogram)
+	}
+
+	// the balance which is not updated since the upgrade is not listed until it is reindexed
+	key := NewBalanceStub(nil).CreateKey(aliceAddr)
+	legacy := map[string]interface{}{}
+	if err := json.Unmarshal(h.getState(key), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	delete(legacy, "token")
+	delete(legacy, "digits")
+	data, _ := json.Marshal(legacy)
+	h.mock.State[key] = data
+	if stats, _ = walkTestTokenStats(t, h, carol, "PCI", ""); stats.Funded != 2 {
+		t.Fatalf("unexpected funded count before the reindex: %d", stats.Funded)
+	}
+	if res := h.invokeAs(carol, "balance/reindex", "PCI"); res.Status == shim.OK {
+		t.Fatal("only genesis account holders can reindex")
+	}
+	reindex := &BalanceReindexResult{}
+	if err := json.Unmarshal(h.mustInvokeAs(issuer, "balance/reindex", "PCI"), reindex); err != nil {
+		t.Fatal(err)
+	}
+	if reindex.Scanned != 5 || reindex.Updated != 1 || len(reindex.Bookmark) > 0 {
+		t.Fatalf("unexpected reindex result: %+v", reindex)
+	}
+	if stats, _ = walkTestTokenStats(t, h, carol, "PCI", ""); stats.Funded != 3 {
+		t.Fatalf("unexpected funded count after the reindex: %d", stats.Funded)
+	}
+
+	if res := h.invokeAs(carol, "token/stats", "ABC"); res.Status == shim.OK {
+		t.Fatal("the token is not issued")
+	}
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -10,7 +11,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
-	"github.com/key-inside/kiesnet-ccpkg/contract"
 	"github.com/key-inside/kiesnet-ccpkg/kid"
 	"github.com/key-inside/kiesnet-ccpkg/stringset"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
@@ -18,7 +18,71 @@ import (
 )
 
 // params[0] : token code
-// params[1] : amount (big int string)
+// params[1] : optional. bookmark (the bookmark of the previous token/audit)
+// params[2] : optional. fetch size (if < 1 => default size, max 200)
+func tokenAudit(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	if _, err = kid.GetID(stub, false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the totals of the previous pages
+	audit := &TokenAudit{Token: code}
+	fetchSize := 0
+	if len(params) > 1 {
+		if len(params[1]) > 0 {
+			data, err := base64.StdEncoding.DecodeString(params[1])
+			if err != nil {
+				return shim.Error("invalid bookmark")
+			}
+			if err = json.Unmarshal(data, audit); err != nil || audit.Token != code || audit.Done {
+				return shim.Error("invalid bookmark")
+			}
+		}
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	tb := NewTokenStub(stub)
+	token, err := tb.GetToken(code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+	if err = tb.Audit(token, audit, fetchSize); err != nil {
+		return responseError(err, "failed to audit the token")
+	}
+
+	res := &TokenAuditResult{TokenAudit: audit}
+	if !audit.Done {
+		data, err := json.Marshal(audit)
+		if err != nil {
+			return responseError(err, "failed to marshal the bookmark")
+		}
+		res.Bookmark = base64.StdEncoding.EncodeToString(data)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal the audit")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : token code
+// params[1] : amount (big int string or decimal string)
 func tokenBurn(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) != 2 {
 		return shim.Error("incorrect number of parameters. expecting 2")
@@ -35,6 +99,9 @@ func tokenBurn(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	if err != nil {
 		return responseError(err, "failed to get the token")
 	}
+	if token.IsPaused() {
+		return responseError(PausedTokenError{code: code}, "failed to burn")
+	}
 
 	// authentication
 	kid, err := kid.GetID(stub, true)
@@ -63,7 +130,7 @@ func tokenBurn(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return shim.Error("genesis account balance is 0")
 	}
 
-	_amount, err := NewAmount(params[1]) // validate amount
+	_amount, err := tb.ParseAmount(code, params[1]) // validate amount
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -82,7 +149,7 @@ func tokenBurn(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	}
 
 	jac := account.(*JointAccount)
-	if jac.Holders.Size() > 1 {
+	if jac.Quorum() > 1 {
 		// contract
 		doc := []interface{}{"token/burn", code, amount.String()}
 		docb, err := json.Marshal(doc)
@@ -91,7 +158,7 @@ func tokenBurn(stub shim.ChaincodeStubInterface, params []string) peer.Response
 			return shim.Error("failed to create a contract")
 		}
 		// ISSUE : should we get and set expiry?
-		con, err := contract.CreateContract(stub, docb, 0, jac.Holders)
+		con, err := createContract(stub, docb, 0, jac.Holders, jac.Quorum())
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -167,7 +234,7 @@ func tokenCreate(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	if holders.Size() > 1 {
 		// contract
 		doc := []interface{}{"token/create", code, holders.Strings()}
-		return invokeContract(stub, doc, holders)
+		return invokeContract(stub, doc, holders, 0)
 	}
 
 	token, err := tb.CreateToken(code, decimal, *maxSupply, *supply, feePolicy, holders)
@@ -182,6 +249,118 @@ func tokenCreate(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 	return shim.Success(data)
 }
 
+// params[0] : token code
+// params[1:] : a joint account address to be the genesis account | new holders (personal account addresses)
+func tokenGenesisRotate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 2 {
+		return shim.Error("incorrect number of parameters. expecting 2+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// token
+	token, err := NewTokenStub(stub).GetToken(code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	// genesis account
+	ab := NewAccountStub(stub, code)
+	gAddr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := ab.GetAccount(gAddr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !genesis.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+	jac := genesis.(*JointAccount)
+
+	// new genesis account or new holders
+	addrs := stringset.New(params[1:]...) // remove duplication
+	target := ""
+	holders := stringset.New()
+	for addr := range addrs.Map() {
+		_addr, err := ParseAddress(addr)
+		if err != nil {
+			return responseError(err, "failed to parse the account address")
+		}
+		if _addr.Code != code {
+			return shim.Error("different token accounts")
+		}
+		if _addr.Type == AccountTypeJoint {
+			if addrs.Size() > 1 {
+				return shim.Error("the joint account must be the only parameter")
+			}
+			account, err := ab.GetAccount(_addr)
+			if err != nil {
+				return responseError(err, "failed to get the account")
+			}
+			if account.IsSuspended() {
+				return shim.Error("the account is suspended")
+			}
+			if _addr.Equal(gAddr) {
+				return shim.Error("already the genesis account")
+			}
+			target = account.GetID()
+			holders.AppendSet(account.(*JointAccount).Holders)
+		} else {
+			if _, err = ab.GetAccount(_addr); err != nil {
+				return responseError(err, "invalid holder")
+			}
+			holders.Add(_addr.ID())
+		}
+	}
+	if holders.Size() < 2 {
+		return shim.Error("the genesis account needs 2+ holders")
+	}
+	if holders.Size() > 128 {
+		return shim.Error("too many holders (max 128)")
+	}
+
+	// incoming holders must approve too
+	signers := stringset.New()
+	signers.AppendSet(jac.Holders)
+	quorum := jac.Quorum()
+	incomings := stringset.New()
+	for holder := range holders.Map() {
+		if !jac.HasHolder(holder) {
+			signers.Add(holder)
+			incomings.Add(holder)
+			quorum++
+		}
+	}
+	if len(target) == 0 && quorum == jac.Quorum() && holders.Size() == jac.Holders.Size() {
+		return shim.Error("same holders")
+	}
+
+	if quorum > 1 {
+		// contract
+		doc := []interface{}{"token/genesis/rotate", code, jac.GetID(), target, holders.Strings()}
+		return invokeQuorumContract(stub, doc, signers, quorum, incomings)
+	}
+
+	token, err = rotateGenesis(stub, token, jac, target, holders)
+	if err != nil {
+		return responseError(err, "failed to rotate the genesis account")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return responseError(err, "failed to marshal the token")
+	}
+	return shim.Success(data)
+}
+
 // params[0] : token code
 func tokenGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) != 1 {
@@ -207,7 +386,53 @@ func tokenGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 }
 
 // params[0] : token code
-// params[1] : amount (big int string)
+// params[1] : optional. bookmark
+// params[2] : optional. fetch size (if < 1 => default size, max 200)
+func tokenHolders(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	if _, err = kid.GetID(stub, false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := ""
+	fetchSize := 0
+	if len(params) > 1 {
+		bookmark = params[1]
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+
+	if _, err = NewTokenStub(stub).GetToken(code); err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	res, err := NewBalanceStub(stub).GetQueryHolders(code, bookmark, fetchSize)
+	if err != nil {
+		return responseError(err, "failed to get holders")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal holders")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : token code
+// params[1] : amount (big int string or decimal string)
 func tokenMint(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) != 2 {
 		return shim.Error("incorrect number of parameters. expecting 2")
@@ -224,6 +449,9 @@ func tokenMint(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	if err != nil {
 		return responseError(err, "failed to get the token")
 	}
+	if token.IsPaused() {
+		return responseError(PausedTokenError{code: code}, "failed to mint")
+	}
 	if token.Supply.Cmp(&token.MaxSupply) >= 0 {
 		return shim.Error("max supplied")
 	}
@@ -252,7 +480,7 @@ func tokenMint(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return responseError(err, "failed to get the genesis account balance")
 	}
 
-	_amount, err := NewAmount(params[1]) // validate amount
+	_amount, err := tb.ParseAmount(code, params[1]) // validate amount
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -267,17 +495,17 @@ func tokenMint(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	}
 
 	jac := account.(*JointAccount)
-	if jac.Holders.Size() > 1 {
+	if jac.Quorum() > 1 {
 		// contract
 		doc := []interface{}{"token/mint", code, amount.String()}
-		// return invokeContract(stub, doc, jac.Holders)
+		// return invokeContract(stub, doc, jac.Holders, jac.Quorum())
 		docb, err := json.Marshal(doc)
 		if err != nil {
 			logger.Debug(err.Error())
 			return shim.Error("failed to create a contract")
 		}
 		// ISSUE : should we get and set expiry?
-		con, err := contract.CreateContract(stub, docb, 0, jac.Holders)
+		con, err := createContract(stub, docb, 0, jac.Holders, jac.Quorum())
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -303,6 +531,98 @@ func tokenMint(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	return shim.Success(data)
 }
 
+// params[0] : token code
+// params[1] : reason (see MemoMaxLength)
+func tokenPause(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return shim.Error("incorrect number of parameters. expecting 2")
+	}
+
+	reason := params[1]
+	if len(reason) > MemoMaxLength { // length limit
+		reason = reason[:MemoMaxLength]
+	}
+	return setTokenPaused(stub, params[0], true, reason)
+}
+
+// params[0] : token code
+// params[1] : optional. bookmark (the stats of the previous pages)
+// params[2] : optional. fetch size (if < 1 => default size, max 200)
+func tokenStats(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return shim.Error("incorrect number of parameters. expecting 1+")
+	}
+
+	code, err := ValidateTokenCode(params[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// authentication
+	if _, err = kid.GetID(stub, false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the stats of the previous pages
+	stats := &TokenStats{Token: code}
+	fetchSize := 0
+	if len(params) > 1 {
+		if len(params[1]) > 0 {
+			data, err := base64.StdEncoding.DecodeString(params[1])
+			if err != nil {
+				return shim.Error("invalid bookmark")
+			}
+			if err = json.Unmarshal(data, stats); err != nil || stats.Token != code || stats.Done {
+				return shim.Error("invalid bookmark")
+			}
+		}
+		if len(params) > 2 {
+			fetchSize, err = strconv.Atoi(params[2])
+			if err != nil {
+				return shim.Error("invalid fetch size")
+			}
+		}
+	}
+	if stats.Accounts == nil {
+		stats.Accounts = map[AccountType]int{}
+	}
+	if stats.Histogram == nil {
+		stats.Histogram = map[int]int{}
+	}
+
+	tb := NewTokenStub(stub)
+	if _, err = tb.GetToken(code); err != nil {
+		return responseError(err, "failed to get the token")
+	}
+	if err = tb.Stats(stats, fetchSize); err != nil {
+		return responseError(err, "failed to get the token stats")
+	}
+
+	res := &TokenStatsResult{TokenStats: stats}
+	if !stats.Done {
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return responseError(err, "failed to marshal the bookmark")
+		}
+		res.Bookmark = base64.StdEncoding.EncodeToString(data)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return responseError(err, "failed to marshal the token stats")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : token code
+func tokenUnpause(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	return setTokenPaused(stub, params[0], false, "")
+}
+
 // Get updated information from the token meta chaincode(e.g. knt-cc-pci) and save it to the ledger.
 // params[0] : token code
 func tokenUpdate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
@@ -353,14 +673,17 @@ func tokenUpdate(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 		}
 	} else {
 		if len(policy.TargetAddress) > 0 {
-			if _, err := NewAccountStub(stub, code).GetAccountState(policy.TargetAddress); err != nil {
-				return responseError(err, "failed to set a target address")
+			ab := NewAccountStub(stub, code)
+			for _, target := range policy.GetTargets() {
+				if _, err := ab.GetAccountState(target.Address); err != nil {
+					return responseError(err, "failed to set a target address")
+				}
 			}
 		} else { // No new target address input. Do not edit current value.
 			if token.FeePolicy == nil {
 				policy.TargetAddress = token.GenesisAccount
 			} else {
-				policy.TargetAddress = token.FeePolicy.TargetAddress
+				policy.SetTargets(token.FeePolicy.GetTargets())
 			}
 		}
 		token.FeePolicy = policy
@@ -387,6 +710,111 @@ func tokenUpdate(stub shim.ChaincodeStubInterface, params []string) peer.Respons
 
 // helpers
 
+// setTokenPaused pauses(unpauses) the token or creates a contract. (genesis account holders only)
+func setTokenPaused(stub shim.ChaincodeStubInterface, code string, paused bool, reason string) peer.Response {
+	code, err := ValidateTokenCode(code)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	token, err := tb.GetToken(code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+	if token.IsPaused() == paused {
+		if paused {
+			return shim.Error("already paused")
+		}
+		return shim.Error("not paused")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// genesis account
+	addr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	account, err := NewAccountStub(stub, code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !account.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+
+	jac := account.(*JointAccount)
+	if jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"token/unpause", code}
+		if paused {
+			doc = []interface{}{"token/pause", code, reason}
+		}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	if paused {
+		token, err = tb.Pause(token, reason)
+	} else {
+		token, err = tb.Unpause(token)
+	}
+	if err != nil {
+		return responseError(err, "failed to update the token")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return responseError(err, "failed to marshal the token")
+	}
+	return shim.Success(data)
+}
+
+// rotateGenesis moves the genesis role to the target joint account, or replaces the holders of the genesis account if target is empty.
+func rotateGenesis(stub shim.ChaincodeStubInterface, token *Token, genesis *JointAccount, target string, holders *stringset.Set) (*Token, error) {
+	ab := NewAccountStub(stub, token.DOCTYPEID)
+	if len(target) > 0 {
+		addr, _ := ParseAddress(target) // err is nil
+		account, err := ab.GetAccount(addr)
+		if err != nil {
+			return nil, err
+		}
+		if account.IsSuspended() {
+			return nil, errors.New("the account is suspended")
+		}
+		return NewTokenStub(stub).SetGenesisAccount(token, account.(*JointAccount))
+	}
+	if _, err := ab.ReplaceHolders(genesis, holders); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// formatAmountsOfState adds formatted amounts to the JSON state. (see AppendFormattedAmounts)
+func formatAmountsOfState(stub shim.ChaincodeStubInterface, code string, data []byte) ([]byte, error) {
+	decimal, err := NewTokenStub(stub).GetDecimal(code)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the state")
+	}
+	AppendFormattedAmounts(doc, decimal)
+	return json.Marshal(doc)
+}
+
+// formatAmountsOfQueryResult adds formatted amounts to the records. (see AppendFormattedAmounts)
+func formatAmountsOfQueryResult(stub shim.ChaincodeStubInterface, code string, res *QueryResult) error {
+	decimal, err := NewTokenStub(stub).GetDecimal(code)
+	if err != nil {
+		return err
+	}
+	return res.FormatAmounts(decimal)
+}
+
 func invokeKNT(stub shim.ChaincodeStubInterface, code string, params []string) ([]byte, error) {
 	ccid := strings.ToLower(code)
 	if os.Getenv("DEV_CHANNEL_NAME") != "" {
@@ -437,7 +865,11 @@ func getValidatedTokenMeta(stub shim.ChaincodeStubInterface, code string) (int,
 		if err != nil {
 			return 0, nil, nil, nil, err
 		}
-		policy.TargetAddress = metaMap["target_address"]
+		targets, err := ParseFeeTargets(metaMap["target_address"])
+		if err != nil {
+			return 0, nil, nil, nil, err
+		}
+		policy.SetTargets(targets)
 	}
 
 	return decimal, maxSupply, supply, policy, nil
@@ -513,6 +945,38 @@ func executeTokenCreate(stub shim.ChaincodeStubInterface, cid string, doc []inte
 	return shim.Success(nil)
 }
 
+// doc: ["token/genesis/rotate", code, genesis-address, target-address, [holders...]]
+func executeTokenGenesisRotate(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 5 {
+		return shim.Error("invalid contract document")
+	}
+
+	token, err := NewTokenStub(stub).GetToken(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+	if token.GenesisAccount != doc[2].(string) {
+		return shim.Error("the genesis account has been changed")
+	}
+
+	addr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+
+	holders := stringset.New()
+	for _, kid := range doc[4].([]interface{}) {
+		holders.Add(kid.(string))
+	}
+
+	if _, err = rotateGenesis(stub, token, genesis.(*JointAccount), doc[3].(string), holders); err != nil {
+		return responseError(err, "failed to rotate the genesis account")
+	}
+
+	return shim.Success(nil)
+}
+
 // doc: ["token/mint", code, amount]
 func executeTokenMint(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
 	if len(doc) != 3 {
@@ -545,3 +1009,41 @@ func executeTokenMint(stub shim.ChaincodeStubInterface, cid string, doc []interf
 
 	return shim.Success(nil)
 }
+
+// doc: ["token/pause", code, reason]
+func executeTokenPause(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 3 {
+		return shim.Error("invalid contract document")
+	}
+
+	tb := NewTokenStub(stub)
+	token, err := tb.GetToken(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	if _, err = tb.Pause(token, doc[2].(string)); err != nil {
+		return responseError(err, "failed to pause the token")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["token/unpause", code]
+func executeTokenUnpause(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) != 2 {
+		return shim.Error("invalid contract document")
+	}
+
+	tb := NewTokenStub(stub)
+	token, err := tb.GetToken(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	if _, err = tb.Unpause(token); err != nil {
+		return responseError(err, "failed to unpause the token")
+	}
+
+	return shim.Success(nil)
+}
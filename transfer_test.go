@@ -0,0 +1,97 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestTransferBatch(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+	carol := h.newKID("carol")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	for _, kid := range []string{alice, bob, carol} {
+		h.mustInvokeAs(kid, "account/create", "PCI")
+	}
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	carolAddr := testAccountAddr("PCI", carol)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	// instant
+	entries := fmt.Sprintf(`[{"receiver":"%s","amount":"100","memo":"salary"},{"receiver":"%s","amount":"200"}]`, bobAddr, carolAddr)
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "transfer/batch", "", entries), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeSendBatch || log.Diff.String() != "-300" || log.Fee.String() != "3" {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	assertBalance(t, h, aliceAddr, "697")
+	assertBalance(t, h, bobAddr, "100")
+	assertBalance(t, h, carolAddr, "200")
+
+	// all or nothing
+	invalid := []string{
+		fmt.Sprintf(`[{"receiver":"%s","amount":"10"},{"receiver":"%s","amount":"10"}]`, bobAddr, testAccountAddr("PCI", h.newKID("nobody"))),
+		fmt.Sprintf(`[{"receiver":"%s","amount":"10"},{"receiver":"%s","amount":"10"}]`, bobAddr, bobAddr),
+		fmt.Sprintf(`[{"receiver":"%s","amount":"10"},{"receiver":"%s","amount":"0"}]`, bobAddr, carolAddr),
+		fmt.Sprintf(`[{"receiver":"%s","amount":"600"},{"receiver":"%s","amount":"100"}]`, bobAddr, carolAddr),
+	}
+	for _, entries := range invalid {
+		if res := h.invokeAs(alice, "transfer/batch", "", entries); res.Status == shim.OK {
+			t.Fatalf("batch must fail: %s", entries)
+		}
+	}
+	assertBalance(t, h, aliceAddr, "697")
+	assertBalance(t, h, bobAddr, "100")
+
+	// joint sender
+	data := h.mustInvokeAs(bob, "account/create", "PCI", carolAddr)
+	con := map[string]interface{}{}
+	if err := json.Unmarshal(data, &con); err != nil {
+		t.Fatal(err)
+	}
+	cid := con["@contract"].(string)
+	h.approveContract(cid, bob)
+	h.approveContract(cid, carol)
+	list := struct {
+		Records []*Holder `json:"records"`
+	}{}
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "account/list", "PCI"), &list); err != nil {
+		t.Fatal(err)
+	}
+	jointAddr := ""
+	for _, holder := range list.Records {
+		if holder.Type == AccountTypeJoint {
+			jointAddr = holder.Address
+		}
+	}
+	h.mustInvokeAs(issuer, "transfer", genesis, jointAddr, "500")
+
+	entries = fmt.Sprintf(`[{"receiver":"%s","amount":"100"},{"receiver":"%s","amount":"100"}]`, aliceAddr, bobAddr)
+	if err := json.Unmarshal(h.mustInvokeAs(bob, "transfer/batch", jointAddr, entries), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeDeposit {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	assertBalance(t, h, jointAddr, "298")
+	h.approveContract(log.RID, bob)
+	if res := h.approveContract(log.RID, carol); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	assertBalance(t, h, aliceAddr, "797")
+	assertBalance(t, h, bobAddr, "200")
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
-	"github.com/key-inside/kiesnet-ccpkg/contract"
 	"github.com/key-inside/kiesnet-ccpkg/kid"
 	"github.com/key-inside/kiesnet-ccpkg/stringset"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
@@ -16,11 +15,12 @@ import (
 
 // params[0] : sender address (empty string = personal account)
 // params[1] : receiver address
-// params[2] : amount (big int string)
+// params[2] : amount (big int string or decimal string)
 // params[3] : memo (see MemoMaxLength)
 // params[4] : pending time (time represented by int64 seconds)
 // params[5] : expiry (duration represented by int64 seconds, multi-sig only)
 // params[6:] : extra signers (personal account addresses)
+// transient "cancellable" : optional. the time-locked transfer is cancellable (see CancellableTransientKey)
 func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) < 3 {
 		return shim.Error("incorrect number of parameters. expecting 3+")
@@ -32,15 +32,6 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		return shim.Error(err.Error())
 	}
 
-	// amount
-	amount, err := NewAmount(params[2])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if amount.Sign() <= 0 {
-		return shim.Error("invalid amount. must be greater than 0")
-	}
-
 	// addresses
 	rAddr, err := ParseAddress(params[1])
 	if err != nil {
@@ -66,6 +57,21 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		return shim.Error("can't transfer to self")
 	}
 
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to transfer")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(rAddr.Code, params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
 	ab := NewAccountStub(stub, rAddr.Code)
 
 	// sender
@@ -100,7 +106,7 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	}
 
 	fb := NewFeeStub(stub)
-	fee, err := fb.CalcFee(sAddr, "transfer", *amount)
+	fee, feeExempt, err := fb.CalcFeeWithExemption(sAddr, "transfer", *amount)
 	if err != nil {
 		logger.Debug(err.Error())
 		return shim.Error("failed to get the fee amount")
@@ -114,7 +120,7 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	}
 
 	// receiver balance
-	rBal, err := bb.GetBalance(receiver.GetID())
+	rBal, err := bb.GetReceiverBalance(receiver)
 	if err != nil {
 		logger.Debug(err.Error())
 		return shim.Error("failed to get the receiver's balance")
@@ -124,9 +130,12 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	memo := ""
 	var pendingTime *txtime.Time
 	var expiry int64
+	cancellable := false
 	signers := stringset.New(kid)
+	quorum := 1
 	if a, ok := sender.(*JointAccount); ok {
 		signers.AppendSet(a.Holders)
+		quorum = a.Quorum()
 	}
 	// memo
 	if len(params) > 3 {
@@ -164,14 +173,28 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 						}
 						signers.AppendSlice(kids)
 					}
+					quorum = signers.Size() // extra signers must approve
 				}
 			}
 		}
 	}
+	// cancellable flag
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("failed to get the transient map")
+	}
+	if c := string(transient[CancellableTransientKey]); len(c) > 0 {
+		if cancellable, err = strconv.ParseBool(c); err != nil {
+			return shim.Error("invalid cancellable flag")
+		}
+	}
+	if cancellable && pendingTime == nil {
+		return shim.Error("only the time-locked transfer can be cancellable")
+	}
 
 	var log *BalanceLog // log for response
 
-	if signers.Size() > 1 { // multi-sig
+	if quorum > 1 { // multi-sig
 		if signers.Size() > 128 {
 			return shim.Error("too many signers")
 		}
@@ -182,13 +205,13 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		if pendingTime != nil {
 			ptStr = params[4]
 		}
-		doc := []string{"transfer", pbID, sender.GetID(), receiver.GetID(), amount.String(), fee.String(), memo, ptStr}
+		doc := []string{"transfer", pbID, sender.GetID(), receiver.GetID(), amount.String(), fee.String(), memo, ptStr, strconv.FormatBool(cancellable)}
 		docb, err := json.Marshal(doc)
 		if err != nil {
 			logger.Debug(err.Error())
 			return shim.Error("failed to create a contract")
 		}
-		con, err := contract.CreateContract(stub, docb, expiry, signers)
+		con, err := createContract(stub, docb, expiry, signers, quorum)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -199,7 +222,7 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 			return shim.Error("failed to create the pending balance")
 		}
 	} else { // instant sending
-		log, err = bb.Transfer(sBal, rBal, *amount, *fee, memo, pendingTime)
+		log, err = bb.Transfer(sBal, rBal, *amount, *fee, memo, pendingTime, cancellable)
 		if err != nil {
 			logger.Debug(err.Error())
 			return shim.Error("failed to transfer")
@@ -207,6 +230,7 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	}
 
 	// log is not nil
+	log.FeeExempt = feeExempt
 	data, err := json.Marshal(log)
 	if err != nil {
 		logger.Debug(err.Error())
@@ -216,9 +240,192 @@ func transfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	return shim.Success(data)
 }
 
+// params[0] : sender address (empty string = personal account)
+// params[1] : JSON array of entries [{"receiver":address, "amount":big int or decimal string, "memo":string}, ...] (max TransferBatchMaxSize)
+// params[2] : optional. expiry (duration represented by int64 seconds, multi-sig only)
+func transferBatch(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 2 {
+		return shim.Error("incorrect number of parameters. expecting 2+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// entries
+	inputs := []struct {
+		Receiver string `json:"receiver"`
+		Amount   string `json:"amount"`
+		Memo     string `json:"memo"`
+	}{}
+	if err = json.Unmarshal([]byte(params[1]), &inputs); err != nil {
+		return responseError(err, "failed to unmarshal the entries")
+	}
+	if len(inputs) < 1 {
+		return shim.Error("no entries")
+	}
+	if len(inputs) > TransferBatchMaxSize {
+		return shim.Error("too many entries")
+	}
+
+	// sender address
+	var sAddr *Address
+	if len(params[0]) > 0 {
+		sAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+	} else {
+		rAddr, err := ParseAddress(inputs[0].Receiver)
+		if err != nil {
+			return responseError(err, "failed to parse the receiver's account address")
+		}
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(sAddr.Code); err != nil {
+		return responseError(err, "failed to transfer")
+	}
+
+	ab := NewAccountStub(stub, sAddr.Code)
+
+	// sender
+	sender, err := ab.GetAccount(sAddr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !sender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if sender.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+
+	// receivers
+	bb := NewBalanceStub(stub)
+	fb := NewFeeStub(stub)
+	entries := []*TransferBatchEntry{}
+	receivers := []*Balance{}
+	rids := stringset.New() // duplication check
+	sum := ZeroAmount()     // sum of amounts
+	fee := ZeroAmount()     // sum of fees
+	for _, input := range inputs {
+		rAddr, err := ParseAddress(input.Receiver)
+		if err != nil {
+			return responseError(err, "failed to parse the receiver's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+		// IMPORTANT: assert(sender != receiver)
+		if sAddr.Equal(rAddr) {
+			return shim.Error("can't transfer to self")
+		}
+		if rids.Contains(rAddr.String()) {
+			return shim.Error("duplicated receiver: " + rAddr.String())
+		}
+		rids.Add(rAddr.String())
+
+		amount, err := tb.ParseAmount(sAddr.Code, input.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if amount.Sign() <= 0 {
+			return shim.Error("invalid amount. must be greater than 0")
+		}
+
+		receiver, err := ab.GetAccount(rAddr)
+		if err != nil {
+			return responseError(err, "failed to get the receiver account")
+		}
+		if receiver.IsSuspended() {
+			return shim.Error("the receiver account is suspended: " + rAddr.String())
+		}
+		rBal, err := bb.GetReceiverBalance(receiver)
+		if err != nil {
+			return responseError(err, "failed to get the receiver's balance")
+		}
+
+		eFee, err := fb.CalcFee(sAddr, "transfer", *amount)
+		if err != nil {
+			return responseError(err, "failed to get the fee amount")
+		}
+
+		memo := input.Memo
+		if len(memo) > MemoMaxLength { // length limit
+			memo = memo[:MemoMaxLength]
+		}
+
+		entries = append(entries, &TransferBatchEntry{Receiver: receiver.GetID(), Amount: *amount, Fee: eFee, Memo: memo})
+		receivers = append(receivers, rBal)
+		sum.Add(amount)
+		fee.Add(eFee)
+	}
+	applied := sum.Copy().Add(fee)
+
+	// sender balance
+	sBal, err := bb.GetBalance(sender.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+	if sBal.Amount.Cmp(applied) < 0 {
+		return shim.Error("not enough balance")
+	}
+
+	var log *BalanceLog // log for response
+
+	if jac, ok := sender.(*JointAccount); ok && jac.Quorum() > 1 { // multi-sig
+		var expiry int64
+		if len(params) > 2 && len(params[2]) > 0 {
+			expiry, err = strconv.ParseInt(params[2], 10, 64)
+			if err != nil {
+				return shim.Error("invalid expiry: need seconds")
+			}
+		}
+		// pending balance id
+		pbID := stub.GetTxID()
+		// contract
+		entriesb, err := json.Marshal(entries)
+		if err != nil {
+			return responseError(err, "failed to marshal the entries")
+		}
+		doc := []string{"transfer/batch", pbID, sender.GetID(), string(entriesb)}
+		docb, err := json.Marshal(doc)
+		if err != nil {
+			return responseError(err, "failed to create a contract")
+		}
+		con, err := createContract(stub, docb, expiry, jac.Holders, jac.Quorum())
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// pending balance
+		log, err = bb.Deposit(pbID, sBal, con, *sum, fee, "")
+		if err != nil {
+			return responseError(err, "failed to create the pending balance")
+		}
+	} else { // instant sending
+		log, err = bb.TransferBatch(sBal, receivers, entries)
+		if err != nil {
+			return responseError(err, "failed to transfer")
+		}
+	}
+
+	// log is not nil
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+
+	return shim.Success(data)
+}
+
 // contract callbacks
 
-// doc: ["transfer", pending-balance-ID, sender-ID, receiver-ID, amount, fee, memo, pending-time]
+// doc: ["transfer", pending-balance-ID, sender-ID, receiver-ID, amount, fee, memo, pending-time, cancellable]
 func cancelTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
 	if len(doc) < 2 {
 		return shim.Error("invalid contract document")
@@ -239,7 +446,7 @@ func cancelTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interfac
 	// ISSUE: check account ?
 
 	// withdraw
-	if _, err = bb.Withdraw(pb); err != nil {
+	if _, err = bb.Withdraw(pb, *ZeroAmount()); err != nil {
 		logger.Debug(err.Error())
 		return shim.Error("failed to withdraw")
 	}
@@ -247,7 +454,7 @@ func cancelTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interfac
 	return shim.Success(nil)
 }
 
-// doc: ["transfer", pending-balance-ID, sender-ID, receiver-ID, amount, fee, memo, pending-time]
+// doc: ["transfer", pending-balance-ID, sender-ID, receiver-ID, amount, fee, memo, pending-time, cancellable]
 func executeTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
 	if len(doc) < 8 {
 		return shim.Error("invalid contract document")
@@ -267,8 +474,22 @@ func executeTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interfa
 
 	// ISSUE: check accounts ? (suspended)
 
+	// token
+	addr, _ := ParseAddress(pb.Account) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to transfer a pending balance")
+	}
+
 	// receiver balance
-	rBal, err := bb.GetBalance(doc[3].(string))
+	rAddr, err := ParseAddress(doc[3].(string))
+	if err != nil {
+		return responseError(err, "failed to parse the receiver's account address")
+	}
+	receiver, err := NewAccountStub(stub, rAddr.Code).GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the receiver account")
+	}
+	rBal, err := bb.GetReceiverBalance(receiver)
 	if err != nil {
 		logger.Debug(err.Error())
 		return shim.Error("failed to get the receiver's balance")
@@ -285,11 +506,74 @@ func executeTransfer(stub shim.ChaincodeStubInterface, cid string, doc []interfa
 		pendingTime = txtime.Unix(seconds, 0)
 	}
 
+	// cancellable
+	cancellable := false
+	if len(doc) > 8 {
+		cancellable, _ = strconv.ParseBool(doc[8].(string))
+	}
+
 	// transfer
-	if err = bb.TransferPendingBalance(pb, rBal, pendingTime); err != nil {
+	if err = bb.TransferPendingBalance(pb, rBal, pendingTime, cancellable); err != nil {
 		logger.Debug(err.Error())
 		return shim.Error("failed to transfer a pending balance")
 	}
 
 	return shim.Success(nil)
 }
+
+// doc: ["transfer/batch", pending-balance-ID, sender-ID, entries]
+func executeTransferBatch(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 4 {
+		return shim.Error("invalid contract document")
+	}
+
+	// pending balance
+	bb := NewBalanceStub(stub)
+	pb, err := bb.GetPendingBalance(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the pending balance")
+	}
+	// validate
+	if pb.Type != PendingBalanceTypeContract || pb.RID != cid {
+		return shim.Error("invalid pending balance")
+	}
+
+	// token
+	addr, _ := ParseAddress(pb.Account) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to transfer a pending balance")
+	}
+
+	entries := []*TransferBatchEntry{}
+	if err = json.Unmarshal([]byte(doc[3].(string)), &entries); err != nil {
+		return responseError(err, "failed to unmarshal the entries")
+	}
+
+	// ISSUE: check accounts ? (suspended)
+
+	// receiver balances
+	ab := NewAccountStub(stub, addr.Code)
+	receivers := []*Balance{}
+	for _, entry := range entries {
+		rAddr, err := ParseAddress(entry.Receiver)
+		if err != nil {
+			return responseError(err, "failed to parse the receiver's account address")
+		}
+		receiver, err := ab.GetAccount(rAddr)
+		if err != nil {
+			return responseError(err, "failed to get the receiver account")
+		}
+		rBal, err := bb.GetReceiverBalance(receiver)
+		if err != nil {
+			return responseError(err, "failed to get the receiver's balance")
+		}
+		receivers = append(receivers, rBal)
+	}
+
+	// transfer
+	if err = bb.TransferPendingBalanceBatch(pb, receivers, entries); err != nil {
+		return responseError(err, "failed to transfer a pending balance")
+	}
+
+	return shim.Success(nil)
+}
@@ -0,0 +1,114 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"math/big"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// VestingType _
+type VestingType int8
+
+const (
+	// VestingTypeCliff vests the whole amount at the cliff time
+	VestingTypeCliff VestingType = iota
+	// VestingTypeLinear vests the amount linearly from the start time to the end time
+	VestingTypeLinear
+	// VestingTypeMonthly vests the amount in monthly tranches from the start time
+	VestingTypeMonthly
+)
+
+// VestingMaxTranches is the max number of monthly tranches
+const VestingMaxTranches = 240
+
+// ParseVestingType parses the vesting type name. (cliff, linear or monthly)
+func ParseVestingType(name string) (VestingType, bool) {
+	switch name {
+	case "cliff":
+		return VestingTypeCliff, true
+	case "linear":
+		return VestingTypeLinear, true
+	case "monthly":
+		return VestingTypeMonthly, true
+	}
+	return VestingTypeCliff, false
+}
+
+// VestingSchedule _
+type VestingSchedule struct {
+	Type      VestingType  `json:"type"`
+	StartTime *txtime.Time `json:"start_time"`
+	CliffTime *txtime.Time `json:"cliff_time,omitempty"` // nothing is vested before the cliff time
+	EndTime   *txtime.Time `json:"end_time,omitempty"`   // linear only
+	Tranches  int          `json:"tranches,omitempty"`   // monthly only
+	Revocable bool         `json:"revocable"`
+}
+
+// Vesting is the amount locked from the sender and released to the beneficiary by the schedule.
+type Vesting struct {
+	DOCTYPEID   string `json:"@vesting"` // id
+	Sender      string `json:"sender"`   // address
+	Beneficiary string `json:"beneficiary"`
+	Amount      Amount `json:"amount"`
+	Claimed     Amount `json:"claimed"`
+	Revoked     Amount `json:"revoked"` // unvested amount returned to the sender
+	VestingSchedule
+	Memo        string       `json:"memo"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+	RevokedTime *txtime.Time `json:"revoked_time,omitempty"`
+}
+
+// GetID implements Identifiable
+func (v *Vesting) GetID() string {
+	return v.DOCTYPEID
+}
+
+// IsRevoked _
+func (v *Vesting) IsRevoked() bool {
+	return v.RevokedTime != nil
+}
+
+// VestedAmount returns the amount vested at the time.
+// The revoked vesting stops vesting at the revoked time.
+func (v *Vesting) VestedAmount(t *txtime.Time) *Amount {
+	if v.RevokedTime != nil && v.RevokedTime.Cmp(t) < 0 {
+		t = v.RevokedTime
+	}
+	if v.CliffTime != nil && t.Cmp(v.CliffTime) < 0 {
+		return ZeroAmount()
+	}
+	switch v.Type {
+	case VestingTypeLinear:
+		if t.Cmp(v.EndTime) >= 0 {
+			return v.Amount.Copy()
+		}
+		elapsed := t.Sub(v.StartTime.Time).Nanoseconds()
+		if elapsed <= 0 {
+			return ZeroAmount()
+		}
+		period := v.EndTime.Sub(v.StartTime.Time).Nanoseconds()
+		return v.Amount.Copy().MulRat(big.NewRat(elapsed, period))
+	case VestingTypeMonthly:
+		n := 0
+		for n < v.Tranches && !t.Before(v.StartTime.AddDate(0, n+1, 0)) {
+			n++
+		}
+		if n == v.Tranches {
+			return v.Amount.Copy()
+		}
+		return v.Amount.Copy().MulRat(big.NewRat(int64(n), int64(v.Tranches)))
+	}
+	// cliff
+	if t.Cmp(v.StartTime) < 0 {
+		return ZeroAmount()
+	}
+	return v.Amount.Copy()
+}
+
+// ClaimableAmount returns the vested amount which is not claimed yet.
+func (v *Vesting) ClaimableAmount(t *txtime.Time) *Amount {
+	return v.VestedAmount(t).Add(v.Claimed.Copy().Neg())
+}
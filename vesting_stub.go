@@ -0,0 +1,218 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// VestingStub _
+type VestingStub struct {
+	stub shim.ChaincodeStubInterface
+}
+
+// NewVestingStub _
+func NewVestingStub(stub shim.ChaincodeStubInterface) *VestingStub {
+	return &VestingStub{stub}
+}
+
+// CreateKey _
+func (vb *VestingStub) CreateKey(id string) string {
+	return "VST_" + id
+}
+
+// GetVesting _
+func (vb *VestingStub) GetVesting(id string) (*Vesting, error) {
+	data, err := vb.GetVestingState(id)
+	if err != nil {
+		return nil, err
+	}
+	// data is not nil
+	v := &Vesting{}
+	if err = json.Unmarshal(data, v); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the vesting")
+	}
+	return v, nil
+}
+
+// GetVestingState _
+func (vb *VestingStub) GetVestingState(id string) ([]byte, error) {
+	data, err := vb.stub.GetState(vb.CreateKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the vesting state")
+	}
+	if data != nil {
+		return data, nil
+	}
+	return nil, NotExistedVestingError{id: id}
+}
+
+// PutVesting _
+func (vb *VestingStub) PutVesting(v *Vesting) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the vesting")
+	}
+	if err = vb.stub.PutState(vb.CreateKey(v.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the vesting state")
+	}
+	return nil
+}
+
+// CreateVesting locks the amount of the sender's balance into the vesting. The vesting ID is the txid.
+func (vb *VestingStub) CreateVesting(sender *Balance, beneficiary string, amount, fee Amount, schedule VestingSchedule, memo string) (*Vesting, *BalanceLog, error) {
+	ts, err := txtime.GetTime(vb.stub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	v := &Vesting{
+		DOCTYPEID:       vb.stub.GetTxID(),
+		Sender:          sender.GetID(),
+		Beneficiary:     beneficiary,
+		Amount:          amount,
+		VestingSchedule: schedule,
+		Memo:            memo,
+		CreatedTime:     ts,
+		UpdatedTime:     ts,
+	}
+	if err = vb.PutVesting(v); err != nil {
+		return nil, nil, err
+	}
+
+	// applied = (amount + fee)
+	applied := amount.Copy().Add(&fee)
+	sender.Amount.Add(applied.Neg()) // -applied
+	sender.UpdatedTime = ts
+	bb := NewBalanceStub(vb.stub)
+	if err = bb.PutBalance(sender); err != nil {
+		return nil, nil, err
+	}
+	log := NewBalanceVestingLog(sender, BalanceLogTypeVestingLock, v, *amount.Copy().Neg(), &fee)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, nil, err
+	}
+
+	// fee
+	if _, err = NewFeeStub(vb.stub).CreateFee(sender.GetID(), fee); err != nil {
+		return nil, nil, err
+	}
+
+	return v, log, nil
+}
+
+// CreateVestingFromPendingBalance locks the sender's pending balance into the vesting. (multi-sig contract)
+// The vesting ID is the pending balance ID.
+func (vb *VestingStub) CreateVestingFromPendingBalance(pb *PendingBalance, beneficiary string, schedule VestingSchedule) (*Vesting, error) {
+	ts, err := txtime.GetTime(vb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	v := &Vesting{
+		DOCTYPEID:       pb.DOCTYPEID,
+		Sender:          pb.Account,
+		Beneficiary:     beneficiary,
+		Amount:          pb.Amount,
+		VestingSchedule: schedule,
+		Memo:            pb.Memo,
+		CreatedTime:     ts,
+		UpdatedTime:     ts,
+	}
+	if err = vb.PutVesting(v); err != nil {
+		return nil, err
+	}
+
+	// fee
+	if pb.Fee != nil {
+		if _, err = NewFeeStub(vb.stub).CreateFee(pb.Account, *pb.Fee); err != nil {
+			return nil, err
+		}
+	}
+
+	// remove pending balance
+	if err = NewBalanceStub(vb.stub).DeletePendingBalance(pb); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Claim adds the claimable amount of the vesting to the beneficiary's balance.
+func (vb *VestingStub) Claim(v *Vesting, bal *Balance) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(vb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	amount := v.ClaimableAmount(ts)
+	if amount.Sign() <= 0 {
+		return nil, errors.New("no claimable amount")
+	}
+
+	v.Claimed.Add(amount)
+	v.UpdatedTime = ts
+	if err = vb.PutVesting(v); err != nil {
+		return nil, err
+	}
+
+	bal.Amount.Add(amount)
+	bal.UpdatedTime = ts
+	bb := NewBalanceStub(vb.stub)
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceVestingLog(bal, BalanceLogTypeVestingClaim, v, *amount, nil)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// Revoke stops the vesting and returns the unvested amount to the sender's balance.
+// The vested amount remains claimable by the beneficiary.
+func (vb *VestingStub) Revoke(v *Vesting, bal *Balance) (*BalanceLog, error) {
+	ts, err := txtime.GetTime(vb.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if !v.Revocable {
+		return nil, errors.New("the vesting is not revocable")
+	}
+	if v.IsRevoked() {
+		return nil, errors.New("already revoked")
+	}
+	unvested := v.Amount.Copy().Add(v.VestedAmount(ts).Neg())
+	if unvested.Sign() <= 0 {
+		return nil, errors.New("no unvested amount")
+	}
+
+	v.Revoked = *unvested
+	v.RevokedTime = ts
+	v.UpdatedTime = ts
+	if err = vb.PutVesting(v); err != nil {
+		return nil, err
+	}
+
+	bal.Amount.Add(unvested)
+	bal.UpdatedTime = ts
+	bb := NewBalanceStub(vb.stub)
+	if err = bb.PutBalance(bal); err != nil {
+		return nil, err
+	}
+	log := NewBalanceVestingLog(bal, BalanceLogTypeVestingRevoke, v, *unvested, nil)
+	log.CreatedTime = ts
+	if err = bb.PutBalanceLog(log); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
@@ -0,0 +1,137 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+func TestVestingLinearClaimRevoke(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+
+	// linear vesting for 100 seconds from now (the next tx time)
+	end := strconv.FormatInt(h.clock.Unix()+101, 10)
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(issuer, "vesting/create", genesis, aliceAddr, "1000", "linear", "0", "0", end, "true"), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type != BalanceLogTypeVestingLock || log.Diff.String() != "-1000" {
+		t.Fatalf("unexpected lock log: %+v", log)
+	}
+	vid := log.RID
+	assertBalance(t, h, genesis, "9000")
+
+	if res := h.invokeAs(issuer, "vesting/claim", vid); res.Status == shim.OK {
+		t.Fatal("only the beneficiary can claim")
+	}
+
+	// half vested
+	h.advance(48 * time.Second)
+	h.mustInvokeAs(alice, "vesting/claim", vid)
+	assertBalance(t, h, aliceAddr, "500")
+
+	// revoke returns the unvested amount
+	h.mustInvokeAs(issuer, "vesting/revoke", vid)
+	assertBalance(t, h, genesis, "9490")
+	if res := h.invokeAs(issuer, "vesting/revoke", vid); res.Status == shim.OK {
+		t.Fatal("already revoked")
+	}
+
+	// the vested amount remains claimable
+	h.advance(time.Minute)
+	h.mustInvokeAs(alice, "vesting/claim", vid)
+	assertBalance(t, h, aliceAddr, "510")
+	if res := h.invokeAs(alice, "vesting/claim", vid); res.Status == shim.OK {
+		t.Fatal("nothing to claim")
+	}
+	event := getTestBalanceEvent(t, h)
+	if len(event.Changes) != 1 || event.Changes[0].Type != BalanceLogTypeVestingClaim || event.Changes[0].Diff.String() != "10" {
+		t.Fatalf("unexpected balance event: %+v", event)
+	}
+}
+
+func TestVestingCliff(t *testing.T) {
+	h := newTestHarness(t)
+	h.setTokenMeta("PCI", testTokenMeta)
+
+	issuer := h.newKID("issuer")
+	alice := h.newKID("alice")
+	bob := h.newKID("bob")
+
+	h.mustInvokeAs(issuer, "token/create", "PCI")
+	genesis := getTestToken(t, h, "PCI").GenesisAccount
+	h.mustInvokeAs(alice, "account/create", "PCI")
+	h.mustInvokeAs(bob, "account/create", "PCI")
+	aliceAddr := testAccountAddr("PCI", alice)
+	bobAddr := testAccountAddr("PCI", bob)
+	h.mustInvokeAs(issuer, "transfer", genesis, aliceAddr, "1000")
+
+	if res := h.invokeAs(alice, "vesting/create", "", bobAddr, "100", "cliff", "0", "0", ""); res.Status == shim.OK {
+		t.Fatal("the cliff time is required")
+	}
+
+	cliff := strconv.FormatInt(h.clock.Unix()+30, 10)
+	log := &BalanceLog{}
+	if err := json.Unmarshal(h.mustInvokeAs(alice, "vesting/create", "", bobAddr, "100", "cliff", "0", cliff, ""), log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Fee == nil || log.Fee.String() != "1" {
+		t.Fatalf("unexpected fee: %+v", log)
+	}
+	assertBalance(t, h, aliceAddr, "899")
+
+	if res := h.invokeAs(bob, "vesting/claim", log.RID); res.Status == shim.OK {
+		t.Fatal("too early to claim")
+	}
+	if res := h.invokeAs(issuer, "vesting/revoke", log.RID); res.Status == shim.OK {
+		t.Fatal("the vesting is not revocable")
+	}
+
+	h.advance(30 * time.Second)
+	h.mustInvokeAs(bob, "vesting/claim", log.RID)
+	assertBalance(t, h, bobAddr, "100")
+}
+
+func TestVestingMonthlyAmount(t *testing.T) {
+	start := time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC)
+	amount, _ := NewAmount("1000")
+	v := &Vesting{
+		Amount: *amount,
+		VestingSchedule: VestingSchedule{
+			Type:      VestingTypeMonthly,
+			StartTime: txtime.New(start),
+			CliffTime: txtime.New(start.AddDate(0, 2, 0)),
+			Tranches:  3,
+		},
+	}
+	cases := []struct {
+		t        time.Time
+		expected string
+	}{
+		{start.AddDate(0, 1, 0), "0"}, // before the cliff
+		{start.AddDate(0, 2, -1), "0"},
+		{start.AddDate(0, 2, 0), "666"},
+		{start.AddDate(0, 3, 0), "1000"},
+		{start.AddDate(1, 0, 0), "1000"},
+	}
+	for _, c := range cases {
+		if vested := v.VestedAmount(txtime.New(c.t)); vested.String() != c.expected {
+			t.Errorf("vested amount at %s: expected %s, got %s", c.t, c.expected, vested)
+		}
+	}
+}
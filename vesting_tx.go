@@ -0,0 +1,482 @@
+// Copyright Key Inside Co., Ltd. 2019 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/kid"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// params[0] : sender address (empty string = personal account)
+// params[1] : beneficiary address
+// params[2] : amount (big int string or decimal string)
+// params[3] : schedule type ("cliff" | "linear" | "monthly")
+// params[4] : start time (time represented by int64 seconds, 0 = now)
+// params[5] : cliff time (time represented by int64 seconds, 0 = no cliff, required for "cliff")
+// params[6] : end time (time represented by int64 seconds) for "linear", number of tranches for "monthly", ignored for "cliff"
+// params[7] : optional. revocable ("true" | "false", default false)
+// params[8] : optional. memo (see MemoMaxLength)
+// params[9] : optional. expiry (duration represented by int64 seconds, multi-sig only)
+func vestingCreate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 7 {
+		return shim.Error("incorrect number of parameters. expecting 7+")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// addresses
+	rAddr, err := ParseAddress(params[1])
+	if err != nil {
+		return responseError(err, "failed to parse the beneficiary's account address")
+	}
+	var sAddr *Address
+	if len(params[0]) > 0 {
+		sAddr, err = ParseAddress(params[0])
+		if err != nil {
+			return responseError(err, "failed to parse the sender's account address")
+		}
+		if rAddr.Code != sAddr.Code { // not same token
+			return shim.Error("different token accounts")
+		}
+	} else {
+		sAddr = NewAddress(rAddr.Code, AccountTypePersonal, kid)
+	}
+
+	// IMPORTANT: assert(sender != beneficiary)
+	if sAddr.Equal(rAddr) {
+		return shim.Error("can't vest to self")
+	}
+
+	// token
+	tb := NewTokenStub(stub)
+	if err = tb.AssertNotPaused(rAddr.Code); err != nil {
+		return responseError(err, "failed to create the vesting")
+	}
+
+	// amount
+	amount, err := tb.ParseAmount(rAddr.Code, params[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount.Sign() <= 0 {
+		return shim.Error("invalid amount. must be greater than 0")
+	}
+
+	// schedule
+	schedule, err := parseVestingSchedule(stub, params[3:7])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// options
+	memo := ""
+	var expiry int64
+	if len(params) > 7 {
+		if schedule.Revocable, err = strconv.ParseBool(params[7]); err != nil {
+			return shim.Error("invalid revocable flag")
+		}
+		// memo
+		if len(params) > 8 {
+			if len(params[8]) > MemoMaxLength { // length limit
+				memo = params[8][:MemoMaxLength]
+			} else {
+				memo = params[8]
+			}
+			// expiry
+			if len(params) > 9 && len(params[9]) > 0 {
+				expiry, err = strconv.ParseInt(params[9], 10, 64)
+				if err != nil {
+					return shim.Error("invalid expiry: need seconds")
+				}
+			}
+		}
+	}
+
+	ab := NewAccountStub(stub, rAddr.Code)
+
+	// sender
+	sender, err := ab.GetAccount(sAddr)
+	if err != nil {
+		return responseError(err, "failed to get the sender account")
+	}
+	if !sender.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if sender.IsSuspended() {
+		return shim.Error("the sender account is suspended")
+	}
+
+	// beneficiary
+	beneficiary, err := ab.GetAccount(rAddr)
+	if err != nil {
+		return responseError(err, "failed to get the beneficiary account")
+	}
+	if beneficiary.IsSuspended() {
+		return shim.Error("the beneficiary account is suspended")
+	}
+
+	// sender balance
+	bb := NewBalanceStub(stub)
+	sBal, err := bb.GetBalance(sender.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	fee, err := NewFeeStub(stub).CalcFee(sAddr, "transfer", *amount)
+	if err != nil {
+		return responseError(err, "failed to get the fee amount")
+	}
+
+	// fee is not nil
+	applied := amount.Copy().Add(fee)
+
+	if sBal.Amount.Cmp(applied) < 0 {
+		return shim.Error("not enough balance")
+	}
+
+	var log *BalanceLog // log for response
+
+	if jac, ok := sender.(*JointAccount); ok && jac.Quorum() > 1 { // multi-sig
+		// pending balance id
+		pbID := stub.GetTxID()
+		// contract
+		scheduleb, err := json.Marshal(schedule)
+		if err != nil {
+			return responseError(err, "failed to marshal the schedule")
+		}
+		doc := []string{"vesting/create", pbID, sender.GetID(), beneficiary.GetID(), amount.String(), fee.String(), string(scheduleb), memo}
+		docb, err := json.Marshal(doc)
+		if err != nil {
+			return responseError(err, "failed to create a contract")
+		}
+		con, err := createContract(stub, docb, expiry, jac.Holders, jac.Quorum())
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// pending balance
+		log, err = bb.Deposit(pbID, sBal, con, *amount, fee, memo)
+		if err != nil {
+			return responseError(err, "failed to create the pending balance")
+		}
+	} else {
+		_, log, err = NewVestingStub(stub).CreateVesting(sBal, beneficiary.GetID(), *amount, *fee, *schedule, memo)
+		if err != nil {
+			return responseError(err, "failed to create the vesting")
+		}
+	}
+
+	// log is not nil
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+
+	return shim.Success(data)
+}
+
+// params[0] : vesting ID
+func vestingClaim(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// vesting
+	vb := NewVestingStub(stub)
+	v, err := vb.GetVesting(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the vesting")
+	}
+	if v.ClaimableAmount(ts).Sign() <= 0 {
+		return shim.Error("nothing to claim")
+	}
+
+	// beneficiary
+	addr, _ := ParseAddress(v.Beneficiary) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to claim")
+	}
+	account, err := NewAccountStub(stub, addr.Code).GetAccount(addr)
+	if err != nil {
+		return responseError(err, "failed to get the beneficiary account")
+	}
+	if !account.HasHolder(kid) {
+		return shim.Error("invoker is not holder")
+	}
+	if account.IsSuspended() {
+		return shim.Error("the beneficiary account is suspended")
+	}
+
+	// balance
+	bal, err := NewBalanceStub(stub).GetBalance(account.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the beneficiary's balance")
+	}
+
+	log, err := vb.Claim(v, bal)
+	if err != nil {
+		return responseError(err, "failed to claim")
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		return responseError(err, "failed to marshal the log")
+	}
+	return shim.Success(data)
+}
+
+// params[0] : vesting ID
+func vestingGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	// authentication
+	_, err := kid.GetID(stub, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	v, err := NewVestingStub(stub).GetVesting(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the vesting")
+	}
+
+	data, err := json.Marshal(&struct {
+		*Vesting
+		Vested    *Amount `json:"vested"`
+		Claimable *Amount `json:"claimable"`
+	}{v, v.VestedAmount(ts), v.ClaimableAmount(ts)})
+	if err != nil {
+		return responseError(err, "failed to marshal the vesting")
+	}
+	return shim.Success(data)
+}
+
+// revoke the vesting by the token authority (genesis account holders)
+// params[0] : vesting ID
+func vestingRevoke(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return shim.Error("incorrect number of parameters. expecting 1")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	// authentication
+	kid, err := kid.GetID(stub, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// vesting
+	vb := NewVestingStub(stub)
+	v, err := vb.GetVesting(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the vesting")
+	}
+	if !v.Revocable {
+		return shim.Error("the vesting is not revocable")
+	}
+	if v.IsRevoked() {
+		return shim.Error("already revoked")
+	}
+	if v.VestedAmount(ts).Cmp(&v.Amount) >= 0 {
+		return shim.Error("already fully vested")
+	}
+
+	// token
+	addr, _ := ParseAddress(v.Sender) // err is nil
+	token, err := NewTokenStub(stub).GetToken(addr.Code)
+	if err != nil {
+		return responseError(err, "failed to get the token")
+	}
+
+	// genesis account
+	gAddr, _ := ParseAddress(token.GenesisAccount) // err is nil
+	genesis, err := NewAccountStub(stub, addr.Code).GetAccount(gAddr)
+	if err != nil {
+		return responseError(err, "failed to get the genesis account")
+	}
+	if !genesis.HasHolder(kid) { // authority
+		return shim.Error("no authority")
+	}
+
+	jac := genesis.(*JointAccount)
+	if jac.Quorum() > 1 {
+		// contract
+		doc := []interface{}{"vesting/revoke", v.DOCTYPEID}
+		return invokeContract(stub, doc, jac.Holders, jac.Quorum())
+	}
+
+	// sender balance
+	bal, err := NewBalanceStub(stub).GetBalance(v.Sender)
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	if _, err = vb.Revoke(v, bal); err != nil {
+		return responseError(err, "failed to revoke the vesting")
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return responseError(err, "failed to marshal the vesting")
+	}
+	return shim.Success(data)
+}
+
+// contract callbacks
+
+// doc: ["vesting/create", pending-balance-ID, sender-ID, beneficiary-ID, amount, fee, schedule, memo]
+func executeVestingCreate(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 8 {
+		return shim.Error("invalid contract document")
+	}
+
+	// pending balance
+	bb := NewBalanceStub(stub)
+	pb, err := bb.GetPendingBalance(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the pending balance")
+	}
+	// validate
+	if pb.Type != PendingBalanceTypeContract || pb.RID != cid {
+		return shim.Error("invalid pending balance")
+	}
+
+	// token
+	addr, _ := ParseAddress(pb.Account) // err is nil
+	if err = NewTokenStub(stub).AssertNotPaused(addr.Code); err != nil {
+		return responseError(err, "failed to create the vesting")
+	}
+
+	schedule := VestingSchedule{}
+	if err = json.Unmarshal([]byte(doc[6].(string)), &schedule); err != nil {
+		return responseError(err, "failed to unmarshal the schedule")
+	}
+
+	if _, err = NewVestingStub(stub).CreateVestingFromPendingBalance(pb, doc[3].(string), schedule); err != nil {
+		return responseError(err, "failed to create the vesting")
+	}
+
+	return shim.Success(nil)
+}
+
+// doc: ["vesting/revoke", vesting-ID]
+func executeVestingRevoke(stub shim.ChaincodeStubInterface, cid string, doc []interface{}) peer.Response {
+	if len(doc) < 2 {
+		return shim.Error("invalid contract document")
+	}
+
+	vb := NewVestingStub(stub)
+	v, err := vb.GetVesting(doc[1].(string))
+	if err != nil {
+		return responseError(err, "failed to get the vesting")
+	}
+
+	bal, err := NewBalanceStub(stub).GetBalance(v.Sender)
+	if err != nil {
+		return responseError(err, "failed to get the sender's balance")
+	}
+
+	if _, err = vb.Revoke(v, bal); err != nil {
+		return responseError(err, "failed to revoke the vesting")
+	}
+
+	return shim.Success(nil)
+}
+
+// helpers
+
+// parseVestingSchedule parses [type, start time, cliff time, end time or tranches] and validates the schedule.
+func parseVestingSchedule(stub shim.ChaincodeStubInterface, params []string) (*VestingSchedule, error) {
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	vtype, ok := ParseVestingType(params[0])
+	if !ok {
+		return nil, errors.New("invalid schedule type. must be cliff, linear or monthly")
+	}
+	schedule := &VestingSchedule{Type: vtype, StartTime: ts}
+
+	// start time
+	seconds, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid start time: need seconds since 1970")
+	}
+	if seconds > 0 {
+		schedule.StartTime = txtime.Unix(seconds, 0)
+	}
+
+	// cliff time
+	seconds, err = strconv.ParseInt(params[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cliff time: need seconds since 1970")
+	}
+	if seconds > 0 {
+		schedule.CliffTime = txtime.Unix(seconds, 0)
+		if schedule.CliffTime.Cmp(schedule.StartTime) < 0 {
+			return nil, errors.New("the cliff time must not be before the start time")
+		}
+	}
+
+	switch vtype {
+	case VestingTypeCliff:
+		if schedule.CliffTime == nil {
+			return nil, errors.New("the cliff time is required")
+		}
+	case VestingTypeLinear:
+		seconds, err = strconv.ParseInt(params[3], 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid end time: need seconds since 1970")
+		}
+		schedule.EndTime = txtime.Unix(seconds, 0)
+		if schedule.EndTime.Cmp(schedule.StartTime) <= 0 {
+			return nil, errors.New("the end time must be after the start time")
+		}
+		if schedule.CliffTime != nil && schedule.CliffTime.Cmp(schedule.EndTime) > 0 {
+			return nil, errors.New("the cliff time must not be after the end time")
+		}
+	case VestingTypeMonthly:
+		schedule.Tranches, err = strconv.Atoi(params[3])
+		if err != nil || schedule.Tranches < 1 || schedule.Tranches > VestingMaxTranches {
+			return nil, errors.Errorf("invalid number of tranches. must be 1 ~ %d", VestingMaxTranches)
+		}
+		last := txtime.New(schedule.StartTime.AddDate(0, schedule.Tranches, 0))
+		if schedule.CliffTime != nil && schedule.CliffTime.Cmp(last) > 0 {
+			return nil, errors.New("the cliff time must not be after the last tranche")
+		}
+	}
+
+	return schedule, nil
+}